@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	MFTAttributes "github.com/aarsakian/FileSystemForensics/FS/NTFS/MFT/attributes"
+	"github.com/aarsakian/FileSystemForensics/FS/NTFS/wof"
 	"github.com/aarsakian/FileSystemForensics/img"
 	"github.com/aarsakian/FileSystemForensics/logger"
 	"golang.org/x/text/language"
@@ -18,6 +20,9 @@ import (
 
 var RecordSize = 1024
 
+// max bytes read at once when streaming fragments
+var FragmentSize = int64(1 << 20)
+
 var IndexEntryFlags = map[string]string{
 	"00000001": "Child Node exists",
 	"00000002": "Last Entry in list",
@@ -41,6 +46,12 @@ type FixUp struct {
 	OriginalValues [][]byte
 }
 
+// allocated part of a stream at its logical offset
+type Fragment struct {
+	Offset int64
+	Data   []byte
+}
+
 type Attribute interface {
 	FindType() string
 	SetHeader(header *MFTAttributes.AttributeHeader)
@@ -81,9 +92,24 @@ type Record struct {
 	OriginLinkedRecord   *Record            // points to the original record that contaisn the attr list
 	I30Size              uint64
 	Parent               *Record
+	HardLinks            []HardLink                        // one per directory holding a $FILE_NAME of the record
+	LinkTarget           *Record                           // record pointed by a symbolic link or junction
+	LinkSources          []*Record                         // symbolic links or junctions pointing to the record
+	SecurityDescriptor   *MFTAttributes.SecurityDescriptor // resolved from $Secure:$SDS by security id
+	Recoverability       *Recoverability                   // of deleted records
+	Carved               bool                              // recovered from unallocated clusters
+	UpCase               UpCase                            // $UpCase table of the volume, shared by its records
+	ObjIdEntry           *MFTAttributes.ObjIdEntry         // from $Extend\$ObjId:$O
 	// fixupArray add the        UpdateSeqArrOffset to find is location
 
 }
+
+// name of the record within a parent directory
+type HardLink struct {
+	Parent *Record
+	Fname  string
+}
+
 type IndexAttributes interface {
 	GetIndexEntriesSortedByMFTEntry() MFTAttributes.IndexEntries
 }
@@ -100,6 +126,19 @@ func (record Record) IsFolder() bool {
 	return recordType == "Folder Unallocated" || recordType == "Folder Allocated"
 }
 
+// system files created by format and the files of $Extend (entry 11)
+func (record Record) IsMetadata() bool {
+	if record.Entry < 16 {
+		return true
+	}
+	for parent := record.Parent; parent != nil && parent.Entry != 5; parent = parent.Parent {
+		if parent.Entry == 11 {
+			return true
+		}
+	}
+	return false
+}
+
 func (record *Record) ProcessNoNResidentAttributes(hD img.DiskReader, partitionOffsetB int64, clusterSizeB int) {
 
 	diskSizeB := hD.GetDiskSize()
@@ -127,6 +166,15 @@ func (record *Record) ProcessNoNResidentAttributes(hD img.DiskReader, partitionO
 
 			clusters := int(runlist.Length)
 
+			if runlist.IsSparse() {
+				buf.Write(make([]byte, clusters*clusterSizeB))
+				if runlist.Next == nil {
+					break
+				}
+				runlist = *runlist.Next
+				continue
+			}
+
 			//inefficient since allocates memory for each round
 			if offset*int64(clusterSizeB) >= diskSizeB-partitionOffsetB {
 				msg := fmt.Sprintf("attribute runlist offset exceeds partition size %d.",
@@ -153,38 +201,93 @@ func (record *Record) ProcessNoNResidentAttributes(hD img.DiskReader, partitionO
 		attribute.Parse(buf.Bytes()[:actualLen])
 
 	}
+	record.ApplyIndexBitmap()
 
 }
 
-func (record Record) LocateDataAsync(hD img.DiskReader, partitionOffset int64, sectorsPerCluster int, bytesPerSector int, dataFragments chan<- []byte) {
-	writeOffset := 0
-	p := message.NewPrinter(language.Greek)
-	if record.HasResidentDataAttr() {
-		dataFragments <- record.GetResidentData()
+func (record Record) LocateData(hD img.DiskReader, partitionOffset int64, sectorsPerCluster int, bytesPerSector int, results chan<- utils.AskedFile) {
+	logicalSize := record.GetLogicalFileSize()
+	clusterSizeB := int64(sectorsPerCluster * bytesPerSector)
+
+	var content []byte
+	validDataLength := record.GetValidDataLength()
+
+	if record.IsEncrypted() && !record.HasResidentDataAttr() { // raw ciphertext fills whole blocks
+		efsInfo := "$EFS stream not found"
+		if efs := record.GetEFS(); efs != nil {
+			efsInfo = efs.GetInfo()
+		}
+		size := (logicalSize + MFTAttributes.EFSBlockSize - 1) / MFTAttributes.EFSBlockSize * MFTAttributes.EFSBlockSize
+		results <- utils.AskedFile{Fname: record.GetFname(), Content: readExtents(hD, partitionOffset, clusterSizeB, record.GetDataExtents(), size),
+			Id: int(record.Entry), Paths: record.GetHardLinkPaths(), EFSInfo: efsInfo}
+		return
+
+	} else if record.IsWofCompressed() {
+		content = record.locateWofData(hD, partitionOffset, clusterSizeB)
+		validDataLength = logicalSize
+
+	} else if record.HasResidentDataAttr() {
+		content = record.GetResidentData()
 
 	} else {
-		var runlist MFTAttributes.RunList
+		content = readExtents(hD, partitionOffset, clusterSizeB, record.GetDataExtents(), logicalSize)
+	}
 
-		runlist = record.GetRunList("DATA")
+	results <- utils.AskedFile{Fname: record.GetFname(), Content: record.fitToLogicalSize(content, validDataLength), Id: int(record.Entry),
+		Paths: record.GetHardLinkPaths()}
+}
 
-		offset := partitionOffset // partition in bytes
+// reads the clusters of the extents of a stream up to its size, sparse runs read as zeros
+func readExtents(hD img.DiskReader, partitionOffset int64, clusterSizeB int64, extents []MFTAttributes.AttributeHeader, size int64) []byte {
+	p := message.NewPrinter(language.Greek)
 
-		diskSize := hD.GetDiskSize()
+	var buf bytes.Buffer
 
-		for (MFTAttributes.RunList{}) != runlist {
+	buf.Grow(int(size))
 
-			offset += runlist.Offset * int64(sectorsPerCluster*bytesPerSector)
-			if offset > diskSize {
-				msg := fmt.Sprintf("skipped offset %d exceeds disk size! exiting", offset)
-				logger.MFTExtractorlogger.Warning(msg)
+	diskSize := hD.GetDiskSize()
+
+	for _, extent := range extents { // each extent runlist starts from cluster 0
+		runlist := *extent.ATRrecordNoNResident.RunList
+
+		// keep extent at its VCN position when previous extents are missing
+		startB := int64(extent.ATRrecordNoNResident.StartVcn) * clusterSizeB
+		if startB > int64(buf.Len()) && startB <= size {
+			buf.Write(make([]byte, startB-int64(buf.Len())))
+		}
+
+		offset := partitionOffset // partition in bytes
+
+		for (MFTAttributes.RunList{}) != runlist {
+			remainingB := size - int64(buf.Len())
+			if remainingB <= 0 {
 				break
 			}
-			res := p.Sprintf("%d", (offset-partitionOffset)/int64(sectorsPerCluster*bytesPerSector))
 
-			msg := fmt.Sprintf("offset %s cl len %d cl.", res, runlist.Length)
-			logger.MFTExtractorlogger.Info(msg)
-			if runlist.Offset != 0 && runlist.Length > 0 {
-				dataFragments <- hD.ReadFile(offset, int(runlist.Length)*sectorsPerCluster*bytesPerSector)
+			lengthB := int64(runlist.Length) * clusterSizeB
+			if runlist.IsSparse() {
+				// no need to allocate beyond the logical size
+				if lengthB > remainingB {
+					lengthB = remainingB
+				}
+				buf.Write(make([]byte, lengthB))
+
+				msg := fmt.Sprintf("sparse cl len %d cl.", runlist.Length)
+				logger.MFTExtractorlogger.Info(msg)
+
+			} else {
+				offset += runlist.Offset * clusterSizeB
+				if offset > diskSize {
+					msg := fmt.Sprintf("skipped offset %d exceeds disk size! exiting", offset)
+					logger.MFTExtractorlogger.Warning(msg)
+					break
+				}
+
+				buf.Write(hD.ReadFile(offset, int(lengthB)))
+				res := p.Sprintf("%d", (offset-partitionOffset)/clusterSizeB)
+
+				msg := fmt.Sprintf("offset %s cl len %d cl.", res, runlist.Length)
+				logger.MFTExtractorlogger.Info(msg)
 			}
 
 			if runlist.Next == nil {
@@ -192,61 +295,250 @@ func (record Record) LocateDataAsync(hD img.DiskReader, partitionOffset int64, s
 			}
 
 			runlist = *runlist.Next
-			writeOffset += int(runlist.Length) * sectorsPerCluster * bytesPerSector
 		}
-
 	}
+	return buf.Bytes()
+}
 
+// content of a named data stream either resident or at its extents
+func (record Record) ReadStream(hD img.DiskReader, partitionOffset int64, clusterSizeB int64, streamName string) []byte {
+	attr := record.findStream(streamName)
+	if attr != nil && !attr.IsNoNResident() {
+		return attr.(*MFTAttributes.DATA).Content
+	}
+	extents := record.GetStreamExtents(streamName)
+	if len(extents) == 0 {
+		msg := fmt.Sprintf("record %d %s stream not found.", record.Entry, streamName)
+		logger.MFTExtractorlogger.Warning(msg)
+		return nil
+	}
+	streamSize := int64(extents[0].ATRrecordNoNResident.ActualLength)
+	return readExtents(hD, partitionOffset, clusterSizeB, extents, streamSize)
 }
 
-func (record Record) LocateData(hD img.DiskReader, partitionOffset int64, sectorsPerCluster int, bytesPerSector int, results chan<- utils.AskedFile) {
-	p := message.NewPrinter(language.Greek)
+// sends the allocated parts of a stream, sparse runs are skipped without reading
+func (record Record) LocateStreamFragments(hD img.DiskReader, partitionOffset int64, clusterSizeB int64, streamName string,
+	fragments chan<- Fragment) {
+	attr := record.findStream(streamName)
+	if attr != nil && !attr.IsNoNResident() {
+		fragments <- Fragment{Offset: 0, Data: attr.(*MFTAttributes.DATA).Content}
+		return
+	}
+	extents := record.GetStreamExtents(streamName)
+	if len(extents) == 0 {
+		msg := fmt.Sprintf("record %d %s stream not found.", record.Entry, streamName)
+		logger.MFTExtractorlogger.Warning(msg)
+		return
+	}
+	streamSize := int64(extents[0].ATRrecordNoNResident.ActualLength)
+	diskSize := hD.GetDiskSize()
 
-	writeOffset := 0
+	for _, extent := range extents {
+		logicalOffset := int64(extent.ATRrecordNoNResident.StartVcn) * clusterSizeB
+		runlist := *extent.ATRrecordNoNResident.RunList
+		offset := partitionOffset
 
-	var buf bytes.Buffer
+		for (MFTAttributes.RunList{}) != runlist {
+			lengthB := int64(runlist.Length) * clusterSizeB
+			if runlist.IsSparse() {
+				msg := fmt.Sprintf("skipped sparse cl len %d cl.", runlist.Length)
+				logger.MFTExtractorlogger.Info(msg)
+			} else {
+				offset += runlist.Offset * clusterSizeB
+				if offset > diskSize {
+					msg := fmt.Sprintf("skipped offset %d exceeds disk size! exiting", offset)
+					logger.MFTExtractorlogger.Warning(msg)
+					break
+				}
+				for readB := int64(0); readB < lengthB && logicalOffset+readB < streamSize; readB += FragmentSize {
+					chunkB := lengthB - readB
+					if chunkB > FragmentSize {
+						chunkB = FragmentSize
+					}
+					if logicalOffset+readB+chunkB > streamSize {
+						chunkB = streamSize - logicalOffset - readB
+					}
+					fragments <- Fragment{Offset: logicalOffset + readB, Data: hD.ReadFile(offset+readB, int(chunkB))}
+				}
+			}
+			logicalOffset += lengthB
 
-	buf.Grow(int(record.GetLogicalFileSize()))
+			if runlist.Next == nil {
+				break
+			}
+			runlist = *runlist.Next
+		}
+	}
+}
 
-	if record.HasResidentDataAttr() {
-		buf.Write(record.GetResidentData())
+// WOF compressed files keep their content in the WofCompressedData stream
+func (record Record) locateWofData(hD img.DiskReader, partitionOffset int64, clusterSizeB int64) []byte {
+	wofInfo := record.GetReparse().WofInfo
+	if MFTAttributes.WofProviders[wofInfo.Provider] != "FILE" {
+		msg := fmt.Sprintf("record %d WOF provider %s is not supported, backing file is outside the volume.",
+			record.Entry, MFTAttributes.WofProviders[wofInfo.Provider])
+		logger.MFTExtractorlogger.Warning(msg)
+		return nil
+	}
 
-	} else {
-		var runlist MFTAttributes.RunList
+	compressed := record.ReadStream(hD, partitionOffset, clusterSizeB, "WofCompressedData")
+	if compressed == nil {
+		return nil
+	}
 
-		runlist = record.GetRunList("DATA")
+	msg := fmt.Sprintf("record %d decompressing WOF %s stream of %d bytes.",
+		record.Entry, MFTAttributes.WofAlgorithms[wofInfo.Algorithm], len(compressed))
+	logger.MFTExtractorlogger.Info(msg)
 
-		offset := partitionOffset // partition in bytes
+	decompressed, err := wof.Decompress(compressed, wofInfo.Algorithm, record.GetLogicalFileSize())
+	if err != nil {
+		logger.MFTExtractorlogger.Error(fmt.Sprintf("record %d %s", record.Entry, err))
+	}
+	return decompressed
+}
 
-		diskSize := hD.GetDiskSize()
+func (record Record) IsWofCompressed() bool {
+	reparse := record.GetReparse()
+	return reparse != nil && reparse.WofInfo != nil
+}
 
-		for (MFTAttributes.RunList{}) != runlist {
-			offset += runlist.Offset * int64(sectorsPerCluster*bytesPerSector)
-			if offset > diskSize {
-				msg := fmt.Sprintf("skipped offset %d exceeds disk size! exiting", offset)
-				logger.MFTExtractorlogger.Warning(msg)
-				break
-			}
+func (record Record) GetReparse() *MFTAttributes.Reparse {
+	attr := record.FindAttribute("Reparse Point")
+	if attr == nil {
+		return nil
+	}
+	return attr.(*MFTAttributes.Reparse)
+}
 
-			if runlist.Offset != 0 && runlist.Length > 0 {
-				buf.Write(hD.ReadFile(offset, int(runlist.Length)*sectorsPerCluster*bytesPerSector))
-				res := p.Sprintf("%d", (offset-partitionOffset)/int64(sectorsPerCluster*bytesPerSector))
+func (record Record) IsLink() bool {
+	reparse := record.GetReparse()
+	return reparse != nil && reparse.IsLink()
+}
 
-				msg := fmt.Sprintf("offset %s cl len %d cl.", res, runlist.Length)
-				logger.MFTExtractorlogger.Info(msg)
-			}
+func (record Record) ShowReparse() {
+	reparse := record.GetReparse()
+	if reparse == nil {
+		return
+	}
+	fmt.Printf("%d %s ", record.Entry, record.GetFname())
+	reparse.ShowInfo()
+	if record.LinkTarget != nil {
+		fmt.Printf("\tresolved to %d %s\n", record.LinkTarget.Entry, filepath.Join(record.LinkTarget.GetFullPath(),
+			record.LinkTarget.GetFname()))
+	}
+}
 
-			if runlist.Next == nil {
-				break
-			}
+// inline security descriptor takes precedence over the one shared in $Secure
+func (record Record) GetSecurityDescriptor() *MFTAttributes.SecurityDescriptor {
+	attr := record.FindAttribute("Security Descriptor")
+	if attr != nil {
+		return attr.(*MFTAttributes.SecurityDescriptor)
+	}
+	return record.SecurityDescriptor
+}
 
-			runlist = *runlist.Next
-			writeOffset += int(runlist.Length) * sectorsPerCluster * bytesPerSector
+func (record Record) GetSecurityID() uint32 {
+	attr := record.FindAttribute("Standard Information")
+	if attr == nil {
+		return 0
+	}
+	return attr.(*MFTAttributes.SIAttribute).SecID
+}
+
+func (record Record) HasOwnerSID(sid string) bool {
+	secDescriptor := record.GetSecurityDescriptor()
+	return secDescriptor != nil && secDescriptor.OwnerSID == sid
+}
+
+// $EFS stream is authoritative, the Encrypted flag of the standard information is its hint
+func (record Record) IsEncrypted() bool {
+	if record.GetEFS() != nil {
+		return true
+	}
+	attr := record.FindAttribute("Standard Information")
+	return attr != nil && attr.(*MFTAttributes.SIAttribute).Dos&16384 != 0
+}
+
+func (record Record) GetEFS() *MFTAttributes.EFS {
+	for _, attribute := range record.Attributes {
+		loggedUtility, ok := attribute.(*MFTAttributes.LoggedUtilityStream)
+		if ok && loggedUtility.EFS != nil {
+			return loggedUtility.EFS
 		}
+	}
+	return nil
+}
+
+func (record Record) ShowEFS() {
+	if !record.IsEncrypted() {
+		return
+	}
+	efs := record.GetEFS()
+	if efs == nil {
+		fmt.Printf("%d %s encrypted, $EFS stream not found\n", record.Entry, record.GetFname())
+		return
+	}
+	fmt.Printf("%d %s encrypted, users %d recovery agents %d\n", record.Entry, record.GetFname(),
+		len(efs.DDFs), len(efs.DRFs))
+	efs.ShowInfo()
+}
 
+func (record Record) GetWSLMetadata() *MFTAttributes.WSLMetadata {
+	attr := record.FindAttribute("Extended Attribute")
+	if attr == nil {
+		return nil
 	}
+	return attr.(*MFTAttributes.ExtendedAttribute).GetWSLMetadata()
+}
 
-	results <- utils.AskedFile{Fname: record.GetFname(), Content: buf.Bytes(), Id: int(record.Entry)}
+// -1 matches any id
+func (record Record) HasPOSIXOwner(uid int, gid int) bool {
+	wsl := record.GetWSLMetadata()
+	if wsl == nil {
+		return false
+	}
+	if uid != -1 && (wsl.UID == nil || int(*wsl.UID) != uid) {
+		return false
+	}
+	return gid == -1 || wsl.GID != nil && int(*wsl.GID) == gid
+}
+
+func (record Record) ShowWSL() {
+	wsl := record.GetWSLMetadata()
+	if wsl == nil {
+		return
+	}
+	fmt.Printf("%d %s WSL %s\n", record.Entry, record.GetFname(), wsl.GetInfo())
+}
+
+func (record Record) ShowSecurity() {
+	secDescriptor := record.GetSecurityDescriptor()
+	if secDescriptor == nil {
+		fmt.Printf("%d %s security id %d no security descriptor\n", record.Entry, record.GetFname(), record.GetSecurityID())
+		return
+	}
+	fmt.Printf("%d %s security id %d ", record.Entry, record.GetFname(), record.GetSecurityID())
+	secDescriptor.ShowInfo()
+}
+
+// truncates or zero pads content to the logical size, area beyond valid data length is zeroed
+func (record Record) fitToLogicalSize(content []byte, validDataLength int64) []byte {
+	logicalSize := record.GetLogicalFileSize()
+	if int64(len(content)) > logicalSize {
+		content = content[:logicalSize]
+	} else if int64(len(content)) < logicalSize {
+		msg := fmt.Sprintf("record %d data %d less than logical size %d, zero padding.",
+			record.Entry, len(content), logicalSize)
+		logger.MFTExtractorlogger.Warning(msg)
+		content = append(content, make([]byte, logicalSize-int64(len(content)))...)
+	}
+
+	if validDataLength < logicalSize {
+		for idx := validDataLength; idx < logicalSize; idx++ {
+			content[idx] = 0
+		}
+	}
+	return content
 }
 
 func (records Records) FilterDeleted(includeDeleted bool) []Record {
@@ -349,6 +641,69 @@ func (record Record) GetRunLists() []MFTAttributes.RunList {
 	return runlists
 }
 
+// headers of the unnamed non resident DATA attribute extents including those in linked records ordered by start VCN
+func (record Record) GetDataExtents() []MFTAttributes.AttributeHeader {
+	return record.GetStreamExtents("")
+}
+
+func (record Record) GetStreamExtents(streamName string) []MFTAttributes.AttributeHeader {
+	var extents []MFTAttributes.AttributeHeader
+	records := []*Record{&record}
+	records = append(records, record.LinkedRecords...)
+
+	for _, record := range records {
+		for _, attribute := range record.Attributes {
+			header := attribute.GetHeader()
+			if attribute.FindType() != "DATA" || !header.IsNoNResident() || header.GetName() != streamName ||
+				header.ATRrecordNoNResident.RunList == nil {
+				continue
+			}
+			extents = append(extents, header)
+		}
+	}
+
+	sort.Slice(extents, func(i, j int) bool {
+		return extents[i].ATRrecordNoNResident.StartVcn < extents[j].ATRrecordNoNResident.StartVcn
+	})
+	return extents
+}
+
+// named DATA attribute searched also in linked records
+func (record Record) findNamedAttribute(attrType string, name string) Attribute {
+	for _, attribute := range record.Attributes {
+		if attribute.FindType() == attrType && attribute.GetHeader().GetName() == name {
+			return attribute
+		}
+	}
+	return nil
+}
+
+func (record Record) findStream(streamName string) Attribute {
+	records := []*Record{&record}
+	records = append(records, record.LinkedRecords...)
+
+	for _, record := range records {
+		for _, attribute := range record.Attributes {
+			if attribute.FindType() == "DATA" && attribute.GetHeader().GetName() == streamName {
+				return attribute
+			}
+		}
+	}
+	return nil
+}
+
+// initialized size of the DATA attribute, beyond it the stream reads as zeros
+func (record Record) GetValidDataLength() int64 {
+	if record.OriginLinkedRecord != nil {
+		return record.OriginLinkedRecord.GetValidDataLength()
+	}
+	extents := record.GetDataExtents()
+	if len(extents) == 0 || extents[0].ATRrecordNoNResident.StartVcn != 0 {
+		return record.GetLogicalFileSize()
+	}
+	return int64(extents[0].ATRrecordNoNResident.InitLength)
+}
+
 func (record Record) GetFullPath() string {
 	fullpathArr := []string{}
 
@@ -363,6 +718,38 @@ func (record Record) GetFullPath() string {
 	return filepath.Join(fullpathArr...)
 }
 
+// directory path of the hard link, empty for the root
+func (hardLink HardLink) GetDirPath() string {
+	if hardLink.Parent.Entry == 5 {
+		return ""
+	}
+	return filepath.Join(hardLink.Parent.GetFullPath(), hardLink.Parent.GetFname())
+}
+
+// directory paths of every hard link of the record
+func (record Record) GetFullPaths() []string {
+	if len(record.HardLinks) == 0 {
+		return []string{record.GetFullPath()}
+	}
+	fullpaths := make([]string, len(record.HardLinks))
+	for idx, hardLink := range record.HardLinks {
+		fullpaths[idx] = hardLink.GetDirPath()
+	}
+	return fullpaths
+}
+
+// paths including the name of every hard link of the record
+func (record Record) GetHardLinkPaths() []string {
+	if len(record.HardLinks) == 0 {
+		return []string{filepath.Join(record.GetFullPath(), record.GetFname())}
+	}
+	linkPaths := make([]string, len(record.HardLinks))
+	for idx, hardLink := range record.HardLinks {
+		linkPaths[idx] = filepath.Join(hardLink.GetDirPath(), hardLink.Fname)
+	}
+	return linkPaths
+}
+
 func (record Record) ShowVCNs() {
 	startVCN, lastVCN := record.getVCNs()
 	if startVCN != 0 || lastVCN != 0 {
@@ -383,9 +770,27 @@ func (record Record) ShowParentRecordInfo() {
 
 }
 
+// directory paths of the record when reached through symbolic links or junctions of its ancestors
+func (record Record) GetLinkPaths() []string {
+	var linkPaths []string
+	var suffix []string
+
+	parent := record.Parent
+	for parent != nil && parent.Entry != 5 {
+		for _, linkSource := range parent.LinkSources {
+			linkPath := append([]string{linkSource.GetFullPath(), linkSource.GetFname()}, suffix...)
+			linkPaths = append(linkPaths, filepath.Join(linkPath...))
+		}
+		suffix = append([]string{parent.GetFname()}, suffix...)
+		parent = parent.Parent
+	}
+	return linkPaths
+}
+
 func (record Record) ShowPath(partitionId int) {
-	fullpath := record.GetFullPath()
-	fmt.Printf("\\Partition%d\\%s\\%s ", partitionId, fullpath, record.GetFname())
+	for _, linkPath := range record.GetHardLinkPaths() {
+		fmt.Printf("\\Partition%d\\%s ", partitionId, linkPath)
+	}
 }
 
 func (record Record) ShowIndex() {
@@ -406,6 +811,85 @@ func (record Record) ShowIndex() {
 
 }
 
+// live entries of the $I30 index root and allocation
+func (record Record) GetIndexEntries() MFTAttributes.IndexEntries {
+	var idxEntries MFTAttributes.IndexEntries
+	indexAttr := record.FindAttribute("Index Root")
+	if indexAttr != nil {
+		idxEntries = append(idxEntries, indexAttr.(*MFTAttributes.IndexRoot).IndexEntries...)
+	}
+	indexAlloc := record.FindAttribute("Index Allocation")
+	if indexAlloc != nil {
+		idxEntries = append(idxEntries, indexAlloc.(*MFTAttributes.IndexAllocation).IndexEntries...)
+	}
+	return idxEntries
+}
+
+// free index buffers are marked by the bitmap named after the index e.g. $I30 or $O
+func (record *Record) ApplyIndexBitmap() {
+	for _, attribute := range record.Attributes {
+		if attribute.FindType() != "Index Allocation" {
+			continue
+		}
+		bitmap := record.findNamedAttribute("BitMap", attribute.GetHeader().GetName())
+		if bitmap == nil {
+			continue
+		}
+		attribute.(*MFTAttributes.IndexAllocation).ApplyBitmap(bitmap.(*MFTAttributes.BitMap).AllocationStatus)
+	}
+}
+
+// entries of the $I30 B+tree in collation order starting from the index root
+func (record Record) GetDirectoryListing() MFTAttributes.IndexEntries {
+	indexAttr := record.findNamedAttribute("Index Root", "$I30")
+	if indexAttr == nil {
+		return nil
+	}
+	var idxAllocation *MFTAttributes.IndexAllocation
+	indexAlloc := record.findNamedAttribute("Index Allocation", "$I30")
+	if indexAlloc != nil {
+		idxAllocation = indexAlloc.(*MFTAttributes.IndexAllocation)
+	}
+	return indexAttr.(*MFTAttributes.IndexRoot).Walk(idxAllocation)
+}
+
+func (record Record) ShowDirectoryListing() {
+	if !record.IsFolder() {
+		return
+	}
+	idxEntries := record.GetDirectoryListing()
+	fmt.Printf("%d %s directory entries %d\n", record.Entry, record.GetFname(), len(idxEntries))
+	for _, idxEntry := range idxEntries {
+		idxEntry.ShowInfo()
+	}
+}
+
+// entries of deleted files carved from the slack of the index buffers
+func (record Record) GetIndexSlackEntries() MFTAttributes.IndexEntries {
+	indexAlloc := record.FindAttribute("Index Allocation")
+	if indexAlloc == nil {
+		return nil
+	}
+	slackEntries := indexAlloc.(*MFTAttributes.IndexAllocation).SlackEntries
+	return slackEntries.GetDeleted(record.GetIndexEntries(), uint64(record.Entry))
+}
+
+func (record Record) ShowIndexSlack() {
+	slackEntries := record.GetIndexSlackEntries()
+	if len(slackEntries) == 0 {
+		return
+	}
+	idxEntries := record.GetIndexEntries()
+	fmt.Printf("%d %s live entries %d slack entries %d\n", record.Entry, record.GetFname(),
+		len(idxEntries), len(slackEntries))
+	for _, idxEntry := range idxEntries {
+		idxEntry.ShowInfo()
+	}
+	for _, slackEntry := range slackEntries {
+		slackEntry.ShowSlackInfo()
+	}
+}
+
 func (record Record) getVCNs() (uint64, uint64) {
 	for _, attribute := range record.Attributes {
 		if attribute.IsNoNResident() {
@@ -476,8 +960,12 @@ func (record Record) ShowRunList() {
 		totalClusters := 0
 		for (MFTAttributes.RunList{}) != runlist {
 
-			fmt.Printf(" offs. %d cl len %d cl  logical offset %d cl clusters %d \n",
-				runlist.Offset, runlist.Length, logicalOffset, totalClusters)
+			if runlist.IsSparse() {
+				fmt.Printf(" sparse cl len %d cl clusters %d \n", runlist.Length, totalClusters)
+			} else {
+				fmt.Printf(" offs. %d cl len %d cl  logical offset %d cl clusters %d \n",
+					runlist.Offset, runlist.Length, logicalOffset, totalClusters)
+			}
 			if runlist.Next == nil {
 				break
 			}
@@ -492,26 +980,34 @@ func (record Record) ShowRunList() {
 
 }
 
-func (record Record) HasFilenameExtension(extension string) bool {
+// names are compared case insensitively by $UpCase unless exact
+func (record Record) matchesName(name string, other string, exact bool) bool {
+	if exact {
+		return name == other
+	}
+	return record.getUpCase().Equal(name, other)
+}
+
+func (record Record) HasFilenameExtension(extension string, exact bool) bool {
 	if record.HasAttr("FileName") {
 		fnattr := record.FindAttribute("FileName").(*MFTAttributes.FNAttribute)
-		if strings.HasSuffix(fnattr.Fname, strings.ToUpper("."+extension)) ||
-			strings.HasSuffix(fnattr.Fname, strings.ToLower("."+extension)) {
-			return true
+		if exact {
+			return strings.HasSuffix(fnattr.Fname, "."+extension)
 		}
+		return record.getUpCase().HasSuffix(fnattr.Fname, "."+extension)
 	}
 
 	return false
 }
 
-func (record Record) HasFilename(filename string) bool {
-	return record.GetFname() == filename
+func (record Record) HasFilename(filename string, exact bool) bool {
+	return record.matchesName(record.GetFname(), filename, exact)
 
 }
 
-func (record Record) HasFilenames(filenames []string) bool {
+func (record Record) HasFilenames(filenames []string, exact bool) bool {
 	for _, filename := range filenames {
-		if record.HasFilename(filename) {
+		if record.HasFilename(filename, exact) {
 			return true
 		}
 	}
@@ -519,8 +1015,20 @@ func (record Record) HasFilenames(filenames []string) bool {
 
 }
 
-func (record Record) HasPath(filespath string) bool {
-	return record.GetFullPath() == filespath
+func (record Record) HasPath(filespath string, followLinks bool, exact bool) bool {
+	for _, fullpath := range record.GetFullPaths() {
+		if record.matchesName(fullpath, filespath, exact) {
+			return true
+		}
+	}
+	if followLinks {
+		for _, linkPath := range record.GetLinkPaths() {
+			if record.matchesName(linkPath, filespath, exact) {
+				return true
+			}
+		}
+	}
+	return false
 
 }
 
@@ -691,6 +1199,9 @@ func (record *Record) Process(bs []byte) error {
 			} else if attrHeader.IsExtendedInformationAttribute() {
 				attr = &MFTAttributes.EA_INFORMATION{}
 				attr.Parse(bs[attrStartOffset:attrEndOffset])
+			} else if attrHeader.IsSecurityDescriptor() {
+				attr = &MFTAttributes.SecurityDescriptor{}
+				attr.Parse(bs[attrStartOffset:attrEndOffset])
 			} else {
 				msg := fmt.Sprintf("uknown resident attribute %s at record %d",
 					attrHeader.GetType(), record.Entry)
@@ -705,6 +1216,15 @@ func (record *Record) Process(bs []byte) error {
 		} else { //NoN Resident Attribute
 			var atrNoNRecordResident *MFTAttributes.ATRrecordNoNResident = new(MFTAttributes.ATRrecordNoNResident)
 			utils.Unmarshal(bs[ReadPtr+16:ReadPtr+64], atrNoNRecordResident)
+			nameStart := int(ReadPtr) + int(attrHeader.NameOff)
+			nameEnd := nameStart + 2*int(attrHeader.Nlen)
+			if nameEnd <= len(bs) {
+				atrNoNRecordResident.Name = utils.DecodeUTF16(bs[nameStart:nameEnd])
+			} else {
+				msg := fmt.Sprintf("attribute name %s at record %d exceeded buffer by %d",
+					attrHeader.GetType(), record.Entry, nameEnd-len(bs))
+				logger.MFTExtractorlogger.Warning(msg)
+			}
 
 			if int(ReadPtr+atrNoNRecordResident.RunOff+attrHeader.AttrLen) < len(bs) {
 				var runlist *MFTAttributes.RunList = new(MFTAttributes.RunList)
@@ -742,6 +1262,18 @@ func (record *Record) Process(bs []byte) error {
 				var reparse *MFTAttributes.Reparse = new(MFTAttributes.Reparse)
 				reparse.SetHeader(&attrHeader)
 				attributes = append(attributes, reparse)
+			} else if attrHeader.IsSecurityDescriptor() {
+				var secDescriptor *MFTAttributes.SecurityDescriptor = new(MFTAttributes.SecurityDescriptor)
+				secDescriptor.SetHeader(&attrHeader)
+				attributes = append(attributes, secDescriptor)
+			} else if attrHeader.IsLoggedUtility() {
+				var loggedUtility *MFTAttributes.LoggedUtilityStream = &MFTAttributes.LoggedUtilityStream{Kind: attrHeader.GetName()}
+				loggedUtility.SetHeader(&attrHeader)
+				attributes = append(attributes, loggedUtility)
+			} else if attrHeader.IsExtendedAttribute() {
+				var ea *MFTAttributes.ExtendedAttribute = new(MFTAttributes.ExtendedAttribute)
+				ea.SetHeader(&attrHeader)
+				attributes = append(attributes, ea)
 			} else {
 				msg := fmt.Sprintf("unknown non resident attr %s", attrHeader.GetType())
 				logger.MFTExtractorlogger.Warning(msg)
@@ -774,6 +1306,14 @@ func (record Record) GetLogicalFileSize() int64 {
 	if record.OriginLinkedRecord != nil {
 		return record.OriginLinkedRecord.GetLogicalFileSize()
 	}
+	//DATA attribute is authoritative, FileName size is updated lazily
+	if record.HasResidentDataAttr() {
+		return int64(len(record.GetResidentData()))
+	}
+	extents := record.GetDataExtents()
+	if len(extents) > 0 && extents[0].ATRrecordNoNResident.StartVcn == 0 {
+		return int64(extents[0].ATRrecordNoNResident.ActualLength)
+	}
 	attr := record.FindAttribute("FileName")
 	if attr != nil {
 		fnattr := attr.(*MFTAttributes.FNAttribute)
@@ -828,39 +1368,57 @@ func (record Record) ShowFileName(fileNameSyntax string) {
 	}
 }
 
-func (records Records) FilterByExtension(extension string) []Record {
+func (records Records) FilterByExtension(extension string, exact bool) []Record {
 
 	return utils.Filter(records, func(record Record) bool {
-		return record.HasFilenameExtension(extension)
+		return record.HasFilenameExtension(extension, exact)
 	})
 
 }
 
-func (records Records) FilterByExtensions(extensions []string) []Record {
+func (records Records) FilterByExtensions(extensions []string, exact bool) []Record {
 	var filteredRecords []Record
 	for _, extension := range extensions {
-		filteredRecords = append(filteredRecords, records.FilterByExtension(extension)...)
+		filteredRecords = append(filteredRecords, records.FilterByExtension(extension, exact)...)
 	}
 	return filteredRecords
 }
 
-func (records Records) FilterByNames(filenames []string) []Record {
+func (records Records) FilterByNames(filenames []string, exact bool) []Record {
+
+	return utils.Filter(records, func(record Record) bool {
+		return record.HasFilenames(filenames, exact)
+	})
+
+}
+
+func (records Records) FilterByPath(filespath string, followLinks bool, exact bool) []Record {
+	return utils.Filter(records, func(record Record) bool {
+		return record.HasPath(filespath, followLinks, exact)
+	})
+}
 
+func (records Records) FilterByPOSIXOwner(uid int, gid int) []Record {
 	return utils.Filter(records, func(record Record) bool {
-		return record.HasFilenames(filenames)
+		return record.HasPOSIXOwner(uid, gid)
 	})
+}
 
+func (records Records) FilterByObjectID(guid string) []Record {
+	return utils.Filter(records, func(record Record) bool {
+		return record.HasObjectID(guid)
+	})
 }
 
-func (records Records) FilterByPath(filespath string) []Record {
+func (records Records) FilterByOwnerSID(sid string) []Record {
 	return utils.Filter(records, func(record Record) bool {
-		return record.HasPath(filespath)
+		return record.HasOwnerSID(sid)
 	})
 }
 
-func (records Records) FilterByName(filename string) []Record {
+func (records Records) FilterByName(filename string, exact bool) []Record {
 	return utils.Filter(records, func(record Record) bool {
-		return record.HasFilename(filename)
+		return record.HasFilename(filename, exact)
 	})
 
 }
@@ -871,10 +1429,10 @@ func (records Records) FilterOrphans() []Record {
 	})
 }
 
-func (records Records) FilterByPrefixSuffix(prefix string, suffix string) []Record {
+func (records Records) FilterByPrefixSuffix(prefix string, suffix string, exact bool) []Record {
 
 	return utils.Filter(records, func(record Record) bool {
-		return record.HasPrefix(prefix) && record.HasSuffix(suffix)
+		return record.HasPrefix(prefix, exact) && record.HasSuffix(suffix, exact)
 	})
 
 }
@@ -894,12 +1452,19 @@ func (records Records) GetParent(record Record) (Record, error) {
 
 }
 
-func (record Record) HasPrefix(prefix string) bool {
+func (record Record) HasPrefix(prefix string, exact bool) bool {
 	record_name := record.GetFname()
-	return strings.HasPrefix(record_name, prefix)
+	if exact {
+		return strings.HasPrefix(record_name, prefix)
+	}
+	upcase := record.getUpCase()
+	return strings.HasPrefix(upcase.ToUpper(record_name), upcase.ToUpper(prefix))
 }
 
-func (record Record) HasSuffix(suffix string) bool {
+func (record Record) HasSuffix(suffix string, exact bool) bool {
 	record_name := record.GetFname()
-	return strings.HasSuffix(record_name, suffix)
+	if exact {
+		return strings.HasSuffix(record_name, suffix)
+	}
+	return record.getUpCase().HasSuffix(record_name, suffix)
 }
@@ -3,6 +3,8 @@ package MFT
 import (
 	"errors"
 	"fmt"
+	"path/filepath"
+	"strings"
 
 	MFTAttributes "github.com/aarsakian/FileSystemForensics/FS/NTFS/MFT/attributes"
 	"github.com/aarsakian/FileSystemForensics/img"
@@ -83,28 +85,158 @@ func (mfttable *MFTTable) CreateLinkedRecords() {
 	}
 }
 
+// every $FILE_NAME, including those of linked records, contributes a hard link, Dos names sharing a directory with a Win32 name are skipped
 func (mfttable *MFTTable) FindParentRecords() {
 
 	for idx := range mfttable.Records {
-		attr := mfttable.Records[idx].FindAttribute("FileName")
-		if attr == nil {
+		attributes := append([]Attribute{}, mfttable.Records[idx].Attributes...)
+		for _, linkedRecord := range mfttable.Records[idx].LinkedRecords { // names exceeding the base record
+			attributes = append(attributes, linkedRecord.Attributes...)
+		}
+		fnAttributes := utils.Filter(attributes, func(attribute Attribute) bool {
+			return attribute.FindType() == "FileName"
+		})
+		if len(fnAttributes) == 0 {
 			//logger.MFTExtractorlogger.Warning(fmt.Sprintf("No FileName attribute found at record %d ", mfttable.Records[idx].Entry))
 			continue
 
 		}
-		fnattr := attr.(*MFTAttributes.FNAttribute)
-		parentRecord, err := mfttable.GetRecord(uint32(fnattr.ParRef), fnattr.ParSeq)
 
-		if err != nil {
+		win32Parents := map[uint64]bool{} // Dos names pair with the Win32 name of the same directory
+		for _, attr := range fnAttributes {
+			fnattr := attr.(*MFTAttributes.FNAttribute)
+			if fnattr.GetFileNameType() == "Win32" {
+				win32Parents[fnattr.ParRef] = true
+			}
+		}
+
+		for _, attr := range fnAttributes {
+			fnattr := attr.(*MFTAttributes.FNAttribute)
+			if fnattr.GetFileNameType() == "Dos" && win32Parents[fnattr.ParRef] {
+				continue
+			}
+			parentRecord, err := mfttable.GetRecord(uint32(fnattr.ParRef), fnattr.ParSeq)
+
+			if err != nil {
+				continue
+			}
+
+			mfttable.Records[idx].HardLinks = append(mfttable.Records[idx].HardLinks,
+				HardLink{Parent: parentRecord, Fname: fnattr.Fname})
+		}
+		if len(mfttable.Records[idx].HardLinks) == 0 {
 			continue
 		}
 
+		parentRecord := mfttable.Records[idx].HardLinks[0].Parent
 		logger.MFTExtractorlogger.Info(fmt.Sprintf("update record %d with parent %d", mfttable.Records[idx].Entry, parentRecord.Entry))
 		mfttable.Records[idx].Parent = parentRecord
 
 	}
 }
 
+// links symbolic links and junctions to their targets within the volume
+func (mfttable *MFTTable) ResolveLinks() {
+	paths := map[string]*Record{}
+	for idx := range mfttable.Records {
+		if mfttable.Records[idx].IsDeleted() {
+			continue
+		}
+		fullpath := filepath.Join(mfttable.Records[idx].GetFullPath(), mfttable.Records[idx].GetFname())
+		paths[strings.ToLower(fullpath)] = &mfttable.Records[idx]
+	}
+
+	for idx := range mfttable.Records {
+		if !mfttable.Records[idx].IsLink() || mfttable.Records[idx].IsDeleted() {
+			continue
+		}
+		reparse := mfttable.Records[idx].GetReparse()
+		target := reparse.GetVolumeTarget()
+		if target == "" {
+			msg := fmt.Sprintf("record %d link target %s outside volume", mfttable.Records[idx].Entry, reparse.Name)
+			logger.MFTExtractorlogger.Info(msg)
+			continue
+		}
+
+		targetpath := filepath.Join(strings.Split(target, "\\")...)
+		if reparse.IsRelative() {
+			targetpath = filepath.Join(mfttable.Records[idx].GetFullPath(), targetpath)
+		}
+
+		targetRecord, ok := paths[strings.ToLower(targetpath)]
+		if !ok {
+			msg := fmt.Sprintf("record %d link target %s not found", mfttable.Records[idx].Entry, reparse.Name)
+			logger.MFTExtractorlogger.Warning(msg)
+			continue
+		}
+
+		logger.MFTExtractorlogger.Info(fmt.Sprintf("linked record %d to target %d", mfttable.Records[idx].Entry, targetRecord.Entry))
+		mfttable.Records[idx].LinkTarget = targetRecord
+		targetRecord.LinkSources = append(targetRecord.LinkSources, &mfttable.Records[idx])
+	}
+}
+
+// entries of the $SII index, in the root and in the allocation
+func (record Record) GetSIIEntries() []MFTAttributes.SDSEntryHeader {
+	var idxEntries MFTAttributes.IndexEntries
+	indexAttr := record.findNamedAttribute("Index Root", "$SII")
+	if indexAttr != nil {
+		idxEntries = append(idxEntries, indexAttr.(*MFTAttributes.IndexRoot).IndexEntries...)
+	}
+	indexAlloc := record.findNamedAttribute("Index Allocation", "$SII")
+	if indexAlloc != nil {
+		idxEntries = append(idxEntries, indexAlloc.(*MFTAttributes.IndexAllocation).IndexEntries...)
+	}
+	return MFTAttributes.ParseSIIEntries(idxEntries)
+}
+
+// maps security ids of standard information to the descriptors of $Secure:$SDS located by $SII
+func (mfttable *MFTTable) ResolveSecurityDescriptors(hD img.DiskReader, partitionOffsetB int64, clusterSizeB int64) {
+	secureRecords := utils.Filter(mfttable.Records, func(record Record) bool {
+		return record.Entry == 9 && record.GetFname() == "$Secure"
+	})
+	if len(secureRecords) == 0 {
+		logger.MFTExtractorlogger.Warning("$Secure record not found.")
+		return
+	}
+
+	data := secureRecords[0].ReadStream(hD, partitionOffsetB, clusterSizeB, "$SDS")
+	var secDescriptors map[uint32]*MFTAttributes.SecurityDescriptor
+	siiEntries := secureRecords[0].GetSIIEntries()
+	if len(siiEntries) > 0 {
+		secDescriptors = MFTAttributes.ParseSDSByIndex(data, siiEntries)
+		logger.MFTExtractorlogger.Info(fmt.Sprintf("found %d security descriptors of %d $SII entries in $SDS",
+			len(secDescriptors), len(siiEntries)))
+	} else {
+		secDescriptors = MFTAttributes.ParseSDS(data)
+		logger.MFTExtractorlogger.Warning(fmt.Sprintf("$SII not found, found %d security descriptors by scanning $SDS",
+			len(secDescriptors)))
+	}
+
+	for idx := range mfttable.Records {
+		secID := mfttable.Records[idx].GetSecurityID()
+		if secID == 0 {
+			continue
+		}
+		secDescriptor, ok := secDescriptors[secID]
+		if !ok {
+			msg := fmt.Sprintf("record %d security id %d not found in $SDS", mfttable.Records[idx].Entry, secID)
+			logger.MFTExtractorlogger.Warning(msg)
+			continue
+		}
+		mfttable.Records[idx].SecurityDescriptor = secDescriptor
+	}
+}
+
+// path of a referenced directory including its name
+func (mfttable MFTTable) GetParentPath(referencedEntry uint64, referencedSeq uint16) (string, error) {
+	parentRecord, err := mfttable.GetRecord(uint32(referencedEntry), referencedSeq)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(parentRecord.GetFullPath(), parentRecord.GetFname()), nil
+}
+
 func (mfttable MFTTable) GetRecord(referencedEntry uint32, referencedSeq uint16) (*Record, error) {
 	if int(referencedEntry) < len(mfttable.Records) {
 		if mfttable.Records[referencedEntry].Entry == referencedEntry {
@@ -113,7 +245,7 @@ func (mfttable MFTTable) GetRecord(referencedEntry uint32, referencedSeq uint16)
 				msg := fmt.Sprintf("entry %d has been reallocated with seq %d ref seq %d", mfttable.Records[referencedEntry].Entry,
 					mfttable.Records[referencedEntry].Seq, referencedSeq)
 				logger.MFTExtractorlogger.Warning(msg)
-				return nil, fmt.Errorf("%s", ParentReallocatedError{msg})
+				return nil, &ParentReallocatedError{msg}
 			} else {
 				return &mfttable.Records[referencedEntry], nil
 			}
@@ -121,7 +253,7 @@ func (mfttable MFTTable) GetRecord(referencedEntry uint32, referencedSeq uint16)
 	} else { //brute force seach
 		for idx := range mfttable.Records {
 			if mfttable.Records[idx].Entry == referencedEntry &&
-				mfttable.Records[referencedEntry].Seq == referencedSeq {
+				mfttable.Records[idx].Seq == referencedSeq {
 				return &mfttable.Records[idx], nil
 			}
 		}
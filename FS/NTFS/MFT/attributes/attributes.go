@@ -50,11 +50,13 @@ type ATRrecordNoNResident struct {
 	InitLength        uint64   //56-64
 	RunList           *RunList //holds a linked list of runs
 	RunListTotalLenCl uint64   // total length of runlist
+	Name              string
 }
 
 type RunList struct {
 	Offset int64
 	Length uint64
+	Sparse bool //no clusters allocated, reads as zeros
 	Next   *RunList
 }
 
@@ -127,6 +129,10 @@ func (attrHeader AttributeHeader) IsExtendedAttribute() bool {
 	return attrHeader.GetType() == "Extended Attribute"
 }
 
+func (attrHeader AttributeHeader) IsSecurityDescriptor() bool {
+	return attrHeader.GetType() == "Security Descriptor"
+}
+
 func (attrHeader AttributeHeader) IsExtendedInformationAttribute() bool {
 	return attrHeader.GetType() == "Extended Attribute Information"
 }
@@ -139,10 +145,14 @@ func (attrHeader AttributeHeader) GetName() string {
 	if !attrHeader.IsNoNResident() {
 		return attrHeader.ATRrecordResident.Name
 	} else {
-		return ""
+		return attrHeader.ATRrecordNoNResident.Name
 	}
 }
 
+func (runlist RunList) IsSparse() bool {
+	return runlist.Sparse
+}
+
 func (prevRunlist *RunList) Process(runlists []byte) uint64 {
 	clusterPtr := uint64(0)
 	length := uint64(0)
@@ -157,7 +167,7 @@ func (prevRunlist *RunList) Process(runlists []byte) uint64 {
 			clustersOff := utils.ReadEndianInt(runlists[clusterPtr+1+
 				ClusterLenB : clusterPtr+ClusterLenB+ClusterOffsB+1])
 
-			runlist := RunList{Offset: clustersOff, Length: clustersLen}
+			runlist := RunList{Offset: clustersOff, Length: clustersLen, Sparse: ClusterOffsB == 0}
 
 			length += clustersLen
 
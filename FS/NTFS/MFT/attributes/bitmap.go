@@ -2,6 +2,12 @@ package attributes
 
 import "fmt"
 
+// consecutive clusters sharing the same allocation status
+type ClusterRun struct {
+	Start  int
+	Length int
+}
+
 type BitMap struct {
 	AllocationStatus []byte
 	Header           *AttributeHeader
@@ -63,3 +69,28 @@ func (bitmap BitMap) ShowInfo() {
 
 	}
 }
+
+func (bitmap BitMap) GetUnallocatedRuns() []ClusterRun {
+	var runs []ClusterRun
+	run := ClusterRun{Start: -1}
+	for idx, byteval := range bitmap.AllocationStatus {
+		for shifter := 0; shifter < 8; shifter++ {
+			cluster := idx*8 + shifter
+			if byteval&(1<<shifter) != 0 { // allocated
+				if run.Length > 0 {
+					runs = append(runs, run)
+				}
+				run = ClusterRun{Start: -1}
+				continue
+			}
+			if run.Length == 0 {
+				run.Start = cluster
+			}
+			run.Length++
+		}
+	}
+	if run.Length > 0 {
+		runs = append(runs, run)
+	}
+	return runs
+}
@@ -1,22 +1,57 @@
 package attributes
 
-import "github.com/aarsakian/FileSystemForensics/utils"
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/aarsakian/FileSystemForensics/logger"
+	"github.com/aarsakian/FileSystemForensics/utils"
+)
+
+const EAEntryHeaderSize = 8
+
+// entries required to be understood by the reader
+const EANeedEA = 0x80
+
+// POSIX file types of the mode
+var POSIXFileTypes = map[uint32]string{
+	0140000: "s", 0120000: "l", 0100000: "-", 060000: "b", 040000: "d", 020000: "c", 010000: "p",
+}
 
 type EA_INFORMATION struct {
-	SizeOfEntry uint16
-	NofEA       uint16
-	Size        uint32
+	SizeOfEntry uint16 //packed size of the entries
+	NofEA       uint16 //entries with NEED_EA set
+	Size        uint32 //unpacked size of the entries
 	Header      *AttributeHeader
 }
 
+// chain of entries, each aligned to 4 bytes
 type ExtendedAttribute struct {
-	NextAttrOffset int32
-	Flags          uint8
-	NofChars       uint8
-	DataSize       uint16
-	Name           []byte
-	Value          []byte
-	Header         *AttributeHeader
+	Entries []EAEntry
+	Header  *AttributeHeader
+}
+
+type EAEntry struct {
+	NextEntryOffset uint32
+	Flags           uint8
+	NameLen         uint8
+	ValueLen        uint16
+	Name            string
+	Value           []byte
+}
+
+// POSIX metadata Windows Subsystem for Linux keeps in extended attributes, absent ones are nil
+type WSLMetadata struct {
+	UID    *uint32
+	GID    *uint32
+	Mode   *uint32
+	Device *WSLDevice
+}
+
+type WSLDevice struct {
+	Major uint32
+	Minor uint32
 }
 
 func (ea_info EA_INFORMATION) FindType() string {
@@ -42,7 +77,8 @@ func (ea_info *EA_INFORMATION) Parse(data []byte) {
 }
 
 func (ea_info *EA_INFORMATION) ShowInfo() {
-
+	fmt.Printf("type %s packed size %d need EA %d unpacked size %d\n", ea_info.FindType(),
+		ea_info.SizeOfEntry, ea_info.NofEA, ea_info.Size)
 }
 
 func (ea ExtendedAttribute) FindType() string {
@@ -62,11 +98,132 @@ func (ea ExtendedAttribute) IsNoNResident() bool {
 }
 
 func (ea *ExtendedAttribute) Parse(data []byte) {
+	offset := 0
+	for offset+EAEntryHeaderSize <= len(data) {
+		var entry EAEntry
+		utils.Unmarshal(data[offset:offset+EAEntryHeaderSize], &entry)
+
+		nameEnd := offset + EAEntryHeaderSize + int(entry.NameLen)
+		valueStart := nameEnd + 1 // name is null terminated
+		valueEnd := valueStart + int(entry.ValueLen)
+		if valueEnd > len(data) {
+			msg := fmt.Sprintf("EA entry at %d exceeds buffer %d", offset, len(data))
+			logger.MFTExtractorlogger.Warning(msg)
+			break
+		}
+		entry.Name = string(data[offset+EAEntryHeaderSize : nameEnd])
+		entry.Value = data[valueStart:valueEnd]
+		ea.Entries = append(ea.Entries, entry)
+
+		if entry.NextEntryOffset == 0 {
+			break
+		}
+		offset += int(entry.NextEntryOffset)
+	}
+
+}
 
-	utils.Unmarshal(data, ea)
+func (ea ExtendedAttribute) FindEntry(name string) *EAEntry {
+	for idx := range ea.Entries {
+		if ea.Entries[idx].Name == name {
+			return &ea.Entries[idx]
+		}
+	}
+	return nil
+}
 
+// $LXUID, $LXGID and $LXMOD are 32 bit values, $LXDEV holds the major and minor device numbers
+func (ea ExtendedAttribute) GetWSLMetadata() *WSLMetadata {
+	var wsl WSLMetadata
+	found := false
+	for name, field := range map[string]**uint32{"$LXUID": &wsl.UID, "$LXGID": &wsl.GID, "$LXMOD": &wsl.Mode} {
+		entry := ea.FindEntry(name)
+		if entry == nil || len(entry.Value) < 4 {
+			continue
+		}
+		val := binary.LittleEndian.Uint32(entry.Value)
+		*field = &val
+		found = true
+	}
+	entry := ea.FindEntry("$LXDEV")
+	if entry != nil && len(entry.Value) >= 8 {
+		wsl.Device = &WSLDevice{Major: binary.LittleEndian.Uint32(entry.Value),
+			Minor: binary.LittleEndian.Uint32(entry.Value[4:])}
+		found = true
+	}
+	if !found {
+		return nil
+	}
+	return &wsl
 }
 
 func (ea ExtendedAttribute) ShowInfo() {
+	fmt.Printf("type %s entries %d\n", ea.FindType(), len(ea.Entries))
+	for _, entry := range ea.Entries {
+		entry.ShowInfo()
+	}
+}
+
+func (entry EAEntry) IsNeeded() bool {
+	return entry.Flags&EANeedEA != 0
+}
+
+func (entry EAEntry) ShowInfo() {
+	fmt.Printf("\t%s size %d", entry.Name, entry.ValueLen)
+	if entry.IsNeeded() {
+		fmt.Printf(" need EA")
+	}
+	fmt.Printf(" %s\n", utils.Hexify(entry.Value))
+}
+
+// ls style mode e.g. -rwxr-xr-x
+func FormatPOSIXMode(mode uint32) string {
+	var mask strings.Builder
+	fileType, ok := POSIXFileTypes[mode&0170000]
+	if !ok {
+		fileType = "?"
+	}
+	mask.WriteString(fileType)
+
+	perms := "rwxrwxrwx"
+	for idx := 0; idx < 9; idx++ {
+		if mode&(1<<(8-idx)) != 0 {
+			mask.WriteByte(perms[idx])
+		} else {
+			mask.WriteByte('-')
+		}
+	}
+	result := []byte(mask.String())
+	for _, special := range []struct {
+		bit uint32
+		pos int
+		set byte
+	}{{04000, 3, 's'}, {02000, 6, 's'}, {01000, 9, 't'}} {
+		if mode&special.bit == 0 {
+			continue
+		}
+		if result[special.pos] == '-' {
+			result[special.pos] = special.set - 32 //upper case when not executable
+		} else {
+			result[special.pos] = special.set
+		}
+	}
+	return string(result)
+}
 
+func (wsl WSLMetadata) GetInfo() string {
+	var info []string
+	if wsl.UID != nil {
+		info = append(info, fmt.Sprintf("uid %d", *wsl.UID))
+	}
+	if wsl.GID != nil {
+		info = append(info, fmt.Sprintf("gid %d", *wsl.GID))
+	}
+	if wsl.Mode != nil {
+		info = append(info, fmt.Sprintf("mode %s (%o)", FormatPOSIXMode(*wsl.Mode), *wsl.Mode))
+	}
+	if wsl.Device != nil {
+		info = append(info, fmt.Sprintf("device %d,%d", wsl.Device.Major, wsl.Device.Minor))
+	}
+	return strings.Join(info, " ")
 }
@@ -0,0 +1,221 @@
+package attributes
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aarsakian/FileSystemForensics/logger"
+	"github.com/aarsakian/FileSystemForensics/utils"
+)
+
+// encrypted data is stored in blocks of 512 bytes
+const EFSBlockSize = 512
+
+var EFSCredentialTypes = map[uint32]string{
+	1: "CryptoAPI Container", 2: "Unexpected", 3: "Certificate Thumbprint",
+}
+
+// $LOGGED_UTILITY_STREAM $EFS, the FEK is encrypted once per user (DDF) and recovery agent (DRF)
+type EFS struct {
+	Header *EFSHeader
+	DDFs   []DataDecryptionField
+	DRFs   []DataDecryptionField
+}
+
+type EFSHeader struct {
+	Length           uint32
+	State            uint32
+	Version          uint32
+	CryptoAPIVersion uint32
+	Identifier       [16]byte
+	DDFChecksum      [16]byte
+	DRFChecksum      [16]byte
+	DDFOffset        uint32 //array of DDF
+	DRFOffset        uint32 //array of DRF, 0 when there is no recovery agent
+	Reserved         uint32
+}
+
+type DataDecryptionField struct {
+	Header        *DFHeader
+	Credential    *CredentialHeader
+	SID           string
+	Thumbprint    string
+	ContainerName string
+	ProviderName  string
+	UserName      string
+	EncryptedFEK  []byte
+}
+
+// offsets are relative to the start of the field
+type DFHeader struct {
+	Length           uint32
+	CredentialOffset uint32
+	FEKSize          uint32
+	FEKOffset        uint32
+	Reserved         uint32
+}
+
+// offsets are relative to the credential header
+type CredentialHeader struct {
+	Length                 uint32
+	SIDOffset              uint32
+	Type                   uint32
+	ThumbprintHeaderSize   uint32 //container name offset of CryptoAPI containers
+	ThumbprintHeaderOffset uint32 //provider name offset of CryptoAPI containers
+	PublicKeyBlobOffset    uint32
+	PublicKeyBlobSize      uint32
+}
+
+// offsets are relative to the thumbprint header
+type ThumbprintHeader struct {
+	ThumbprintOffset    uint32
+	ThumbprintSize      uint32
+	ContainerNameOffset uint32
+	ProviderNameOffset  uint32
+	UserNameOffset      uint32
+}
+
+func (efs *EFS) Parse(data []byte) {
+	if len(data) < 76 {
+		logger.MFTExtractorlogger.Warning(fmt.Sprintf("$EFS data not enough %d", len(data)))
+		return
+	}
+	efs.Header = new(EFSHeader)
+	utils.Unmarshal(data[:76], efs.Header)
+	efs.DDFs = parseDataDecryptionFields(data, int(efs.Header.DDFOffset))
+	if efs.Header.DRFOffset != 0 {
+		efs.DRFs = parseDataDecryptionFields(data, int(efs.Header.DRFOffset))
+	}
+}
+
+// array starts with the count of fields
+func parseDataDecryptionFields(data []byte, offset int) []DataDecryptionField {
+	if offset+4 > len(data) {
+		logger.MFTExtractorlogger.Warning(fmt.Sprintf("$EFS field array offset %d exceeds buffer %d", offset, len(data)))
+		return nil
+	}
+	var fields []DataDecryptionField
+	count := int(utils.ReadEndianInt(data[offset : offset+4]))
+	offset += 4
+	for idx := 0; idx < count; idx++ {
+		if offset+20 > len(data) {
+			logger.MFTExtractorlogger.Warning(fmt.Sprintf("$EFS field %d exceeds buffer %d", idx, len(data)))
+			break
+		}
+		dfHeader := new(DFHeader)
+		utils.Unmarshal(data[offset:offset+20], dfHeader)
+		if dfHeader.Length < 20 || offset+int(dfHeader.Length) > len(data) {
+			logger.MFTExtractorlogger.Warning(fmt.Sprintf("$EFS field %d invalid length %d", idx, dfHeader.Length))
+			break
+		}
+		field := DataDecryptionField{Header: dfHeader}
+		field.Parse(data[offset : offset+int(dfHeader.Length)])
+		fields = append(fields, field)
+		offset += int(dfHeader.Length)
+	}
+	return fields
+}
+
+func (field *DataDecryptionField) Parse(data []byte) {
+	header := field.Header
+	fekStart, fekEnd := uint64(header.FEKOffset), uint64(header.FEKOffset)+uint64(header.FEKSize) //no uint32 wrap around
+	if fekEnd <= uint64(len(data)) {
+		field.EncryptedFEK = data[fekStart:fekEnd]
+	}
+
+	credOffset := int(header.CredentialOffset)
+	if credOffset+28 > len(data) {
+		logger.MFTExtractorlogger.Warning(fmt.Sprintf("$EFS credential offset %d exceeds buffer %d", credOffset, len(data)))
+		return
+	}
+	field.Credential = new(CredentialHeader)
+	utils.Unmarshal(data[credOffset:credOffset+28], field.Credential)
+	credential := data[credOffset:]
+
+	if field.Credential.SIDOffset != 0 {
+		field.SID, _ = parseSID(credential, int(field.Credential.SIDOffset))
+	}
+
+	switch field.Credential.Type {
+	case 1:
+		field.ContainerName = readUTF16String(credential, int(field.Credential.ThumbprintHeaderSize))
+		field.ProviderName = readUTF16String(credential, int(field.Credential.ThumbprintHeaderOffset))
+	case 3:
+		thumbOffset := int(field.Credential.ThumbprintHeaderOffset)
+		if thumbOffset+20 > len(credential) {
+			logger.MFTExtractorlogger.Warning(fmt.Sprintf("$EFS thumbprint header offset %d exceeds buffer", thumbOffset))
+			return
+		}
+		thumbprintHeader := new(ThumbprintHeader)
+		utils.Unmarshal(credential[thumbOffset:thumbOffset+20], thumbprintHeader)
+		thumbprint := credential[thumbOffset:]
+		start := uint64(thumbprintHeader.ThumbprintOffset)
+		end := start + uint64(thumbprintHeader.ThumbprintSize)
+		if end <= uint64(len(thumbprint)) {
+			field.Thumbprint = utils.Hexify(thumbprint[start:end])
+		}
+		field.ContainerName = readUTF16String(thumbprint, int(thumbprintHeader.ContainerNameOffset))
+		field.ProviderName = readUTF16String(thumbprint, int(thumbprintHeader.ProviderNameOffset))
+		field.UserName = readUTF16String(thumbprint, int(thumbprintHeader.UserNameOffset))
+	}
+}
+
+// null terminated, 0 offset means absent
+func readUTF16String(data []byte, offset int) string {
+	if offset == 0 || offset >= len(data) {
+		return ""
+	}
+	end := offset
+	for end+1 < len(data) && (data[end] != 0 || data[end+1] != 0) {
+		end += 2
+	}
+	return utils.DecodeUTF16(data[offset:end])
+}
+
+func (field DataDecryptionField) GetCredentialType() string {
+	if field.Credential == nil {
+		return ""
+	}
+	credentialType, ok := EFSCredentialTypes[field.Credential.Type]
+	if ok {
+		return credentialType
+	}
+	return fmt.Sprintf("%d", field.Credential.Type)
+}
+
+func (field DataDecryptionField) GetInfo() string {
+	info := []string{GetSIDName(field.SID)}
+	if field.UserName != "" {
+		info = append(info, fmt.Sprintf("user %s", field.UserName))
+	}
+	if field.Thumbprint != "" {
+		info = append(info, fmt.Sprintf("thumbprint %s", field.Thumbprint))
+	}
+	if field.ContainerName != "" {
+		info = append(info, fmt.Sprintf("container %s", field.ContainerName))
+	}
+	if field.ProviderName != "" {
+		info = append(info, fmt.Sprintf("provider %s", field.ProviderName))
+	}
+	info = append(info, fmt.Sprintf("%s FEK %d bytes", field.GetCredentialType(), len(field.EncryptedFEK)))
+	return strings.Join(info, " ")
+}
+
+// users and recovery agents able to decrypt, one per line
+func (efs EFS) GetInfo() string {
+	var lines []string
+	if efs.Header != nil {
+		lines = append(lines, fmt.Sprintf("version %d crypto API version %d", efs.Header.Version, efs.Header.CryptoAPIVersion))
+	}
+	for _, ddf := range efs.DDFs {
+		lines = append(lines, fmt.Sprintf("DDF %s", ddf.GetInfo()))
+	}
+	for _, drf := range efs.DRFs {
+		lines = append(lines, fmt.Sprintf("DRF %s", drf.GetInfo()))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (efs EFS) ShowInfo() {
+	fmt.Printf("%s\n", efs.GetInfo())
+}
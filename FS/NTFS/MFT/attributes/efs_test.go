@@ -0,0 +1,23 @@
+package attributes
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// offsets and sizes whose uint32 sum wraps around must not be sliced
+func TestDataDecryptionFieldWrappedOffsets(t *testing.T) {
+	data := make([]byte, 96)
+	credential := data[20:]
+	binary.LittleEndian.PutUint32(credential[8:12], 3)   // certificate thumbprint
+	binary.LittleEndian.PutUint32(credential[16:20], 28) // thumbprint header offset
+	thumbprint := credential[28:]
+	binary.LittleEndian.PutUint32(thumbprint[0:4], 0xffffffff)
+	binary.LittleEndian.PutUint32(thumbprint[4:8], 2)
+
+	field := DataDecryptionField{Header: &DFHeader{Length: 96, CredentialOffset: 20, FEKSize: 2, FEKOffset: 0xffffffff}}
+	field.Parse(data)
+	if field.EncryptedFEK != nil || field.Thumbprint != "" {
+		t.Errorf("FEK %x thumbprint %s parsed from out of bounds offsets", field.EncryptedFEK, field.Thumbprint)
+	}
+}
@@ -1,9 +1,11 @@
 package attributes
 
 import (
+	"encoding/binary"
 	"fmt"
 	"sort"
 
+	"github.com/aarsakian/FileSystemForensics/logger"
 	"github.com/aarsakian/FileSystemForensics/utils"
 )
 
@@ -20,6 +22,8 @@ type IndexEntry struct {
 	Flags      uint32 //12-15
 	ChildVCN   int64
 	Fnattr     *FNAttribute
+	Slack      bool   //recovered from the unused space of an index buffer
+	Raw        []byte //entries of view indexes e.g. $ObjId:$O are not keyed by file names
 }
 
 type IndexRoot struct {
@@ -40,14 +44,23 @@ type NodeHeader struct {
 }
 
 type IndexAllocation struct {
-	Signature        string //0-4
-	FixupArrayOffset int16  //4-6
-	NumFixupEntries  int16  //6-8
-	LSN              int64  //8-16
-	VCN              int64  //16-24 where the record fits in the tree
+	Header       *AttributeHeader
+	Buffers      []IndexBuffer
+	IndexEntries IndexEntries //of buffers in use
+	SlackEntries IndexEntries //stale entries carved from the unused space of index buffers
+}
+
+// index record of the allocation, a node of the B+tree
+type IndexBuffer struct {
+	Signature        [4]byte //0-4
+	FixupArrayOffset uint16  //4-6
+	NumFixupEntries  uint16  //6-8
+	LSN              int64   //8-16
+	VCN              int64   //16-24 where the record fits in the tree
 	Nodeheader       *NodeHeader
-	Header           *AttributeHeader
 	IndexEntries     IndexEntries
+	Offset           int  //within the allocation
+	InUse            bool //according to the bitmap of the index
 }
 
 func (idxEntry IndexEntry) ShowInfo() {
@@ -58,6 +71,13 @@ func (idxEntry IndexEntry) ShowInfo() {
 
 }
 
+func (idxEntry IndexEntry) ShowSlackInfo() {
+	atime, ctime, mtime, mftime := idxEntry.Fnattr.GetTimestamps()
+	fmt.Printf("slack file ref %d name %s parent %d allocated size %d real size %d a %s c %s m %s mftm %s\n",
+		idxEntry.ParRef, idxEntry.Fnattr.Fname, idxEntry.Fnattr.ParRef, idxEntry.Fnattr.AllocFsize,
+		idxEntry.Fnattr.RealFsize, atime, ctime, mtime, mftime)
+}
+
 func (idxRoot *IndexRoot) SetHeader(header *AttributeHeader) {
 	idxRoot.Header = header
 }
@@ -71,7 +91,10 @@ func (idxRoot *IndexRoot) Parse(data []byte) {
 
 	idxEntryOffset := 16 + uint16(nodeheader.OffsetEntryList)
 
-	idxRoot.IndexEntries = Parse(data[idxEntryOffset:nodeheader.OffsetEndUsedEntryList])
+	idxEndOffset := 16 + uint16(nodeheader.OffsetEndUsedEntryList)
+	if idxEndOffset > idxEntryOffset && int(idxEndOffset) <= len(data) {
+		idxRoot.IndexEntries = Parse(data[idxEntryOffset:idxEndOffset])
+	}
 
 }
 
@@ -123,7 +146,14 @@ func (idxAllocation IndexAllocation) IsNoNResident() bool {
 }
 
 func (idxAllocation IndexAllocation) ShowInfo() {
-	fmt.Printf("type %s nof entries %d\n", idxAllocation.FindType(), idxAllocation.NumFixupEntries)
+	inUse := 0
+	for _, idxBuffer := range idxAllocation.Buffers {
+		if idxBuffer.InUse {
+			inUse++
+		}
+	}
+	fmt.Printf("type %s nof buffers %d in use %d nof entries %d\n", idxAllocation.FindType(),
+		len(idxAllocation.Buffers), inUse, len(idxAllocation.IndexEntries))
 	for _, idxEntry := range idxAllocation.IndexEntries {
 		idxEntry.ShowInfo()
 	}
@@ -132,9 +162,13 @@ func (idxAllocation IndexAllocation) ShowInfo() {
 func Parse(data []byte) IndexEntries {
 	var idxEntries IndexEntries
 	idxEntryOffset := uint16(0)
-	for idxEntryOffset < uint16(len(data)) {
+	for int(idxEntryOffset)+16 <= len(data) {
 		var idxEntry *IndexEntry = new(IndexEntry)
-		idxEntry.Parse(data[idxEntryOffset:])
+		entryLen := binary.LittleEndian.Uint16(data[idxEntryOffset+8 : idxEntryOffset+10])
+		if entryLen < 16 || int(idxEntryOffset)+int(entryLen) > len(data) {
+			break
+		}
+		idxEntry.Parse(data[idxEntryOffset : idxEntryOffset+entryLen])
 
 		idxEntryOffset += idxEntry.Len
 		idxEntries = append(idxEntries, *idxEntry)
@@ -146,11 +180,13 @@ func Parse(data []byte) IndexEntries {
 func (idxEntry *IndexEntry) Parse(data []byte) {
 	utils.Unmarshal(data[:16], idxEntry)
 
-	if IndexFlags[idxEntry.Flags] == "Has VCN" {
-		idxEntry.ChildVCN = utils.ReadEndianInt(data[16+idxEntry.Len-8 : 16+idxEntry.Len])
+	if idxEntry.HasChild() {
+		idxEntry.ChildVCN = utils.ReadEndianInt(data[idxEntry.Len-8 : idxEntry.Len])
+	} else {
+		idxEntry.ChildVCN = -1
 	}
 
-	if idxEntry.ContentLen > 0 {
+	if idxEntry.ContentLen >= 66 && 16+int(idxEntry.ContentLen) <= len(data) {
 		var fnattrIDXEntry FNAttribute
 		utils.Unmarshal(data[16:16+uint32(idxEntry.ContentLen)],
 			&fnattrIDXEntry)
@@ -158,23 +194,121 @@ func (idxEntry *IndexEntry) Parse(data []byte) {
 		fnattrIDXEntry.Fname = utils.DecodeUTF16(data[16+66 : 16+66+2*uint32(fnattrIDXEntry.Nlen)])
 		idxEntry.Fnattr = &fnattrIDXEntry
 
+	} else if !idxEntry.IsLast() {
+		idxEntry.Raw = data
 	}
 }
 
+func (idxEntry IndexEntry) HasChild() bool {
+	return idxEntry.Flags&0x01 != 0
+}
+
+// marks the end of a node, holds no name
+func (idxEntry IndexEntry) IsLast() bool {
+	return idxEntry.Flags&0x02 != 0
+}
+
+// index buffers follow each other, each one sized by its node header
 func (idxAllocation *IndexAllocation) Parse(data []byte) {
-	utils.Unmarshal(data[:24], idxAllocation)
-	if idxAllocation.Signature == "INDX" {
-		var nodeheader *NodeHeader = new(NodeHeader)
-		utils.Unmarshal(data[24:24+16], nodeheader)
-		idxAllocation.Nodeheader = nodeheader
-
-		idxEntryOffset := nodeheader.OffsetEntryList + 24       // relative to the start of node header
-		if nodeheader.OffsetEndUsedEntryList > idxEntryOffset { // only when available exceeds start offset parse
-			idxAllocation.IndexEntries = Parse(data[idxEntryOffset:nodeheader.OffsetEndUsedEntryList])
+	idxAllocation.Buffers = nil
+	idxAllocation.IndexEntries = nil
+	idxAllocation.SlackEntries = nil
+
+	bufferSize := DefaultIndexBufferSize
+	for offset := 0; offset+IndexBufferHeaderLength <= len(data); offset += bufferSize {
+		idxBuffer := IndexBuffer{Offset: offset, InUse: true}
+		buffer, err := idxBuffer.readBuffer(data[offset:])
+		if err != nil {
+			if !isZeroed(data[offset : offset+IndexBufferHeaderLength]) {
+				logger.MFTExtractorlogger.Warning(fmt.Sprintf("index buffer at %d %s", offset, err))
+			}
+			continue
 		}
+		bufferSize = len(buffer)
 
+		nodeheader := idxBuffer.Nodeheader
+		idxEntryOffset := nodeheader.OffsetEntryList + 24 // relative to the start of node header
+		idxEndOffset := nodeheader.OffsetEndUsedEntryList + 24
+		if idxEndOffset > idxEntryOffset { // only when available exceeds start offset parse
+			idxBuffer.IndexEntries = Parse(buffer[idxEntryOffset:idxEndOffset])
+		}
+		idxAllocation.SlackEntries = append(idxAllocation.SlackEntries, idxBuffer.CarveSlack(buffer)...)
+		idxAllocation.Buffers = append(idxAllocation.Buffers, idxBuffer)
 	}
+	idxAllocation.collectEntries()
+
+}
 
+// a set bit per index record marks the buffer in use, entries of free buffers are stale
+func (idxAllocation *IndexAllocation) ApplyBitmap(bitmap []byte) {
+	if len(idxAllocation.Buffers) == 0 {
+		return
+	}
+	bufferSize := idxAllocation.Buffers[0].GetSize()
+	for idx := range idxAllocation.Buffers {
+		idxBuffer := &idxAllocation.Buffers[idx]
+		bit := idxBuffer.Offset / bufferSize
+		idxBuffer.InUse = bit/8 < len(bitmap) && bitmap[bit/8]&(1<<(bit%8)) != 0
+		if idxBuffer.InUse {
+			continue
+		}
+		for _, idxEntry := range idxBuffer.IndexEntries {
+			if idxEntry.Fnattr == nil {
+				continue
+			}
+			idxEntry.Slack = true
+			idxAllocation.SlackEntries = append(idxAllocation.SlackEntries, idxEntry)
+		}
+	}
+	idxAllocation.collectEntries()
+}
+
+func (idxAllocation *IndexAllocation) collectEntries() {
+	idxAllocation.IndexEntries = nil
+	for _, idxBuffer := range idxAllocation.Buffers {
+		if idxBuffer.InUse {
+			idxAllocation.IndexEntries = append(idxAllocation.IndexEntries, idxBuffer.IndexEntries...)
+		}
+	}
+}
+
+func (idxAllocation IndexAllocation) GetBuffer(vcn int64) (IndexBuffer, bool) {
+	for _, idxBuffer := range idxAllocation.Buffers {
+		if idxBuffer.VCN == vcn && idxBuffer.InUse {
+			return idxBuffer, true
+		}
+	}
+	return IndexBuffer{}, false
+}
+
+func (idxBuffer IndexBuffer) GetSize() int {
+	return int(idxBuffer.Nodeheader.OffsetEndEntryListBuffer) + 24
+}
+
+// in order traversal from the root, children sort before the entry pointing to them
+func (idxRoot IndexRoot) Walk(idxAllocation *IndexAllocation) IndexEntries {
+	visited := map[int64]bool{}
+	return walk(idxRoot.IndexEntries, idxAllocation, visited)
+}
+
+func walk(idxEntries IndexEntries, idxAllocation *IndexAllocation, visited map[int64]bool) IndexEntries {
+	var ordered IndexEntries
+	for _, idxEntry := range idxEntries {
+		if idxEntry.HasChild() && idxAllocation != nil && !visited[idxEntry.ChildVCN] {
+			visited[idxEntry.ChildVCN] = true
+			idxBuffer, ok := idxAllocation.GetBuffer(idxEntry.ChildVCN)
+			if ok {
+				ordered = append(ordered, walk(idxBuffer.IndexEntries, idxAllocation, visited)...)
+			} else {
+				logger.MFTExtractorlogger.Warning(fmt.Sprintf("index buffer VCN %d not found", idxEntry.ChildVCN))
+			}
+		}
+		if idxEntry.IsLast() || idxEntry.Fnattr == nil {
+			continue
+		}
+		ordered = append(ordered, idxEntry)
+	}
+	return ordered
 }
 
 func (idxAllocation IndexAllocation) GetIndexEntriesSortedByMFTEntry() IndexEntries {
@@ -0,0 +1,137 @@
+package attributes
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"unicode"
+
+	"github.com/aarsakian/FileSystemForensics/utils"
+)
+
+// INDX header followed by the node header
+const IndexBufferHeaderLength = 40
+
+const DefaultIndexBufferSize = 4096
+
+// $FILE_NAME up to the name
+const FNFixedLength = 66
+
+// earliest plausible timestamp of a carved entry, 1 Jan 1980 in 100ns since 1601
+const MinSlackTime = 119600064000000000
+
+// index buffer of the node header size with the update sequence restored
+func (idxBuffer *IndexBuffer) readBuffer(data []byte) ([]byte, error) {
+	if len(data) < IndexBufferHeaderLength {
+		return nil, errors.New("not enough data for index buffer header")
+	}
+	utils.Unmarshal(data[:24], idxBuffer)
+	if string(idxBuffer.Signature[:]) != "INDX" {
+		return nil, fmt.Errorf("invalid signature %x", idxBuffer.Signature)
+	}
+	var nodeheader *NodeHeader = new(NodeHeader)
+	utils.Unmarshal(data[24:IndexBufferHeaderLength], nodeheader)
+	idxBuffer.Nodeheader = nodeheader
+
+	bufferLen := int(nodeheader.OffsetEndEntryListBuffer) + 24
+	if bufferLen > len(data) || nodeheader.OffsetEndUsedEntryList > nodeheader.OffsetEndEntryListBuffer ||
+		nodeheader.OffsetEntryList+24 < IndexBufferHeaderLength {
+		return nil, fmt.Errorf("VCN %d invalid node header", idxBuffer.VCN)
+	}
+	buffer := make([]byte, bufferLen)
+	copy(buffer, data[:bufferLen])
+	err := utils.ApplyFixUps(buffer, int(idxBuffer.FixupArrayOffset), int(idxBuffer.NumFixupEntries), 512)
+	if err != nil {
+		return nil, fmt.Errorf("VCN %d %s", idxBuffer.VCN, err)
+	}
+	return buffer, nil
+}
+
+// scans the space between the used and the allocated end of the index buffer for $FILE_NAME entries
+func (idxBuffer IndexBuffer) CarveSlack(buffer []byte) IndexEntries {
+	var slackEntries IndexEntries
+	maxStamp := uint64(time.Now().Add(24*time.Hour).Unix()+11644473600) * 10000000
+
+	slackStart := align8(int(idxBuffer.Nodeheader.OffsetEndUsedEntryList) + 24)
+	for pos := slackStart; pos+FNFixedLength <= len(buffer); {
+		idxEntry, ok := carveIndexEntry(buffer, pos, maxStamp)
+		if !ok {
+			pos += 8
+			continue
+		}
+		slackEntries = append(slackEntries, *idxEntry)
+		pos += align8(FNFixedLength + 2*int(idxEntry.Fnattr.Nlen))
+	}
+	return slackEntries
+}
+
+// validates a $FILE_NAME at pos, the index entry header preceding it may have been overwritten
+func carveIndexEntry(buffer []byte, pos int, maxStamp uint64) (*IndexEntry, bool) {
+	var fnattr FNAttribute
+	utils.Unmarshal(buffer[pos:pos+FNFixedLength], &fnattr)
+	fnameEnd := pos + FNFixedLength + 2*int(fnattr.Nlen)
+	if fnattr.Nlen == 0 || fnattr.Nspace > 3 || fnameEnd > len(buffer) ||
+		fnattr.ParRef == 0 || fnattr.ParRef > 0xFFFFFFFF ||
+		fnattr.AllocFsize < fnattr.RealFsize || fnattr.AllocFsize%8 != 0 {
+		return nil, false
+	}
+	for _, timestamp := range []utils.WindowsTime{fnattr.Crtime, fnattr.Mtime, fnattr.MFTmtime, fnattr.Atime} {
+		if timestamp.Stamp < MinSlackTime || timestamp.Stamp > maxStamp {
+			return nil, false
+		}
+	}
+
+	fnattr.Fname = utils.DecodeUTF16(buffer[pos+FNFixedLength : fnameEnd])
+	for _, char := range fnattr.Fname {
+		if !unicode.IsPrint(char) || char == unicode.ReplacementChar || char == '\\' || char == '/' {
+			return nil, false
+		}
+	}
+
+	idxEntry := &IndexEntry{Fnattr: &fnattr, Slack: true}
+	var entryHeader IndexEntry
+	utils.Unmarshal(buffer[pos-16:pos], &entryHeader)
+	if int(entryHeader.ContentLen) == FNFixedLength+2*int(fnattr.Nlen) { // header is intact
+		idxEntry.ParRef = entryHeader.ParRef
+		idxEntry.ParSeq = entryHeader.ParSeq
+		idxEntry.Len = entryHeader.Len
+		idxEntry.ContentLen = entryHeader.ContentLen
+		idxEntry.Flags = entryHeader.Flags
+	}
+	return idxEntry, true
+}
+
+func align8(length int) int {
+	return (length + 7) &^ 7
+}
+
+func isZeroed(data []byte) bool {
+	for _, val := range data {
+		if val != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// entries of the slack not matching a live entry of the directory, moved entries leave stale copies
+func (slackEntries IndexEntries) GetDeleted(liveEntries IndexEntries, dirEntry uint64) IndexEntries {
+	liveNames := map[string]bool{}
+	for _, liveEntry := range liveEntries {
+		if liveEntry.Fnattr != nil {
+			liveNames[liveEntry.Fnattr.Fname] = true
+		}
+	}
+
+	var deletedEntries IndexEntries
+	seenNames := map[string]bool{}
+	for _, slackEntry := range slackEntries {
+		fname := slackEntry.Fnattr.Fname
+		if slackEntry.Fnattr.ParRef != dirEntry || liveNames[fname] || seenNames[fname] {
+			continue
+		}
+		seenNames[fname] = true
+		deletedEntries = append(deletedEntries, slackEntry)
+	}
+	return deletedEntries
+}
@@ -1,25 +1,39 @@
 package attributes
 
-import "github.com/aarsakian/FileSystemForensics/utils"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aarsakian/FileSystemForensics/utils"
+)
 
 type LoggedUtilityStream struct {
 	Kind    string
 	TXFDATA *TXFDATA
+	EFS     *EFS
 	Header  *AttributeHeader
 }
 
+// transactional NTFS state of a file, LSNs point to records of the $TxfLog CLFS log, they are decoded not resolved
 type TXFDATA struct {
-	ParRef              uint64
-	ParSeq              uint16
+	ParRef              uint64  //root of the resource manager
+	ParSeq              uint16  //
 	Flags               [8]byte //
-	USN                 uint64  //
-	TxId                uint64  //
+	USN                 uint64  //of the last transacted change
+	TxId                uint64  //TxF file id
 	LSN_NTFS_Metadata   uint64  //
 	LSN_User_Data       uint64  //
 	LSN_Directory_Index uint64  //
 
 }
 
+// CLFS LSNs are made of the container, the 512 byte aligned block offset and the record sequence
+type CLFSLSN struct {
+	Container   uint32
+	BlockOffset uint32
+	RecordSeq   uint16
+}
+
 func (loggedUtility LoggedUtilityStream) FindType() string {
 	return loggedUtility.Header.GetType()
 }
@@ -41,10 +55,48 @@ func (loggedUtility *LoggedUtilityStream) Parse(data []byte) {
 		txfData := new(TXFDATA)
 		utils.Unmarshal(data, txfData)
 		loggedUtility.TXFDATA = txfData
+	} else if loggedUtility.Kind == "$EFS" {
+		efs := new(EFS)
+		efs.Parse(data)
+		loggedUtility.EFS = efs
 	}
 
 }
 
 func (loggedUtiltiy LoggedUtilityStream) ShowInfo() {
+	fmt.Printf("type %s %s\n", loggedUtiltiy.FindType(), loggedUtiltiy.Kind)
+	if loggedUtiltiy.TXFDATA != nil {
+		fmt.Printf("%s\n", loggedUtiltiy.TXFDATA.GetInfo())
+	}
+	if loggedUtiltiy.EFS != nil {
+		loggedUtiltiy.EFS.ShowInfo()
+	}
+}
 
+func DecodeCLFSLSN(lsn uint64) CLFSLSN {
+	return CLFSLSN{Container: uint32(lsn >> 32), BlockOffset: uint32(lsn) &^ 0x1ff, RecordSeq: uint16(lsn & 0x1ff)}
+}
+
+func (clfsLSN CLFSLSN) GetInfo() string {
+	return fmt.Sprintf("container %d block offset %d record %d", clfsLSN.Container, clfsLSN.BlockOffset, clfsLSN.RecordSeq)
+}
+
+// no LSNs once the transaction has been committed and the log cleaned
+func (txfData TXFDATA) HasLSNs() bool {
+	return txfData.LSN_NTFS_Metadata != 0 || txfData.LSN_User_Data != 0 || txfData.LSN_Directory_Index != 0
+}
+
+func (txfData TXFDATA) GetInfo() string {
+	info := []string{fmt.Sprintf("TxF file id %d usn %d rm root %d", txfData.TxId, txfData.USN, txfData.ParRef)}
+	for _, lsn := range []struct {
+		name string
+		lsn  uint64
+	}{{"metadata", txfData.LSN_NTFS_Metadata}, {"user data", txfData.LSN_User_Data},
+		{"directory index", txfData.LSN_Directory_Index}} {
+		if lsn.lsn == 0 {
+			continue
+		}
+		info = append(info, fmt.Sprintf("%s LSN %d (%s)", lsn.name, lsn.lsn, DecodeCLFSLSN(lsn.lsn).GetInfo()))
+	}
+	return strings.Join(info, " ")
 }
@@ -1,11 +1,16 @@
 package attributes
 
 import (
+	"encoding/binary"
 	"fmt"
+	"strings"
 
 	"github.com/aarsakian/FileSystemForensics/utils"
 )
 
+// 100ns intervals between the GUID epoch 1582-10-15 and the Windows epoch 1601-01-01
+const GUIDEpochDelta = 5748192000000000
+
 type ObjectID struct { //unique guID
 	ObjGUID     [16]byte //object ID
 	OrigVolGUID [16]byte //volume ID
@@ -14,6 +19,23 @@ type ObjectID struct { //unique guID
 	Header      *AttributeHeader
 }
 
+// entry of the $ObjId:$O index, maps an object id to its MFT entry
+type ObjIdEntry struct {
+	ObjGUID     [16]byte
+	ParRef      uint64
+	ParSeq      uint16
+	OrigVolGUID [16]byte
+	OrigObjGUID [16]byte
+	OrigDomGUID [16]byte
+}
+
+// time based GUID, the node is the MAC address of the machine that created it
+type GUIDv1 struct {
+	Time     utils.WindowsTime
+	ClockSeq uint16
+	Node     [6]byte
+}
+
 func (objectId *ObjectID) SetHeader(header *AttributeHeader) {
 	objectId.Header = header
 }
@@ -35,5 +57,95 @@ func (objectId ObjectID) IsNoNResident() bool {
 }
 
 func (objectId ObjectID) ShowInfo() {
-	fmt.Printf("type %s\n", objectId.FindType())
+	fmt.Printf("type %s %s\n", objectId.FindType(), FormatObjectIDs(objectId.ObjGUID, objectId.OrigVolGUID,
+		objectId.OrigObjGUID, objectId.OrigDomGUID))
+}
+
+// birth ids are absent when zeroed, object ids carry their GUID v1 timestamps and MAC addresses
+func FormatObjectIDs(objGUID [16]byte, origVolGUID [16]byte, origObjGUID [16]byte, origDomGUID [16]byte) string {
+	info := []string{fmt.Sprintf("object %s", FormatGUID(objGUID))}
+	for _, birthID := range []struct {
+		name string
+		guid [16]byte
+	}{{"birth volume", origVolGUID}, {"birth object", origObjGUID}, {"domain", origDomGUID}} {
+		if birthID.guid == [16]byte{} {
+			continue
+		}
+		info = append(info, fmt.Sprintf("%s %s", birthID.name, FormatGUID(birthID.guid)))
+	}
+	return strings.Join(info, " ")
+}
+
+func FormatGUID(guid [16]byte) string {
+	guidv1, ok := DecodeGUIDv1(guid)
+	if !ok {
+		return utils.StringifyGUID(guid[:])
+	}
+	return fmt.Sprintf("%s (%s)", utils.StringifyGUID(guid[:]), guidv1.GetInfo())
+}
+
+// version is kept in the high nibble of the time high field
+func DecodeGUIDv1(guid [16]byte) (GUIDv1, bool) {
+	timeHigh := binary.LittleEndian.Uint16(guid[6:8])
+	if timeHigh>>12 != 1 || guid[8]&0xc0 != 0x80 { // RFC 4122 variant
+		return GUIDv1{}, false
+	}
+	stamp := uint64(timeHigh&0x0fff)<<48 | uint64(binary.LittleEndian.Uint16(guid[4:6]))<<32 |
+		uint64(binary.LittleEndian.Uint32(guid[0:4]))
+	if stamp < GUIDEpochDelta {
+		return GUIDv1{}, false
+	}
+	var guidv1 GUIDv1
+	guidv1.Time = utils.WindowsTime{Stamp: stamp - GUIDEpochDelta}
+	guidv1.ClockSeq = binary.BigEndian.Uint16(guid[8:10]) & 0x3fff
+	copy(guidv1.Node[:], guid[10:16])
+	return guidv1, true
+}
+
+func (guidv1 GUIDv1) GetMAC() string {
+	octets := make([]string, len(guidv1.Node))
+	for idx, octet := range guidv1.Node {
+		octets[idx] = fmt.Sprintf("%02x", octet)
+	}
+	return strings.Join(octets, ":")
+}
+
+func (guidv1 GUIDv1) GetInfo() string {
+	return fmt.Sprintf("created %s MAC %s sequence %d", guidv1.Time.ConvertToIsoTime(), guidv1.GetMAC(), guidv1.ClockSeq)
+}
+
+// lower case without braces as printed by the GUID formatting
+func NormalizeGUID(guid string) string {
+	return strings.ToLower(strings.Trim(guid, "{}"))
+}
+
+// key is the object id, data holds the MFT reference followed by the birth ids
+func ParseObjIdEntries(idxEntries IndexEntries) []ObjIdEntry {
+	var objIdEntries []ObjIdEntry
+	for _, idxEntry := range idxEntries {
+		data := idxEntry.Raw
+		if len(data) < 16 {
+			continue
+		}
+		dataOffset := int(binary.LittleEndian.Uint16(data[0:2]))
+		dataLen := int(binary.LittleEndian.Uint16(data[2:4]))
+		keyLen := int(binary.LittleEndian.Uint16(data[10:12]))
+		if keyLen != 16 || dataLen < 56 || dataOffset+56 > len(data) || 16+keyLen > len(data) {
+			continue
+		}
+		var objIdEntry ObjIdEntry
+		copy(objIdEntry.ObjGUID[:], data[16:32])
+		objIdEntry.ParRef = utils.ReadEndianUInt(data[dataOffset : dataOffset+6])
+		objIdEntry.ParSeq = binary.LittleEndian.Uint16(data[dataOffset+6 : dataOffset+8])
+		copy(objIdEntry.OrigVolGUID[:], data[dataOffset+8:dataOffset+24])
+		copy(objIdEntry.OrigObjGUID[:], data[dataOffset+24:dataOffset+40])
+		copy(objIdEntry.OrigDomGUID[:], data[dataOffset+40:dataOffset+56])
+		objIdEntries = append(objIdEntries, objIdEntry)
+	}
+	return objIdEntries
+}
+
+func (objIdEntry ObjIdEntry) ShowInfo() {
+	fmt.Printf("entry %d seq %d %s\n", objIdEntry.ParRef, objIdEntry.ParSeq, FormatObjectIDs(objIdEntry.ObjGUID,
+		objIdEntry.OrigVolGUID, objIdEntry.OrigObjGUID, objIdEntry.OrigDomGUID))
 }
@@ -1,23 +1,71 @@
 package attributes
 
 import (
+	"encoding/binary"
 	"fmt"
+	"strings"
 
 	"github.com/aarsakian/FileSystemForensics/logger"
 	"github.com/aarsakian/FileSystemForensics/utils"
 )
 
+const SymlinkRelative = 0x00000001
+
+var ReparseTags = map[uint32]string{
+	0xA0000003: "Mount Point", 0xC0000004: "HSM", 0x80000005: "Drive Extender",
+	0x80000006: "HSM2", 0x80000007: "SIS", 0x80000008: "WIM", 0x80000009: "CSV",
+	0x8000000A: "DFS", 0x8000000B: "Filter Manager", 0xA000000C: "Symbolic Link",
+	0xA0000010: "IIS Cache", 0x80000012: "DFSR", 0x80000013: "Dedup",
+	0xC0000014: "AppX Stream", 0x80000014: "NFS", 0x80000015: "File Placeholder",
+	0x80000016: "DFM", 0x80000017: "WOF", 0x80000018: "WCI", 0x90001018: "WCI 1",
+	0xA0000019: "Global Reparse", 0x9000001A: "Cloud Files", 0x8000001B: "AppExecLink",
+	0x9000001C: "ProjFS", 0xA000001D: "LX Symlink", 0x8000001E: "Storage Sync",
+	0xA000001F: "WCI Tombstone", 0x80000020: "Unhandled", 0x80000021: "OneDrive",
+	0xA0000022: "ProjFS Tombstone", 0x80000023: "AF Unix", 0x80000024: "LX FIFO",
+	0x80000025: "LX CHR", 0x80000026: "LX BLK", 0xA0000027: "WCI Link",
+	0xA0000028: "Dataless CIM",
+}
+
+var WofProviders = map[uint32]string{1: "WIM", 2: "FILE"}
+
+var WofAlgorithms = map[uint32]string{0: "XPRESS4K", 1: "LZX", 2: "XPRESS8K", 3: "XPRESS16K"}
+
 type Reparse struct {
-	Flags                 uint32
-	Size                  uint16
-	Unused                [2]byte
-	TargetNameOffset      int16
-	TargetLen             uint16
-	TargetPrintNameOffset int16
-	TargetPrintNameLen    uint16
-	Header                *AttributeHeader
-	Name                  string
-	PrintName             string
+	Tag         uint32
+	DataLength  uint16
+	Reserved    [2]byte
+	Header      *AttributeHeader
+	Name        string //substitute name, the target
+	PrintName   string
+	Flags       uint32 //symbolic links only
+	WofInfo     *WofInfo
+	AppExecLink *AppExecLink
+	Data        []byte //reparse data following the header
+}
+
+// mount points have no flags, symbolic links have flags before the path buffer
+type ReparseNames struct {
+	SubstituteNameOffset uint16
+	SubstituteNameLen    uint16
+	PrintNameOffset      uint16
+	PrintNameLen         uint16
+}
+
+// Windows Overlay Filter, WOF_EXTERNAL_INFO followed by the provider info
+type WofInfo struct {
+	Version         uint32
+	Provider        uint32
+	ProviderVersion uint32
+	Algorithm       uint32
+	Flags           uint32
+}
+
+// store app execution aliases e.g. in WindowsApps
+type AppExecLink struct {
+	Version        uint32
+	PackageID      string
+	AppUserModelID string
+	TargetPath     string
 }
 
 func (reparse *Reparse) SetHeader(header *AttributeHeader) {
@@ -29,15 +77,126 @@ func (reparse Reparse) GetHeader() AttributeHeader {
 }
 
 func (reparse *Reparse) Parse(data []byte) {
-	utils.Unmarshal(data[:16], reparse)
-	if len(data) < 16 {
+	if len(data) < 8 {
 		logger.MFTExtractorlogger.Warning(fmt.Sprintf("Reparse data not enough %d", len(data)))
 		return
 	}
-	reparse.Name = utils.DecodeUTF16(data[16+
-		uint16(reparse.TargetNameOffset) : 16+uint16(reparse.TargetNameOffset)+reparse.TargetLen])
-	reparse.PrintName = utils.DecodeUTF16(data[16+uint16(reparse.TargetPrintNameOffset) : 16+
-		uint16(reparse.TargetPrintNameLen)])
+	reparse.Tag = binary.LittleEndian.Uint32(data[:4])
+	reparse.DataLength = binary.LittleEndian.Uint16(data[4:6])
+
+	end := 8 + int(reparse.DataLength)
+	if end > len(data) {
+		logger.MFTExtractorlogger.Warning(fmt.Sprintf("Reparse data length %d exceeds buffer %d",
+			reparse.DataLength, len(data)-8))
+		end = len(data)
+	}
+	reparse.Data = data[8:end]
+
+	switch reparse.GetTagType() {
+	case "Mount Point":
+		if len(reparse.Data) < 8 {
+			logger.MFTExtractorlogger.Warning(fmt.Sprintf("Mount point reparse data not enough %d", len(reparse.Data)))
+			return
+		}
+		reparse.parseNames(reparse.Data, 8)
+	case "Symbolic Link":
+		if len(reparse.Data) < 12 {
+			logger.MFTExtractorlogger.Warning(fmt.Sprintf("Symbolic link reparse data not enough %d", len(reparse.Data)))
+			return
+		}
+		reparse.Flags = binary.LittleEndian.Uint32(reparse.Data[8:12])
+		reparse.parseNames(reparse.Data, 12)
+	case "LX Symlink":
+		if len(reparse.Data) > 4 { // version followed by UTF-8 target
+			reparse.Name = string(reparse.Data[4:])
+			reparse.PrintName = reparse.Name
+		}
+	case "WOF":
+		if len(reparse.Data) < 20 {
+			logger.MFTExtractorlogger.Warning(fmt.Sprintf("WOF reparse data not enough %d", len(reparse.Data)))
+			return
+		}
+		wofInfo := new(WofInfo)
+		utils.Unmarshal(reparse.Data[:20], wofInfo)
+		reparse.WofInfo = wofInfo
+	case "AppExecLink":
+		if len(reparse.Data) < 4 {
+			logger.MFTExtractorlogger.Warning(fmt.Sprintf("AppExecLink reparse data not enough %d", len(reparse.Data)))
+			return
+		}
+		appExecLink := new(AppExecLink)
+		appExecLink.Version = binary.LittleEndian.Uint32(reparse.Data[:4])
+		strs := splitUTF16Strings(reparse.Data[4:])
+		if len(strs) > 2 {
+			appExecLink.PackageID = strs[0]
+			appExecLink.AppUserModelID = strs[1]
+			appExecLink.TargetPath = strs[2]
+		}
+		reparse.AppExecLink = appExecLink
+		reparse.Name = appExecLink.TargetPath
+		reparse.PrintName = appExecLink.TargetPath
+	}
+}
+
+// path buffer offsets are relative to its start
+func (reparse *Reparse) parseNames(data []byte, pathBufferOffset int) {
+	var names ReparseNames
+	utils.Unmarshal(data[:8], &names)
+
+	pathBuffer := data[pathBufferOffset:]
+	nameEnd := int(names.SubstituteNameOffset) + int(names.SubstituteNameLen)
+	printNameEnd := int(names.PrintNameOffset) + int(names.PrintNameLen)
+	if nameEnd > len(pathBuffer) || printNameEnd > len(pathBuffer) {
+		logger.MFTExtractorlogger.Warning(fmt.Sprintf("Reparse names exceed path buffer %d", len(pathBuffer)))
+		return
+	}
+	reparse.Name = utils.DecodeUTF16(pathBuffer[names.SubstituteNameOffset:nameEnd])
+	reparse.PrintName = utils.DecodeUTF16(pathBuffer[names.PrintNameOffset:printNameEnd])
+}
+
+func splitUTF16Strings(data []byte) []string {
+	var strs []string
+	start := 0
+	for idx := 0; idx+1 < len(data); idx += 2 {
+		if data[idx] == 0 && data[idx+1] == 0 {
+			strs = append(strs, utils.DecodeUTF16(data[start:idx]))
+			start = idx + 2
+		}
+	}
+	return strs
+}
+
+func (reparse Reparse) GetTagType() string {
+	if reparse.Tag&0xFFFF0FFF == 0x9000001A { // cloud files providers use the second nibble
+		return "Cloud Files"
+	}
+	tagType, ok := ReparseTags[reparse.Tag]
+	if ok {
+		return tagType
+	}
+	return fmt.Sprintf("%x", reparse.Tag)
+}
+
+func (reparse Reparse) IsLink() bool {
+	tagType := reparse.GetTagType()
+	return tagType == "Mount Point" || tagType == "Symbolic Link"
+}
+
+func (reparse Reparse) IsRelative() bool {
+	return reparse.GetTagType() == "Symbolic Link" && reparse.Flags&SymlinkRelative != 0
+}
+
+// target path within the volume without the NT namespace prefix and drive letter,
+// empty when it points to another volume
+func (reparse Reparse) GetVolumeTarget() string {
+	if reparse.IsRelative() {
+		return reparse.Name
+	}
+	target := strings.TrimPrefix(reparse.Name, "\\??\\")
+	if len(target) >= 2 && target[1] == ':' {
+		return strings.TrimPrefix(target[2:], "\\")
+	}
+	return ""
 }
 
 func (reparse Reparse) IsNoNResident() bool {
@@ -49,6 +208,30 @@ func (reparse Reparse) FindType() string {
 }
 
 func (reparse Reparse) ShowInfo() {
-	fmt.Printf("Type %s Target Name %s Print Name %s", reparse.FindType(),
-		reparse.Name, reparse.PrintName)
+	fmt.Printf("Type %s tag %s ", reparse.FindType(), reparse.GetTagType())
+
+	switch reparse.GetTagType() {
+	case "Mount Point", "Symbolic Link", "LX Symlink":
+		fmt.Printf("Target Name %s Print Name %s", reparse.Name, reparse.PrintName)
+		if reparse.IsRelative() {
+			fmt.Printf(" relative")
+		}
+	case "WOF":
+		if reparse.WofInfo != nil {
+			fmt.Printf("provider %s algorithm %s", WofProviders[reparse.WofInfo.Provider],
+				WofAlgorithms[reparse.WofInfo.Algorithm])
+		}
+	case "AppExecLink":
+		if reparse.AppExecLink != nil {
+			fmt.Printf("package %s app %s target %s", reparse.AppExecLink.PackageID,
+				reparse.AppExecLink.AppUserModelID, reparse.AppExecLink.TargetPath)
+		}
+	case "Cloud Files", "OneDrive":
+		fmt.Printf("placeholder provider %d data %d bytes", (reparse.Tag>>12)&0xF, len(reparse.Data))
+	case "Dedup":
+		fmt.Printf("content in chunk store, data %d bytes", len(reparse.Data))
+	default:
+		fmt.Printf("data %d bytes", len(reparse.Data))
+	}
+	fmt.Printf("\n")
 }
@@ -0,0 +1,346 @@
+package attributes
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aarsakian/FileSystemForensics/logger"
+	"github.com/aarsakian/FileSystemForensics/utils"
+)
+
+// $SDS stream keeps a mirror of each 256KB block in the following block
+const SDSBlockSize = 0x40000
+
+const (
+	SEDaclPresent = 0x0004
+	SESaclPresent = 0x0010
+)
+
+var AceTypes = map[uint8]string{
+	0: "Access Allowed", 1: "Access Denied", 2: "System Audit", 3: "System Alarm",
+	4: "Access Allowed Compound", 5: "Access Allowed Object", 6: "Access Denied Object",
+	7: "System Audit Object", 8: "System Alarm Object", 9: "Access Allowed Callback",
+	10: "Access Denied Callback", 11: "Access Allowed Callback Object",
+	12: "Access Denied Callback Object", 13: "System Audit Callback",
+	14: "System Alarm Callback", 15: "System Audit Callback Object",
+	16: "System Alarm Callback Object", 17: "System Mandatory Label",
+	18: "System Resource Attribute", 19: "System Scoped Policy ID",
+}
+
+var AceFlags = map[uint8]string{
+	0x01: "Object Inherit", 0x02: "Container Inherit", 0x04: "No Propagate Inherit",
+	0x08: "Inherit Only", 0x10: "Inherited", 0x40: "Successful Access", 0x80: "Failed Access",
+}
+
+var AccessRights = map[uint32]string{
+	0x00000001: "Read Data", 0x00000002: "Write Data", 0x00000004: "Append Data",
+	0x00000008: "Read EA", 0x00000010: "Write EA", 0x00000020: "Execute",
+	0x00000040: "Delete Child", 0x00000080: "Read Attributes", 0x00000100: "Write Attributes",
+	0x00010000: "Delete", 0x00020000: "Read Control", 0x00040000: "Write DAC",
+	0x00080000: "Write Owner", 0x00100000: "Synchronize", 0x01000000: "Access System Security",
+	0x10000000: "Generic All", 0x20000000: "Generic Execute", 0x40000000: "Generic Write",
+	0x80000000: "Generic Read",
+}
+
+var WellKnownSIDs = map[string]string{
+	"S-1-0-0": "Nobody", "S-1-1-0": "Everyone", "S-1-2-0": "Local", "S-1-3-0": "Creator Owner",
+	"S-1-3-1": "Creator Group", "S-1-5-2": "Network", "S-1-5-4": "Interactive",
+	"S-1-5-6": "Service", "S-1-5-7": "Anonymous", "S-1-5-11": "Authenticated Users",
+	"S-1-5-18": "SYSTEM", "S-1-5-19": "Local Service", "S-1-5-20": "Network Service",
+	"S-1-5-32-544": "Administrators", "S-1-5-32-545": "Users", "S-1-5-32-546": "Guests",
+	"S-1-5-32-547": "Power Users", "S-1-5-32-551": "Backup Operators",
+	"S-1-15-2-1": "All Application Packages", "S-1-15-2-2": "All Restricted Application Packages",
+	"S-1-16-4096": "Low Mandatory Level", "S-1-16-8192": "Medium Mandatory Level",
+	"S-1-16-12288": "High Mandatory Level", "S-1-16-16384": "System Mandatory Level",
+	"S-1-5-80-956008885-3418522649-1831038044-1853292631-2271478464": "TrustedInstaller",
+}
+
+// self relative security descriptor, offsets are from its start
+type SecurityDescriptor struct {
+	Revision    uint8
+	Sbz1        uint8
+	Control     uint16
+	OwnerOffset uint32
+	GroupOffset uint32
+	SaclOffset  uint32
+	DaclOffset  uint32
+	OwnerSID    string
+	GroupSID    string
+	SACL        *ACL
+	DACL        *ACL
+	Header      *AttributeHeader
+}
+
+type ACL struct {
+	Revision uint8
+	Sbz1     uint8
+	Size     uint16
+	AceCount uint16
+	Sbz2     uint16
+	Entries  []ACE
+}
+
+type ACE struct {
+	Type  uint8
+	Flags uint8
+	Size  uint16
+	Mask  uint32
+	SID   string
+}
+
+// $SDS entry header, followed by the security descriptor
+type SDSEntryHeader struct {
+	Hash   uint32
+	SecID  uint32
+	Offset uint64 //offset of the entry in $SDS
+	Length uint32 //including the header
+}
+
+func (secDescriptor *SecurityDescriptor) SetHeader(header *AttributeHeader) {
+	secDescriptor.Header = header
+}
+
+func (secDescriptor SecurityDescriptor) GetHeader() AttributeHeader {
+	return *secDescriptor.Header
+}
+
+func (secDescriptor SecurityDescriptor) FindType() string {
+	return secDescriptor.Header.GetType()
+}
+
+func (secDescriptor SecurityDescriptor) IsNoNResident() bool {
+	return secDescriptor.Header.IsNoNResident()
+}
+
+func (secDescriptor *SecurityDescriptor) Parse(data []byte) {
+	if len(data) < 20 {
+		logger.MFTExtractorlogger.Warning(fmt.Sprintf("Security descriptor data not enough %d", len(data)))
+		return
+	}
+	utils.Unmarshal(data[:20], secDescriptor)
+
+	if secDescriptor.OwnerOffset != 0 {
+		secDescriptor.OwnerSID, _ = parseSID(data, int(secDescriptor.OwnerOffset))
+	}
+	if secDescriptor.GroupOffset != 0 {
+		secDescriptor.GroupSID, _ = parseSID(data, int(secDescriptor.GroupOffset))
+	}
+	if secDescriptor.Control&SEDaclPresent != 0 && secDescriptor.DaclOffset != 0 {
+		secDescriptor.DACL = parseACL(data, int(secDescriptor.DaclOffset))
+	}
+	if secDescriptor.Control&SESaclPresent != 0 && secDescriptor.SaclOffset != 0 {
+		secDescriptor.SACL = parseACL(data, int(secDescriptor.SaclOffset))
+	}
+}
+
+// returns the SID string representation and its length
+func parseSID(data []byte, offset int) (string, int) {
+	if offset+8 > len(data) {
+		logger.MFTExtractorlogger.Warning(fmt.Sprintf("SID offset %d exceeds buffer %d", offset, len(data)))
+		return "", 0
+	}
+	revision := data[offset]
+	subAuthorityCount := int(data[offset+1])
+	sidLen := 8 + 4*subAuthorityCount
+	if offset+sidLen > len(data) {
+		logger.MFTExtractorlogger.Warning(fmt.Sprintf("SID sub authorities exceed buffer %d", len(data)))
+		return "", 0
+	}
+
+	authority := uint64(0) // 48 bit big endian
+	for _, val := range data[offset+2 : offset+8] {
+		authority = authority<<8 | uint64(val)
+	}
+
+	sid := fmt.Sprintf("S-%d-%d", revision, authority)
+	for idx := 0; idx < subAuthorityCount; idx++ {
+		sid += fmt.Sprintf("-%d", binary.LittleEndian.Uint32(data[offset+8+4*idx:]))
+	}
+	return sid, sidLen
+}
+
+func parseACL(data []byte, offset int) *ACL {
+	if offset+8 > len(data) {
+		logger.MFTExtractorlogger.Warning(fmt.Sprintf("ACL offset %d exceeds buffer %d", offset, len(data)))
+		return nil
+	}
+	acl := new(ACL)
+	utils.Unmarshal(data[offset:offset+8], acl)
+
+	aceOffset := offset + 8
+	for idx := 0; idx < int(acl.AceCount); idx++ {
+		if aceOffset+8 > len(data) {
+			logger.MFTExtractorlogger.Warning(fmt.Sprintf("ACE %d exceeds buffer %d", idx, len(data)))
+			break
+		}
+		var ace ACE
+		utils.Unmarshal(data[aceOffset:aceOffset+8], &ace)
+		if ace.Size < 8 || aceOffset+int(ace.Size) > len(data) {
+			logger.MFTExtractorlogger.Warning(fmt.Sprintf("ACE %d invalid size %d", idx, ace.Size))
+			break
+		}
+		ace.SID = parseACESID(data[aceOffset:aceOffset+int(ace.Size)], ace.Type)
+		acl.Entries = append(acl.Entries, ace)
+		aceOffset += int(ace.Size)
+	}
+	return acl
+}
+
+// object ACEs have flags and optional object type GUIDs before the SID
+func parseACESID(data []byte, aceType uint8) string {
+	sidOffset := 8
+	if strings.HasSuffix(AceTypes[aceType], "Object") {
+		if len(data) < 12 {
+			return ""
+		}
+		objectFlags := binary.LittleEndian.Uint32(data[8:12])
+		sidOffset = 12
+		if objectFlags&0x1 != 0 { //object type present
+			sidOffset += 16
+		}
+		if objectFlags&0x2 != 0 { //inherited object type present
+			sidOffset += 16
+		}
+	}
+	sid, _ := parseSID(data, sidOffset)
+	return sid
+}
+
+// security descriptors of $Secure:$SDS by security id found by scanning, when $SII is not available
+func ParseSDS(data []byte) map[uint32]*SecurityDescriptor {
+	secDescriptors := map[uint32]*SecurityDescriptor{}
+	offset := 0
+	for offset+20 <= len(data) {
+		if (offset/SDSBlockSize)%2 == 1 { // mirror block
+			offset = (offset/SDSBlockSize + 1) * SDSBlockSize
+			continue
+		}
+
+		var entryHeader SDSEntryHeader
+		utils.Unmarshal(data[offset:offset+20], &entryHeader)
+
+		if entryHeader.Length < 20 || entryHeader.Offset != uint64(offset) ||
+			offset+int(entryHeader.Length) > len(data) { // end of entries in block
+			offset = (offset/SDSBlockSize + 2) * SDSBlockSize
+			continue
+		}
+
+		_, ok := secDescriptors[entryHeader.SecID]
+		if !ok {
+			secDescriptor := new(SecurityDescriptor)
+			secDescriptor.Parse(data[offset+20 : offset+int(entryHeader.Length)])
+			secDescriptors[entryHeader.SecID] = secDescriptor
+		}
+
+		offset += (int(entryHeader.Length) + 15) &^ 15 // entries are 16 bytes aligned
+	}
+	return secDescriptors
+}
+
+// $SII view index is keyed by the security id, its data is the header of the $SDS entry
+func ParseSIIEntries(idxEntries IndexEntries) []SDSEntryHeader {
+	var entryHeaders []SDSEntryHeader
+	for _, idxEntry := range idxEntries {
+		data := idxEntry.Raw
+		if len(data) < 16 {
+			continue
+		}
+		dataOffset := int(binary.LittleEndian.Uint16(data[0:2]))
+		dataLen := int(binary.LittleEndian.Uint16(data[2:4]))
+		keyLen := int(binary.LittleEndian.Uint16(data[10:12]))
+		if keyLen != 4 || dataLen < 20 || dataOffset+20 > len(data) {
+			continue
+		}
+		var entryHeader SDSEntryHeader
+		utils.Unmarshal(data[dataOffset:dataOffset+20], &entryHeader)
+		if entryHeader.SecID != binary.LittleEndian.Uint32(data[16:20]) {
+			continue
+		}
+		entryHeaders = append(entryHeaders, entryHeader)
+	}
+	return entryHeaders
+}
+
+// descriptors located by the $SII entries, the $SDS entry must repeat the header of the index
+func ParseSDSByIndex(data []byte, entryHeaders []SDSEntryHeader) map[uint32]*SecurityDescriptor {
+	secDescriptors := map[uint32]*SecurityDescriptor{}
+	for _, entryHeader := range entryHeaders {
+		start, end := entryHeader.Offset, entryHeader.Offset+uint64(entryHeader.Length)
+		if entryHeader.Length < 20 || end > uint64(len(data)) {
+			logger.MFTExtractorlogger.Warning(fmt.Sprintf("security id %d $SDS entry at %d exceeds $SDS", entryHeader.SecID, start))
+			continue
+		}
+		var sdsHeader SDSEntryHeader
+		utils.Unmarshal(data[start:start+20], &sdsHeader)
+		if sdsHeader != entryHeader {
+			logger.MFTExtractorlogger.Warning(fmt.Sprintf("security id %d $SDS entry at %d differs from $SII", entryHeader.SecID, start))
+			continue
+		}
+		secDescriptor := new(SecurityDescriptor)
+		secDescriptor.Parse(data[start+20 : end])
+		secDescriptors[entryHeader.SecID] = secDescriptor
+	}
+	return secDescriptors
+}
+
+func GetSIDName(sid string) string {
+	name, ok := WellKnownSIDs[sid]
+	if ok {
+		return fmt.Sprintf("%s (%s)", sid, name)
+	}
+	return sid
+}
+
+func (ace ACE) GetType() string {
+	aceType, ok := AceTypes[ace.Type]
+	if ok {
+		return aceType
+	}
+	return fmt.Sprintf("%x", ace.Type)
+}
+
+func (ace ACE) GetFlags() string {
+	var flags []string
+	for flag, name := range AceFlags {
+		if ace.Flags&flag != 0 {
+			flags = append(flags, name)
+		}
+	}
+	sort.Strings(flags)
+	return strings.Join(flags, "|")
+}
+
+func (ace ACE) GetAccessRights() string {
+	var rights []string
+	for right, name := range AccessRights {
+		if ace.Mask&right != 0 {
+			rights = append(rights, name)
+		}
+	}
+	sort.Strings(rights)
+	return strings.Join(rights, "|")
+}
+
+func (ace ACE) ShowInfo() {
+	fmt.Printf("\t%s %s mask %x %s flags %s\n", ace.GetType(), GetSIDName(ace.SID),
+		ace.Mask, ace.GetAccessRights(), ace.GetFlags())
+}
+
+func (acl ACL) ShowInfo(aclType string) {
+	fmt.Printf("%s %d ACEs\n", aclType, acl.AceCount)
+	for _, ace := range acl.Entries {
+		ace.ShowInfo()
+	}
+}
+
+func (secDescriptor SecurityDescriptor) ShowInfo() {
+	fmt.Printf("owner %s group %s\n", GetSIDName(secDescriptor.OwnerSID), GetSIDName(secDescriptor.GroupSID))
+	if secDescriptor.DACL != nil {
+		secDescriptor.DACL.ShowInfo("DACL")
+	}
+	if secDescriptor.SACL != nil {
+		secDescriptor.SACL.ShowInfo("SACL")
+	}
+}
@@ -0,0 +1,67 @@
+package attributes
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// $SDS entry holding a descriptor owned by S-1-5-18
+func newSDSEntry(secID uint32, offset uint64) []byte {
+	entry := make([]byte, 52)
+	binary.LittleEndian.PutUint32(entry[4:8], secID)
+	binary.LittleEndian.PutUint64(entry[8:16], offset)
+	binary.LittleEndian.PutUint32(entry[16:20], 52)
+	entry[20] = 1                                        // revision
+	binary.LittleEndian.PutUint16(entry[22:24], 0x8000)  // self relative
+	binary.LittleEndian.PutUint32(entry[24:28], 20)      // owner offset
+	copy(entry[40:], []byte{1, 1, 0, 0, 0, 0, 0, 5, 18}) // S-1-5-18
+	return entry
+}
+
+// $SII entry keyed by secID pointing to the $SDS entry
+func newSIIEntry(secID uint32, offset uint64, length uint32) IndexEntry {
+	raw := make([]byte, 40)
+	binary.LittleEndian.PutUint16(raw[0:2], 20) // data offset
+	binary.LittleEndian.PutUint16(raw[2:4], 20) // data length
+	binary.LittleEndian.PutUint16(raw[8:10], 40)
+	binary.LittleEndian.PutUint16(raw[10:12], 4) // key length
+	binary.LittleEndian.PutUint32(raw[16:20], secID)
+	binary.LittleEndian.PutUint32(raw[24:28], secID)
+	binary.LittleEndian.PutUint64(raw[28:36], offset)
+	binary.LittleEndian.PutUint32(raw[36:40], length)
+	return IndexEntry{Raw: raw}
+}
+
+func TestParseSDSByIndex(t *testing.T) {
+	data := make([]byte, 128)
+	copy(data, newSDSEntry(256, 0))
+	copy(data[64:], newSDSEntry(257, 64))
+
+	idxEntries := IndexEntries{
+		newSIIEntry(256, 0, 52),
+		newSIIEntry(257, 0, 52),   // $SDS entry at 0 belongs to 256
+		newSIIEntry(258, 112, 52), // exceeds $SDS
+	}
+	entryHeaders := ParseSIIEntries(idxEntries)
+	if len(entryHeaders) != 3 {
+		t.Fatalf("expected 3 $SII entries got %d", len(entryHeaders))
+	}
+
+	secDescriptors := ParseSDSByIndex(data, entryHeaders)
+	if len(secDescriptors) != 1 {
+		t.Fatalf("expected 1 descriptor got %d", len(secDescriptors))
+	}
+	secDescriptor, ok := secDescriptors[256]
+	if !ok || secDescriptor.OwnerSID != "S-1-5-18" {
+		t.Errorf("security id 256 not resolved to owner S-1-5-18 %+v", secDescriptor)
+	}
+}
+
+// entries whose key is not a security id are not $SII entries
+func TestParseSIIEntriesKey(t *testing.T) {
+	idxEntry := newSIIEntry(256, 0, 52)
+	binary.LittleEndian.PutUint32(idxEntry.Raw[16:20], 300)
+	if entryHeaders := ParseSIIEntries(IndexEntries{idxEntry, {Raw: idxEntry.Raw[:12]}}); len(entryHeaders) != 0 {
+		t.Errorf("expected no $SII entries got %+v", entryHeaders)
+	}
+}
@@ -1,12 +1,24 @@
 package attributes
 
-import "github.com/aarsakian/FileSystemForensics/utils"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aarsakian/FileSystemForensics/utils"
+)
 
 type VolumeName struct {
 	Name   utils.NoNull
 	Header *AttributeHeader
 }
 
+// VolumeInfo flags
+var VolumeFlags = map[uint16]string{
+	0x0001: "Dirty", 0x0002: "Resize LogFile", 0x0004: "Upgrade on mount",
+	0x0008: "Mounted on NT4", 0x0010: "Delete USN underway", 0x0020: "Repair object IDs",
+	0x8000: "Modified by chkdsk",
+}
+
 type VolumeInfo struct {
 	F1     uint64 //unused
 	MajVer uint8  // 8-8
@@ -37,7 +49,26 @@ func (volInfo VolumeInfo) FindType() string {
 }
 
 func (volinfo VolumeInfo) ShowInfo() {
+	fmt.Printf("version %s flags %s\n", volinfo.GetVersion(), strings.Join(volinfo.GetFlags(), ", "))
+}
 
+func (volInfo VolumeInfo) GetVersion() string {
+	return fmt.Sprintf("%d.%d", volInfo.MajVer, volInfo.MinVer)
+}
+
+func (volInfo VolumeInfo) GetFlags() []string {
+	var flags []string
+	for _, flag := range []uint16{0x0001, 0x0002, 0x0004, 0x0008, 0x0010, 0x0020, 0x8000} {
+		if volInfo.Flags&flag != 0 {
+			flags = append(flags, VolumeFlags[flag])
+		}
+	}
+	return flags
+}
+
+// set when the volume was not cleanly unmounted, chkdsk runs at next boot
+func (volInfo VolumeInfo) IsDirty() bool {
+	return volInfo.Flags&0x0001 != 0
 }
 
 func (volName *VolumeName) SetHeader(header *AttributeHeader) {
@@ -49,7 +80,7 @@ func (volName VolumeName) GetHeader() AttributeHeader {
 }
 
 func (volName *VolumeName) Parse(data []byte) {
-	volName.Name = utils.NoNull(data)
+	volName.Name = utils.NoNull(utils.DecodeUTF16(data))
 
 }
 
@@ -62,5 +93,5 @@ func (volName VolumeName) IsNoNResident() bool {
 }
 
 func (volName VolumeName) ShowInfo() {
-
+	fmt.Printf("volume name %s\n", volName.Name)
 }
@@ -0,0 +1,109 @@
+package MFT
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/aarsakian/FileSystemForensics/logger"
+)
+
+const SectorSize = 512
+
+// identifies the same record version found more than once
+type carvedKey struct {
+	entry uint32
+	seq   uint16
+	lsn   uint64
+}
+
+// scans sector aligned positions for records passing signature, fixup and attribute chain validation
+func CarveRecords(data []byte) Records {
+	var records Records
+	for offset := 0; offset+RecordSize <= len(data); offset += SectorSize {
+		if string(data[offset:offset+4]) != "FILE" || !isValidRecord(data[offset:offset+RecordSize]) {
+			continue
+		}
+
+		buf := make([]byte, RecordSize) // processing restores fixups in place
+		copy(buf, data[offset:offset+RecordSize])
+		var record Record
+		err := record.Process(buf)
+		if err != nil {
+			logger.MFTExtractorlogger.Warning(fmt.Sprintf("carved record %s", err))
+			continue
+		}
+		record.Carved = true
+		records = append(records, record)
+		offset += RecordSize - SectorSize
+	}
+	return records
+}
+
+// removes records carved more than once e.g. from copies of the same area
+func (records Records) Deduplicate() Records {
+	seen := map[carvedKey]bool{}
+	var uniqueRecords Records
+	for _, record := range records {
+		key := carvedKey{entry: record.Entry, seq: record.Seq, lsn: record.Lsn}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		uniqueRecords = append(uniqueRecords, record)
+	}
+	return uniqueRecords
+}
+
+func isValidRecord(data []byte) bool {
+	fixupOffset := int(binary.LittleEndian.Uint16(data[4:6]))
+	fixupCount := int(binary.LittleEndian.Uint16(data[6:8]))
+	attrOffset := int(binary.LittleEndian.Uint16(data[20:22]))
+	usedSize := int(binary.LittleEndian.Uint32(data[24:28]))
+	allocSize := int(binary.LittleEndian.Uint32(data[28:32]))
+
+	if allocSize != RecordSize || usedSize > allocSize || fixupCount != RecordSize/SectorSize+1 ||
+		fixupOffset < 0x28 || fixupOffset+2*fixupCount > attrOffset || attrOffset%8 != 0 ||
+		attrOffset+4 > usedSize {
+		return false
+	}
+
+	// last two bytes of each sector hold the update sequence number
+	for sector := 1; sector < fixupCount; sector++ {
+		if data[sector*SectorSize-2] != data[fixupOffset] || data[sector*SectorSize-1] != data[fixupOffset+1] {
+			return false
+		}
+	}
+
+	for offset := attrOffset; ; {
+		if offset+8 > usedSize {
+			return false
+		}
+		if binary.LittleEndian.Uint32(data[offset:offset+4]) == 0xFFFFFFFF {
+			return true
+		}
+		attrLen := int(binary.LittleEndian.Uint32(data[offset+4 : offset+8]))
+		if attrLen < 24 || attrLen%8 != 0 || offset+attrLen > usedSize {
+			return false
+		}
+		nameLen := int(data[offset+9])
+		nameOffset := int(binary.LittleEndian.Uint16(data[offset+10 : offset+12]))
+		if nameLen > 0 && nameOffset+2*nameLen > attrLen {
+			return false
+		}
+		if data[offset+8] == 0 { // resident content must fit in the attribute
+			contentLen := int(binary.LittleEndian.Uint32(data[offset+16 : offset+20]))
+			contentOffset := int(binary.LittleEndian.Uint16(data[offset+20 : offset+22]))
+			if contentOffset+contentLen > attrLen {
+				return false
+			}
+		} else if attrLen < 64 || int(binary.LittleEndian.Uint16(data[offset+32:offset+34])) > attrLen {
+			return false
+		}
+		offset += attrLen
+	}
+}
+
+func (record Record) ShowCarvedInfo() {
+	fmt.Printf("carved record %d seq %d type %s name %s\n", record.Entry, record.Seq, record.getType(),
+		record.GetFname())
+}
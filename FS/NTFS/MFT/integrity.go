@@ -0,0 +1,104 @@
+package MFT
+
+import (
+	"fmt"
+
+	MFTAttributes "github.com/aarsakian/FileSystemForensics/FS/NTFS/MFT/attributes"
+)
+
+// entries below it are reserved for metadata files
+const FirstUserEntry = 16
+
+type IntegrityIssue struct {
+	Entry  uint32
+	Check  string
+	Detail string
+}
+
+func (issue IntegrityIssue) ShowInfo() {
+	fmt.Printf("entry %d %s: %s\n", issue.Entry, issue.Check, issue.Detail)
+}
+
+func (record Record) IsInUse() bool {
+	return record.Flags&0x01 != 0
+}
+
+// cross checks the $MFT bitmap, sequence numbers and base references of the records, all entries must be processed
+func (mfttable MFTTable) ValidateRecords() []IntegrityIssue {
+	var issues []IntegrityIssue
+	if len(mfttable.Records) == 0 {
+		return issues
+	}
+
+	var allocationStatus []byte
+	attr := mfttable.Records[0].FindAttribute("BitMap")
+	if attr != nil {
+		allocationStatus = attr.(*MFTAttributes.BitMap).AllocationStatus
+	} else {
+		issues = append(issues, IntegrityIssue{Entry: 0, Check: "bitmap", Detail: "$MFT has no $BITMAP attribute"})
+	}
+
+	for idx, record := range mfttable.Records {
+		entry := uint32(idx)
+		valid := record.GetSignature() == "FILE"
+
+		if allocationStatus != nil && idx/8 < len(allocationStatus) {
+			allocated := allocationStatus[idx/8]&(1<<(idx%8)) != 0
+			if allocated && !valid {
+				issues = append(issues, IntegrityIssue{Entry: entry, Check: "bitmap",
+					Detail: "allocated in $MFT:$BITMAP without a valid record"})
+			} else if valid && allocated != record.IsInUse() {
+				issues = append(issues, IntegrityIssue{Entry: entry, Check: "bitmap",
+					Detail: fmt.Sprintf("$MFT:$BITMAP allocated %t record in use %t", allocated, record.IsInUse())})
+			}
+		}
+
+		if !valid || !record.IsInUse() {
+			continue
+		}
+
+		if record.Seq == 0 {
+			issues = append(issues, IntegrityIssue{Entry: entry, Check: "sequence", Detail: "in use with sequence 0"})
+		} else if entry < FirstUserEntry && record.BaseRef == 0 && record.GetFname() != "-" {
+			expectedSeq := uint16(entry) // metadata files keep their entry number, $MFT starts at 1
+			if entry == 0 {
+				expectedSeq = 1
+			}
+			if record.Seq != expectedSeq {
+				issues = append(issues, IntegrityIssue{Entry: entry, Check: "sequence",
+					Detail: fmt.Sprintf("metadata file %s sequence %d expected %d", record.GetFname(), record.Seq, expectedSeq)})
+			}
+		}
+
+		if record.BaseRef != 0 {
+			issues = append(issues, mfttable.validateBaseReference(record)...)
+		}
+	}
+	return issues
+}
+
+// extension records point to a base record in use, of the same sequence, that holds an attribute list
+func (mfttable MFTTable) validateBaseReference(record Record) []IntegrityIssue {
+	baseEntry := record.BaseRef & 0xFFFFFFFFFFFF
+	baseSeq := uint16(record.BaseRef >> 48)
+
+	if baseEntry >= uint64(len(mfttable.Records)) || mfttable.Records[baseEntry].GetSignature() != "FILE" {
+		return []IntegrityIssue{{Entry: record.Entry, Check: "base reference",
+			Detail: fmt.Sprintf("base entry %d not found", baseEntry)}}
+	}
+	baseRecord := mfttable.Records[baseEntry]
+	var issues []IntegrityIssue
+	if !baseRecord.IsInUse() {
+		issues = append(issues, IntegrityIssue{Entry: record.Entry, Check: "base reference",
+			Detail: fmt.Sprintf("base entry %d not in use", baseEntry)})
+	}
+	if baseRecord.Seq != baseSeq {
+		issues = append(issues, IntegrityIssue{Entry: record.Entry, Check: "base reference",
+			Detail: fmt.Sprintf("base entry %d sequence %d referenced %d", baseEntry, baseRecord.Seq, baseSeq)})
+	}
+	if !baseRecord.HasAttr("Attribute List") {
+		issues = append(issues, IntegrityIssue{Entry: record.Entry, Check: "base reference",
+			Detail: fmt.Sprintf("base entry %d has no attribute list", baseEntry)})
+	}
+	return issues
+}
@@ -0,0 +1,84 @@
+package MFT
+
+import (
+	"fmt"
+
+	MFTAttributes "github.com/aarsakian/FileSystemForensics/FS/NTFS/MFT/attributes"
+	"github.com/aarsakian/FileSystemForensics/logger"
+	"github.com/aarsakian/FileSystemForensics/utils"
+)
+
+// entries of the $O index, in the root and in the allocation
+func (record Record) GetObjIdEntries() []MFTAttributes.ObjIdEntry {
+	var idxEntries MFTAttributes.IndexEntries
+	indexAttr := record.findNamedAttribute("Index Root", "$O")
+	if indexAttr != nil {
+		idxEntries = append(idxEntries, indexAttr.(*MFTAttributes.IndexRoot).IndexEntries...)
+	}
+	indexAlloc := record.findNamedAttribute("Index Allocation", "$O")
+	if indexAlloc != nil {
+		idxEntries = append(idxEntries, indexAlloc.(*MFTAttributes.IndexAllocation).IndexEntries...)
+	}
+	return MFTAttributes.ParseObjIdEntries(idxEntries)
+}
+
+// distributed link tracking, maps object ids of $Extend\$ObjId:$O to the records they identify
+func (mfttable *MFTTable) ResolveObjectIDs() {
+	objIdRecords := utils.Filter(mfttable.Records, func(record Record) bool {
+		return record.GetFname() == "$ObjId"
+	})
+	if len(objIdRecords) == 0 {
+		logger.MFTExtractorlogger.Warning("$ObjId record not found.")
+		return
+	}
+
+	objIdEntries := objIdRecords[0].GetObjIdEntries()
+	logger.MFTExtractorlogger.Info(fmt.Sprintf("found %d object ids in $ObjId:$O", len(objIdEntries)))
+
+	for idx := range objIdEntries {
+		record, err := mfttable.GetRecord(uint32(objIdEntries[idx].ParRef), objIdEntries[idx].ParSeq)
+		if err != nil {
+			continue
+		}
+		record.ObjIdEntry = &objIdEntries[idx]
+	}
+}
+
+func (record Record) GetObjectID() *MFTAttributes.ObjectID {
+	attr := record.FindAttribute("Object ID")
+	if attr == nil {
+		return nil
+	}
+	return attr.(*MFTAttributes.ObjectID)
+}
+
+// object id or birth object id, as found in LNK files
+func (record Record) HasObjectID(guid string) bool {
+	var guids [][16]byte
+	objectId := record.GetObjectID()
+	if objectId != nil {
+		guids = append(guids, objectId.ObjGUID, objectId.OrigObjGUID)
+	}
+	if record.ObjIdEntry != nil {
+		guids = append(guids, record.ObjIdEntry.ObjGUID, record.ObjIdEntry.OrigObjGUID)
+	}
+	guid = MFTAttributes.NormalizeGUID(guid)
+	for _, candidate := range guids {
+		if candidate != [16]byte{} && utils.StringifyGUID(candidate[:]) == guid {
+			return true
+		}
+	}
+	return false
+}
+
+func (record Record) ShowObjectID() {
+	objectId := record.GetObjectID()
+	if objectId != nil {
+		fmt.Printf("%d %s ", record.Entry, record.GetFname())
+		objectId.ShowInfo()
+	}
+	if record.ObjIdEntry != nil {
+		fmt.Printf("%d %s $ObjId:$O ", record.Entry, record.GetFname())
+		record.ObjIdEntry.ShowInfo()
+	}
+}
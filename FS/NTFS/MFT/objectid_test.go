@@ -0,0 +1,44 @@
+package MFT
+
+import (
+	"encoding/binary"
+	"testing"
+
+	MFTAttributes "github.com/aarsakian/FileSystemForensics/FS/NTFS/MFT/attributes"
+)
+
+// $O entry keyed by the object id with the file reference in its data
+func newObjIdEntry(guidByte byte, entry uint64) MFTAttributes.IndexEntry {
+	raw := make([]byte, 32+56)
+	binary.LittleEndian.PutUint16(raw[0:2], 32)
+	binary.LittleEndian.PutUint16(raw[2:4], 56)
+	binary.LittleEndian.PutUint16(raw[10:12], 16)
+	raw[16] = guidByte
+	binary.LittleEndian.PutUint64(raw[32:40], entry|1<<48)
+	return MFTAttributes.IndexEntry{Raw: raw}
+}
+
+// the second index buffer was freed, its entries are stale
+func TestGetObjIdEntriesAppliesBitmap(t *testing.T) {
+	nodeheader := &MFTAttributes.NodeHeader{OffsetEndEntryListBuffer: 4096 - 24}
+	liveEntry, staleEntry := newObjIdEntry(1, 40), newObjIdEntry(2, 41)
+	indexAlloc := &MFTAttributes.IndexAllocation{
+		Header: &MFTAttributes.AttributeHeader{Type: [4]byte{0xa0}, NoNResident: 1,
+			ATRrecordNoNResident: &MFTAttributes.ATRrecordNoNResident{Name: "$O"}},
+		Buffers: []MFTAttributes.IndexBuffer{
+			{Nodeheader: nodeheader, Offset: 0, InUse: true, IndexEntries: MFTAttributes.IndexEntries{liveEntry}},
+			{Nodeheader: nodeheader, Offset: 4096, InUse: true, IndexEntries: MFTAttributes.IndexEntries{staleEntry}},
+		},
+		IndexEntries: MFTAttributes.IndexEntries{liveEntry, staleEntry}, // as parsed before the bitmap
+	}
+	bitmap := &MFTAttributes.BitMap{AllocationStatus: []byte{0x01},
+		Header: &MFTAttributes.AttributeHeader{Type: [4]byte{0xb0},
+			ATRrecordResident: &MFTAttributes.ATRrecordResident{Name: "$O"}}}
+	record := Record{Entry: 25, Attributes: []Attribute{indexAlloc, bitmap}}
+
+	record.ApplyIndexBitmap()
+	objIdEntries := record.GetObjIdEntries()
+	if len(objIdEntries) != 1 || objIdEntries[0].ParRef != 40 {
+		t.Errorf("object ids %v", objIdEntries)
+	}
+}
@@ -0,0 +1,181 @@
+package MFT
+
+import (
+	"fmt"
+	"sort"
+
+	MFTAttributes "github.com/aarsakian/FileSystemForensics/FS/NTFS/MFT/attributes"
+	"github.com/aarsakian/FileSystemForensics/logger"
+	"github.com/aarsakian/FileSystemForensics/utils"
+)
+
+const FullyRecoverable = "fully recoverable"
+
+const PartiallyOverwritten = "partially overwritten"
+
+const Lost = "lost"
+
+// short names used to select records by recoverability
+var RecoverabilityStatuses = map[string]string{
+	"full": FullyRecoverable, "partial": PartiallyOverwritten, "lost": Lost,
+}
+
+// clusters of a deleted file reused by allocated records or marked in use by $Bitmap
+type Recoverability struct {
+	Clusters    uint64
+	Claimed     uint64 //by data runs of allocated records
+	Overwritten uint64 //claimed or marked in use
+	Status      string
+}
+
+// absolute cluster runs of non resident attributes including those of linked records, sparse runs occupy no clusters
+func (record Record) GetClusterRuns() []MFTAttributes.ClusterRun {
+	var runs []MFTAttributes.ClusterRun
+	records := []*Record{&record}
+	records = append(records, record.LinkedRecords...)
+
+	for _, record := range records {
+		for _, attribute := range record.Attributes {
+			if !attribute.IsNoNResident() || attribute.GetHeader().ATRrecordNoNResident.RunList == nil {
+				continue
+			}
+			runlist := *attribute.GetHeader().ATRrecordNoNResident.RunList
+			offset := int64(0)
+			for (MFTAttributes.RunList{}) != runlist {
+				offset += runlist.Offset
+				if !runlist.IsSparse() && runlist.Length > 0 {
+					runs = append(runs, MFTAttributes.ClusterRun{Start: int(offset), Length: int(runlist.Length)})
+				}
+				if runlist.Next == nil {
+					break
+				}
+				runlist = *runlist.Next
+			}
+		}
+	}
+	return runs
+}
+
+// compares data runs of deleted records against allocated records and the volume bitmap, bitmap may be nil
+func (mfttable *MFTTable) AssessRecoverability(bitmap []byte) {
+	var claimedRuns []MFTAttributes.ClusterRun
+	for _, record := range mfttable.Records {
+		if record.IsDeleted() || record.OriginLinkedRecord != nil {
+			continue
+		}
+		claimedRuns = append(claimedRuns, record.GetClusterRuns()...)
+	}
+	claimedRuns = mergeRuns(claimedRuns)
+
+	for idx := range mfttable.Records {
+		record := &mfttable.Records[idx]
+		if !record.IsDeleted() || record.OriginLinkedRecord != nil {
+			continue
+		}
+		recoverability := &Recoverability{}
+		for _, run := range record.GetClusterRuns() {
+			recoverability.Clusters += uint64(run.Length)
+			claimed, overwritten := countOverwritten(run, claimedRuns, bitmap)
+			recoverability.Claimed += claimed
+			recoverability.Overwritten += overwritten
+		}
+
+		if recoverability.Overwritten == 0 { // resident data stays in the record
+			recoverability.Status = FullyRecoverable
+		} else if recoverability.Overwritten < recoverability.Clusters {
+			recoverability.Status = PartiallyOverwritten
+		} else {
+			recoverability.Status = Lost
+		}
+		record.Recoverability = recoverability
+	}
+	logger.MFTExtractorlogger.Info(fmt.Sprintf("assessed recoverability against %d claimed runs", len(claimedRuns)))
+}
+
+// sorted runs with overlapping and adjacent ones joined
+func mergeRuns(runs []MFTAttributes.ClusterRun) []MFTAttributes.ClusterRun {
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].Start < runs[j].Start
+	})
+	var merged []MFTAttributes.ClusterRun
+	for _, run := range runs {
+		last := len(merged) - 1
+		if last >= 0 && run.Start <= merged[last].Start+merged[last].Length {
+			if run.Start+run.Length > merged[last].Start+merged[last].Length {
+				merged[last].Length = run.Start + run.Length - merged[last].Start
+			}
+			continue
+		}
+		merged = append(merged, run)
+	}
+	return merged
+}
+
+// clusters of the run within claimed runs, and those either claimed or set in the bitmap
+func countOverwritten(run MFTAttributes.ClusterRun, claimedRuns []MFTAttributes.ClusterRun, bitmap []byte) (uint64, uint64) {
+	var claimed, overwritten uint64
+	runEnd := run.Start + run.Length
+	pos := run.Start
+
+	first := sort.Search(len(claimedRuns), func(i int) bool {
+		return claimedRuns[i].Start+claimedRuns[i].Length > run.Start
+	})
+	for _, claimedRun := range claimedRuns[first:] {
+		if claimedRun.Start >= runEnd {
+			break
+		}
+		if claimedRun.Start > pos {
+			overwritten += countUsed(bitmap, pos, claimedRun.Start)
+			pos = claimedRun.Start
+		}
+		claimedEnd := claimedRun.Start + claimedRun.Length
+		if claimedEnd > runEnd {
+			claimedEnd = runEnd
+		}
+		claimed += uint64(claimedEnd - pos)
+		pos = claimedEnd
+	}
+	overwritten += claimed + countUsed(bitmap, pos, runEnd)
+	return claimed, overwritten
+}
+
+// clusters set in the bitmap, those beyond it cannot be recovered
+func countUsed(bitmap []byte, start int, end int) uint64 {
+	if bitmap == nil {
+		return 0
+	}
+	var used uint64
+	for cluster := start; cluster < end; cluster++ {
+		if cluster/8 >= len(bitmap) || bitmap[cluster/8]&(1<<(cluster%8)) != 0 {
+			used++
+		}
+	}
+	return used
+}
+
+func (record Record) HasRecoverability(statuses []string) bool {
+	if record.Recoverability == nil {
+		return false
+	}
+	for _, status := range statuses {
+		if RecoverabilityStatuses[status] == record.Recoverability.Status {
+			return true
+		}
+	}
+	return false
+}
+
+func (records Records) FilterByRecoverability(statuses []string) []Record {
+	return utils.Filter(records, func(record Record) bool {
+		return record.HasRecoverability(statuses)
+	})
+}
+
+func (record Record) ShowRecoverability() {
+	if record.Recoverability == nil {
+		return
+	}
+	recoverability := record.Recoverability
+	fmt.Printf("%d %s %s clusters %d claimed %d overwritten %d\n", record.Entry, record.GetFname(),
+		recoverability.Status, recoverability.Clusters, recoverability.Claimed, recoverability.Overwritten)
+}
@@ -0,0 +1,145 @@
+package MFT
+
+import (
+	"fmt"
+	"sort"
+
+	MFTAttributes "github.com/aarsakian/FileSystemForensics/FS/NTFS/MFT/attributes"
+	"github.com/aarsakian/FileSystemForensics/utils"
+)
+
+// $Extend\$RmMetadata, the resource manager of transactional NTFS, its files are located and sized,
+// $Tops:$T and the CLFS records of $TxfLog are not parsed
+type RmMetadata struct {
+	Record   *Record
+	Tops     *Record //metadata of the resource manager, $T holds the transaction outcomes
+	TxfLog   *Record //directory of the CLFS log
+	LogFiles Records //base log file and containers
+	Txf      *Record //holds files deleted by transactions not yet committed
+	Pending  []*Record
+}
+
+func (record Record) GetTXFDATA() *MFTAttributes.TXFDATA {
+	for _, attribute := range record.Attributes {
+		loggedUtility, ok := attribute.(*MFTAttributes.LoggedUtilityStream)
+		if ok && loggedUtility.TXFDATA != nil {
+			return loggedUtility.TXFDATA
+		}
+	}
+	return nil
+}
+
+// $Txf is a child of $RmMetadata
+func (record Record) IsTxfPending() bool {
+	return record.Parent != nil && record.Parent.GetFname() == "$Txf" &&
+		record.Parent.Parent != nil && record.Parent.Parent.GetFname() == "$RmMetadata"
+}
+
+func (record Record) IsTransacted() bool {
+	return record.GetTXFDATA() != nil || record.IsTxfPending()
+}
+
+func (record Record) getStreamSize(streamName string) int64 {
+	attr := record.findStream(streamName)
+	if attr != nil && !attr.IsNoNResident() {
+		return int64(len(attr.(*MFTAttributes.DATA).Content))
+	}
+	extents := record.GetStreamExtents(streamName)
+	if len(extents) == 0 {
+		return 0
+	}
+	return int64(extents[0].ATRrecordNoNResident.ActualLength)
+}
+
+func (record Record) ShowTxF() {
+	txfData := record.GetTXFDATA()
+	if txfData != nil {
+		fmt.Printf("%d %s %s\n", record.Entry, record.GetFname(), txfData.GetInfo())
+	}
+	if record.IsTxfPending() {
+		fmt.Printf("%d %s pending in $Txf, deleted by a transaction not yet committed\n", record.Entry, record.GetFname())
+	}
+}
+
+// located by the parents of the $Extend records
+func (records Records) GetRmMetadata() *RmMetadata {
+	var rmMetadata RmMetadata
+	for idx := range records {
+		record := &records[idx]
+		if record.GetFname() == "$RmMetadata" && record.Parent != nil && record.Parent.GetFname() == "$Extend" {
+			rmMetadata.Record = record
+		}
+	}
+	if rmMetadata.Record == nil {
+		return nil
+	}
+
+	for idx := range records {
+		record := &records[idx]
+		if record.Parent == nil {
+			continue
+		}
+		if record.Parent.Entry == rmMetadata.Record.Entry {
+			switch record.GetFname() {
+			case "$Tops":
+				rmMetadata.Tops = record
+			case "$TxfLog":
+				rmMetadata.TxfLog = record
+			case "$Txf":
+				rmMetadata.Txf = record
+			}
+		} else if record.IsTxfPending() {
+			rmMetadata.Pending = append(rmMetadata.Pending, record)
+		}
+	}
+
+	if rmMetadata.TxfLog != nil {
+		rmMetadata.LogFiles = utils.Filter(records, func(record Record) bool {
+			return record.Parent != nil && record.Parent.Entry == rmMetadata.TxfLog.Entry
+		})
+	}
+	return &rmMetadata
+}
+
+func (rmMetadata RmMetadata) ShowInfo() {
+	fmt.Printf("$RmMetadata entry %d\n", rmMetadata.Record.Entry)
+	if rmMetadata.Tops != nil {
+		fmt.Printf("$Tops entry %d size %d $T size %d\n", rmMetadata.Tops.Entry,
+			rmMetadata.Tops.GetLogicalFileSize(), rmMetadata.Tops.getStreamSize("$T"))
+	}
+	for _, logFile := range rmMetadata.LogFiles {
+		fmt.Printf("$TxfLog\\%s entry %d size %d\n", logFile.GetFname(), logFile.Entry, logFile.GetLogicalFileSize())
+	}
+	for _, record := range rmMetadata.Pending {
+		fmt.Printf("$Txf\\%s entry %d pending\n", record.GetFname(), record.Entry)
+	}
+}
+
+// the TxF file id identifies a file within the resource manager, not a transaction
+func (records Records) GroupByTxFFileId() map[uint64]Records {
+	recordsPerTxId := map[uint64]Records{}
+	for _, record := range records {
+		txfData := record.GetTXFDATA()
+		if txfData == nil {
+			continue
+		}
+		recordsPerTxId[txfData.TxId] = append(recordsPerTxId[txfData.TxId], record)
+	}
+	return recordsPerTxId
+}
+
+func (records Records) ShowTxFFiles() {
+	recordsPerTxId := records.GroupByTxFFileId()
+	txIds := make([]uint64, 0, len(recordsPerTxId))
+	for txId := range recordsPerTxId {
+		txIds = append(txIds, txId)
+	}
+	sort.Slice(txIds, func(i, j int) bool { return txIds[i] < txIds[j] })
+
+	for _, txId := range txIds {
+		fmt.Printf("TxF file id %d files %d\n", txId, len(recordsPerTxId[txId]))
+		for _, record := range recordsPerTxId[txId] {
+			fmt.Printf("\t%d %s\n", record.Entry, record.GetFname())
+		}
+	}
+}
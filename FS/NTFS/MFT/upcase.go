@@ -0,0 +1,90 @@
+package MFT
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/aarsakian/FileSystemForensics/img"
+	"github.com/aarsakian/FileSystemForensics/logger"
+	"github.com/aarsakian/FileSystemForensics/utils"
+)
+
+const UpCaseEntry = 10
+
+// one upper case UTF-16 code unit for every code unit
+const UpCaseSize = 65536
+
+// NTFS compares names by the upper case of their UTF-16 code units as mapped by $UpCase
+type UpCase []uint16
+
+// simple case mapping of the BMP, used when $UpCase is not available
+var DefaultUpCase = newDefaultUpCase()
+
+func newDefaultUpCase() UpCase {
+	upcase := make(UpCase, UpCaseSize)
+	for idx := range upcase {
+		upper := unicode.ToUpper(rune(idx))
+		if upper > 0xffff || utf16.IsSurrogate(rune(idx)) {
+			upper = rune(idx)
+		}
+		upcase[idx] = uint16(upper)
+	}
+	return upcase
+}
+
+func ParseUpCase(data []byte) UpCase {
+	if len(data) < 2*UpCaseSize {
+		logger.MFTExtractorlogger.Warning(fmt.Sprintf("$UpCase size %d less than %d", len(data), 2*UpCaseSize))
+		return nil
+	}
+	upcase := make(UpCase, UpCaseSize)
+	for idx := range upcase {
+		upcase[idx] = binary.LittleEndian.Uint16(data[2*idx:])
+	}
+	return upcase
+}
+
+func (upcase UpCase) ToUpper(name string) string {
+	units := utf16.Encode([]rune(name))
+	for idx, unit := range units {
+		units[idx] = upcase[unit]
+	}
+	return string(utf16.Decode(units))
+}
+
+func (upcase UpCase) Equal(name string, other string) bool {
+	return name == other || upcase.ToUpper(name) == upcase.ToUpper(other)
+}
+
+func (upcase UpCase) HasSuffix(name string, suffix string) bool {
+	return strings.HasSuffix(upcase.ToUpper(name), upcase.ToUpper(suffix))
+}
+
+// names of every record are compared by the $UpCase table of the volume
+func (mfttable *MFTTable) ResolveUpCase(hD img.DiskReader, partitionOffsetB int64, clusterSizeB int64) {
+	upcaseRecords := utils.Filter(mfttable.Records, func(record Record) bool {
+		return record.Entry == UpCaseEntry && record.GetFname() == "$UpCase"
+	})
+	if len(upcaseRecords) == 0 {
+		logger.MFTExtractorlogger.Warning("$UpCase record not found, using the default case mapping.")
+		return
+	}
+
+	upcase := ParseUpCase(upcaseRecords[0].ReadStream(hD, partitionOffsetB, clusterSizeB, ""))
+	if upcase == nil {
+		return
+	}
+	for idx := range mfttable.Records {
+		mfttable.Records[idx].UpCase = upcase
+	}
+}
+
+func (record Record) getUpCase() UpCase {
+	if record.UpCase != nil {
+		return record.UpCase
+	}
+	return DefaultUpCase
+}
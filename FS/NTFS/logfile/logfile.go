@@ -0,0 +1,286 @@
+package LogFile
+
+/*$LogFile keeps redo and undo information of metadata transactions,
+two restart pages are followed by two buffer pages and the circular area of log record pages*/
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/aarsakian/FileSystemForensics/FS/NTFS/MFT"
+	"github.com/aarsakian/FileSystemForensics/disk"
+	"github.com/aarsakian/FileSystemForensics/logger"
+	"github.com/aarsakian/FileSystemForensics/utils"
+)
+
+const SectorSize = 512
+
+const RecordHeaderLength = 0x30
+
+const FirstLogPage = 4 // after restart and buffer pages
+
+type LogFile struct {
+	RestartPage *RestartPageHeader
+	RestartArea *RestartArea
+	Clients     []ClientRecord
+	Records     Records
+}
+
+type RestartPageHeader struct {
+	Signature      [4]byte //RSTR or CHKD
+	UsaOffset      uint16
+	UsaCount       uint16
+	ChkDskLsn      uint64
+	SystemPageSize uint32
+	LogPageSize    uint32
+	RestartOffset  uint16
+	MinorVersion   uint16
+	MajorVersion   uint16
+}
+
+type RestartArea struct {
+	CurrentLsn            uint64
+	LogClients            uint16
+	ClientFreeList        uint16
+	ClientInUseList       uint16
+	Flags                 uint16
+	SeqNumberBits         uint32 //used to convert LSNs to file offsets
+	RestartAreaLength     uint16
+	ClientArrayOffset     uint16
+	FileSize              uint64
+	LastLsnDataLength     uint32
+	LogRecordHeaderLength uint16
+	LogPageDataOffset     uint16
+	RestartLogOpenCount   uint32
+}
+
+type ClientRecord struct {
+	OldestLsn        uint64
+	ClientRestartLsn uint64
+	PrevClient       uint16
+	NextClient       uint16
+	SeqNumber        uint16
+	Reserved         [6]byte
+	ClientNameLength uint32
+	ClientName       string
+}
+
+type RecordPageHeader struct {
+	Signature        [4]byte //RCRD
+	UsaOffset        uint16
+	UsaCount         uint16
+	LastLsn          uint64
+	Flags            uint32
+	PageCount        uint16
+	PagePosition     uint16
+	NextRecordOffset uint16
+	Reserved         [6]byte
+	LastEndLsn       uint64
+}
+
+// restart area and records correlated with the MFT records, nil when $LogFile cannot be read
+func Process(mftrecords MFT.Records, disk disk.Disk, partitionId int) *LogFile {
+	logfileRecords := utils.Filter(mftrecords, func(record MFT.Record) bool {
+		return record.Entry == 2 && record.GetFname() == "$LogFile"
+	})
+	if len(logfileRecords) == 0 {
+		logger.MFTExtractorlogger.Warning("$LogFile record not found.")
+		return nil
+	}
+
+	results := make(chan utils.AskedFile, 1)
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	go disk.Worker(wg, logfileRecords, results, partitionId)
+
+	var data []byte
+	for askedFile := range results {
+		data = askedFile.Content
+	}
+	wg.Wait()
+
+	vol := disk.Partitions[partitionId].GetVolume()
+	clusterSizeB := vol.GetSectorsPerCluster() * int(vol.GetBytesPerSector())
+
+	logfile := new(LogFile)
+	err := logfile.Parse(data)
+	if err != nil {
+		logger.MFTExtractorlogger.Error(fmt.Sprintf("$LogFile %s", err))
+		return nil
+	}
+	logfile.Correlate(mftrecords, clusterSizeB)
+
+	msg := fmt.Sprintf("Parsed %d $LogFile records", len(logfile.Records))
+	fmt.Printf("%s\n", msg)
+	logger.MFTExtractorlogger.Info(msg)
+	return logfile
+}
+
+func (logfile *LogFile) Parse(data []byte) error {
+	err := logfile.ParseRestartPage(data)
+	if err != nil {
+		return err
+	}
+	logfile.ParseRecordPages(data)
+
+	sort.Slice(logfile.Records, func(i, j int) bool {
+		return logfile.Records[i].ThisLsn < logfile.Records[j].ThisLsn
+	})
+	return nil
+}
+
+// the second restart page is used when the first is damaged
+func (logfile *LogFile) ParseRestartPage(data []byte) error {
+	var err error
+	for _, pageOffset := range []int{0, 4096} {
+		err = logfile.parseRestartPage(data, pageOffset)
+		if err == nil {
+			return nil
+		}
+		logger.MFTExtractorlogger.Warning(fmt.Sprintf("restart page at %d %s", pageOffset, err))
+	}
+	return err
+}
+
+func (logfile *LogFile) parseRestartPage(data []byte, pageOffset int) error {
+	if pageOffset+512 > len(data) {
+		return errors.New("not enough data for restart page")
+	}
+	restartPage := new(RestartPageHeader)
+	utils.Unmarshal(data[pageOffset:pageOffset+30], restartPage)
+	signature := string(restartPage.Signature[:])
+	if signature != "RSTR" && signature != "CHKD" {
+		return fmt.Errorf("invalid signature %s", signature)
+	}
+
+	pageSize := int(restartPage.SystemPageSize)
+	if pageSize == 0 || pageOffset+pageSize > len(data) {
+		return fmt.Errorf("invalid system page size %d", pageSize)
+	}
+	page := make([]byte, pageSize)
+	copy(page, data[pageOffset:pageOffset+pageSize])
+	err := utils.ApplyFixUps(page, int(restartPage.UsaOffset), int(restartPage.UsaCount), SectorSize)
+	if err != nil {
+		return err
+	}
+
+	restartOffset := int(restartPage.RestartOffset)
+	if restartOffset+48 > len(page) {
+		return fmt.Errorf("restart area offset %d exceeds page", restartOffset)
+	}
+	restartArea := new(RestartArea)
+	utils.Unmarshal(page[restartOffset:restartOffset+48], restartArea)
+	if restartArea.SeqNumberBits < 3 || restartArea.SeqNumberBits > 64 {
+		return fmt.Errorf("invalid sequence number bits %d", restartArea.SeqNumberBits)
+	}
+
+	var clients []ClientRecord
+	clientOffset := restartOffset + int(restartArea.ClientArrayOffset)
+	for idx := 0; idx < int(restartArea.LogClients) && clientOffset+160 <= len(page); idx++ {
+		var client ClientRecord
+		utils.Unmarshal(page[clientOffset:clientOffset+32], &client)
+		nameLen := int(client.ClientNameLength)
+		if nameLen > 128 {
+			nameLen = 128
+		}
+		client.ClientName = utils.DecodeUTF16(page[clientOffset+32 : clientOffset+32+nameLen])
+		clients = append(clients, client)
+		clientOffset += 160
+	}
+
+	logfile.RestartPage = restartPage
+	logfile.RestartArea = restartArea
+	logfile.Clients = clients
+	return nil
+}
+
+// log records are aligned to 8 bytes and may span several pages
+func (logfile *LogFile) ParseRecordPages(data []byte) {
+	pageSize := int(logfile.RestartPage.LogPageSize)
+	dataOffset := int(logfile.RestartArea.LogPageDataOffset)
+	if pageSize == 0 || dataOffset < 40 || dataOffset >= pageSize {
+		logger.MFTExtractorlogger.Warning(fmt.Sprintf("invalid log page size %d data offset %d", pageSize, dataOffset))
+		return
+	}
+
+	var spanning []byte // record continuing to the next page
+	spanningLen := 0
+	for pageOffset := FirstLogPage * pageSize; pageOffset+pageSize <= len(data); pageOffset += pageSize {
+		page := make([]byte, pageSize)
+		copy(page, data[pageOffset:pageOffset+pageSize])
+		if string(page[:4]) != "RCRD" {
+			spanning = nil
+			continue
+		}
+
+		pageHeader := new(RecordPageHeader)
+		utils.Unmarshal(page[:40], pageHeader)
+		err := utils.ApplyFixUps(page, int(pageHeader.UsaOffset), int(pageHeader.UsaCount), SectorSize)
+		if err != nil {
+			logger.MFTExtractorlogger.Warning(fmt.Sprintf("log page at %d %s", pageOffset, err))
+			spanning = nil
+			continue
+		}
+
+		offset := dataOffset
+		if spanning != nil {
+			remaining := spanningLen - len(spanning)
+			if remaining > pageSize-offset {
+				spanning = append(spanning, page[offset:]...)
+				continue
+			}
+			spanning = append(spanning, page[offset:offset+remaining]...)
+			logfile.addRecord(spanning)
+			spanning = nil
+			offset = align8(offset + remaining)
+		}
+
+		for offset+RecordHeaderLength <= pageSize {
+			thisLsn := binary.LittleEndian.Uint64(page[offset : offset+8])
+			if thisLsn == 0 || logfile.lsnToOffset(thisLsn) != uint64(pageOffset+offset) { //free space
+				break
+			}
+			recordLen := RecordHeaderLength + int(binary.LittleEndian.Uint32(page[offset+24:offset+28]))
+			if offset+recordLen > pageSize {
+				spanning = append([]byte{}, page[offset:]...)
+				spanningLen = recordLen
+				break
+			}
+			logfile.addRecord(page[offset : offset+recordLen])
+			offset = align8(offset + recordLen)
+		}
+	}
+}
+
+func (logfile *LogFile) addRecord(data []byte) {
+	record := new(Record)
+	err := record.Parse(data)
+	if err != nil {
+		logger.MFTExtractorlogger.Warning(fmt.Sprintf("log record %s", err))
+		return
+	}
+	logfile.Records = append(logfile.Records, *record)
+}
+
+// LSN carries a sequence number in its upper bits and the offset divided by 8 in the lower
+func (logfile LogFile) lsnToOffset(lsn uint64) uint64 {
+	seqNumberBits := logfile.RestartArea.SeqNumberBits
+	return (lsn << seqNumberBits) >> (seqNumberBits - 3)
+}
+
+func align8(offset int) int {
+	return (offset + 7) &^ 7
+}
+
+func (logfile LogFile) ShowInfo() {
+	fmt.Printf("$LogFile version %d.%d page size %d current LSN %d file size %d\n",
+		logfile.RestartPage.MajorVersion, logfile.RestartPage.MinorVersion, logfile.RestartPage.LogPageSize,
+		logfile.RestartArea.CurrentLsn, logfile.RestartArea.FileSize)
+	for _, client := range logfile.Clients {
+		fmt.Printf("client %s oldest LSN %d restart LSN %d\n", client.ClientName, client.OldestLsn,
+			client.ClientRestartLsn)
+	}
+}
@@ -0,0 +1,306 @@
+package LogFile
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/aarsakian/FileSystemForensics/FS/NTFS/MFT"
+	MFTAttributes "github.com/aarsakian/FileSystemForensics/FS/NTFS/MFT/attributes"
+	"github.com/aarsakian/FileSystemForensics/utils"
+)
+
+const ClientRecordType = 1
+
+const OperationHeaderLength = 0x20
+
+var Operations = map[uint16]string{
+	0: "Noop", 1: "CompensationLogRecord", 2: "InitializeFileRecordSegment",
+	3: "DeallocateFileRecordSegment", 4: "WriteEndOfFileRecordSegment", 5: "CreateAttribute",
+	6: "DeleteAttribute", 7: "UpdateResidentValue", 8: "UpdateNonresidentValue",
+	9: "UpdateMappingPairs", 10: "DeleteDirtyClusters", 11: "SetNewAttributeSizes",
+	12: "AddIndexEntryRoot", 13: "DeleteIndexEntryRoot", 14: "AddIndexEntryAllocation",
+	15: "DeleteIndexEntryAllocation", 16: "WriteEndOfIndexBuffer", 17: "SetIndexEntryVcnRoot",
+	18: "SetIndexEntryVcnAllocation", 19: "UpdateFileNameRoot", 20: "UpdateFileNameAllocation",
+	21: "SetBitsInNonresidentBitMap", 22: "ClearBitsInNonresidentBitMap", 23: "HotFix",
+	24: "EndTopLevelAction", 25: "PrepareTransaction", 26: "CommitTransaction",
+	27: "ForgetTransaction", 28: "OpenNonresidentAttribute", 29: "OpenAttributeTableDump",
+	30: "AttributeNamesDump", 31: "DirtyPageTableDump", 32: "TransactionTableDump",
+	33: "UpdateRecordDataRoot", 34: "UpdateRecordDataAllocation",
+	35: "UpdateRelativeDataInIndex", 36: "UpdateRelativeDataInIndex2", 37: "ZeroEndOfFileRecord",
+}
+
+// metadata operations of interest by redo operation
+var Actions = map[uint16]string{
+	2: "create record", 3: "delete record", 5: "create attribute", 6: "delete attribute",
+	7: "update attribute", 8: "update attribute", 9: "update attribute", 11: "update attribute",
+	12: "add name", 13: "remove name", 14: "add name", 15: "remove name",
+	19: "update index entry", 20: "update index entry", 33: "update attribute", 34: "update attribute",
+}
+
+// operations whose target VCN points to an MFT record
+var recordOperations = map[uint16]bool{
+	2: true, 3: true, 4: true, 5: true, 6: true, 7: true, 9: true, 11: true, 12: true,
+	13: true, 17: true, 19: true, 33: true, 37: true,
+}
+
+type Records []Record
+
+type Record struct {
+	ThisLsn           uint64
+	ClientPreviousLsn uint64
+	ClientUndoNextLsn uint64
+	ClientDataLength  uint32
+	SeqNumber         uint16
+	ClientIndex       uint16
+	RecordType        uint32 //1 client record, 2 client restart
+	TransactionID     uint32
+	Flags             uint16
+	Reserved          [6]byte
+	Operation         *Operation
+	MFTEntry          int //-1 when not correlated
+	ParentEntry       int //directory of index operations
+	AttributeType     string
+	Fname             string
+	OldFname          string //renames
+	Action            string
+}
+
+type Operation struct {
+	RedoOp             uint16
+	UndoOp             uint16
+	RedoOffset         uint16 //from the start of the operation
+	RedoLength         uint16
+	UndoOffset         uint16
+	UndoLength         uint16
+	TargetAttribute    uint16 //offset in the open attribute table
+	LcnsToFollow       uint16
+	RecordOffset       uint16
+	AttributeOffset    uint16
+	ClusterBlockOffset uint16 //in sectors
+	Reserved           uint16
+	TargetVcn          uint64
+	Lcns               []uint64
+	RedoData           []byte
+	UndoData           []byte
+}
+
+// attribute opened by the log, referenced by the target attribute of operations
+type openAttribute struct {
+	entry    int
+	attrType string
+}
+
+func (record *Record) Parse(data []byte) error {
+	if len(data) < RecordHeaderLength {
+		return errors.New("not enough data for log record header")
+	}
+	utils.Unmarshal(data[:RecordHeaderLength], record)
+	record.MFTEntry = -1
+	record.ParentEntry = -1
+
+	if record.RecordType != ClientRecordType {
+		return nil
+	}
+	clientData := data[RecordHeaderLength:]
+	if len(clientData) < OperationHeaderLength {
+		return fmt.Errorf("LSN %d client data not enough %d", record.ThisLsn, len(clientData))
+	}
+
+	operation := new(Operation)
+	utils.Unmarshal(clientData[:OperationHeaderLength], operation)
+	for idx := 0; idx < int(operation.LcnsToFollow); idx++ {
+		lcnOffset := OperationHeaderLength + 8*idx
+		if lcnOffset+8 > len(clientData) {
+			break
+		}
+		operation.Lcns = append(operation.Lcns, binary.LittleEndian.Uint64(clientData[lcnOffset:lcnOffset+8]))
+	}
+	operation.RedoData = getOperationData(clientData, operation.RedoOffset, operation.RedoLength)
+	operation.UndoData = getOperationData(clientData, operation.UndoOffset, operation.UndoLength)
+
+	record.Operation = operation
+	record.Action = Actions[operation.RedoOp]
+	return nil
+}
+
+func getOperationData(data []byte, offset uint16, length uint16) []byte {
+	end := int(offset) + int(length)
+	if length == 0 || end > len(data) {
+		return nil
+	}
+	return data[offset:end]
+}
+
+// links operations to MFT entries using target VCNs, index entries and the open attribute table
+func (logfile *LogFile) Correlate(mftrecords MFT.Records, clusterSizeB int) {
+	fnames := map[int]string{}
+	for _, record := range mftrecords {
+		fnames[int(record.Entry)] = record.GetFname()
+	}
+
+	openAttributes := map[uint16]openAttribute{}
+	attrTypes := map[int]map[uint16]string{} //attribute type by record offset per entry
+	removedNames := map[uint32]map[int]string{}
+
+	for idx := range logfile.Records {
+		record := &logfile.Records[idx]
+		operation := record.Operation
+		if operation == nil {
+			continue
+		}
+
+		switch Operations[operation.RedoOp] {
+		case "OpenNonresidentAttribute":
+			if len(operation.RedoData) >= 16 {
+				openAttributes[operation.TargetAttribute] = openAttribute{
+					entry:    fileReferenceEntry(operation.RedoData[8:16]),
+					attrType: logfile.openAttributeType(operation.RedoData)}
+			}
+		case "OpenAttributeTableDump":
+			for offset, openAttr := range logfile.parseOpenAttributeTable(operation.RedoData) {
+				openAttributes[offset] = openAttr
+			}
+		}
+
+		if recordOperations[operation.RedoOp] {
+			record.MFTEntry = (int(operation.TargetVcn)*clusterSizeB + int(operation.ClusterBlockOffset)*SectorSize) /
+				MFT.RecordSize
+		} else if openAttr, ok := openAttributes[operation.TargetAttribute]; ok {
+			record.MFTEntry = openAttr.entry
+			record.AttributeType = openAttr.attrType
+		}
+
+		switch record.Action {
+		case "create attribute":
+			record.AttributeType = getAttributeType(operation.RedoData)
+		case "delete attribute":
+			record.AttributeType = getAttributeType(operation.UndoData)
+		case "add name", "remove name":
+			indexEntry := operation.RedoData
+			if record.Action == "remove name" {
+				indexEntry = operation.UndoData
+			}
+			if len(indexEntry) < 0x52 {
+				break
+			}
+			record.ParentEntry = record.MFTEntry
+			record.MFTEntry = fileReferenceEntry(indexEntry[:8])
+			record.AttributeType = "FileName"
+			fnameLen := 2 * int(indexEntry[0x50])
+			if 0x52+fnameLen <= len(indexEntry) {
+				record.Fname = utils.DecodeUTF16(indexEntry[0x52 : 0x52+fnameLen])
+			}
+		}
+
+		if record.AttributeType == "" && record.MFTEntry >= 0 && recordOperations[operation.RedoOp] {
+			record.AttributeType = attrTypes[record.MFTEntry][operation.RecordOffset]
+		}
+		if record.Action == "create attribute" && record.MFTEntry >= 0 {
+			if attrTypes[record.MFTEntry] == nil {
+				attrTypes[record.MFTEntry] = map[uint16]string{}
+			}
+			attrTypes[record.MFTEntry][operation.RecordOffset] = record.AttributeType
+		}
+
+		// a name removed and added in the same transaction is a rename
+		if record.Action == "remove name" {
+			if removedNames[record.TransactionID] == nil {
+				removedNames[record.TransactionID] = map[int]string{}
+			}
+			removedNames[record.TransactionID][record.MFTEntry] = record.Fname
+		} else if record.Action == "add name" {
+			oldFname, ok := removedNames[record.TransactionID][record.MFTEntry]
+			if ok && oldFname != record.Fname {
+				record.Action = "rename"
+				record.OldFname = oldFname
+			}
+		}
+
+		if record.Fname == "" && record.MFTEntry >= 0 {
+			record.Fname = fnames[record.MFTEntry]
+		}
+	}
+}
+
+// attribute type code follows the file reference and LSN for versions before 2
+func (logfile LogFile) openAttributeType(data []byte) string {
+	if logfile.RestartPage.MajorVersion >= 2 || len(data) < 0x20 {
+		return ""
+	}
+	return getAttributeType(data[0x1C:0x20])
+}
+
+// restart table header is followed by entries, offsets from the table start identify them
+func (logfile LogFile) parseOpenAttributeTable(data []byte) map[uint16]openAttribute {
+	openAttributes := map[uint16]openAttribute{}
+	if len(data) < 0x18 {
+		return openAttributes
+	}
+	entrySize := int(binary.LittleEndian.Uint16(data[:2]))
+	numberEntries := int(binary.LittleEndian.Uint16(data[2:4]))
+	if entrySize < 16 {
+		return openAttributes
+	}
+	for idx := 0; idx < numberEntries; idx++ {
+		offset := 0x18 + idx*entrySize
+		if offset+entrySize > len(data) {
+			break
+		}
+		if binary.LittleEndian.Uint32(data[offset:offset+4]) != 0xFFFFFFFF { //free entry
+			continue
+		}
+		openAttributes[uint16(offset)] = openAttribute{
+			entry:    fileReferenceEntry(data[offset+8 : offset+16]),
+			attrType: logfile.openAttributeType(data[offset : offset+entrySize])}
+	}
+	return openAttributes
+}
+
+// lower 6 bytes of file reference hold the MFT entry
+func fileReferenceEntry(data []byte) int {
+	return int(binary.LittleEndian.Uint64(data) & 0xFFFFFFFFFFFF)
+}
+
+func getAttributeType(data []byte) string {
+	if len(data) < 4 {
+		return ""
+	}
+	return MFTAttributes.AttrTypes[fmt.Sprintf("%08x", binary.LittleEndian.Uint32(data[:4]))]
+}
+
+func (records Records) GroupByEntry() map[int]Records {
+	recordsPerEntry := map[int]Records{}
+	for _, record := range records {
+		if record.MFTEntry < 0 || record.Action == "" {
+			continue
+		}
+		recordsPerEntry[record.MFTEntry] = append(recordsPerEntry[record.MFTEntry], record)
+	}
+	return recordsPerEntry
+}
+
+func (record Record) GetRedoOperation() string {
+	return Operations[record.Operation.RedoOp]
+}
+
+func (record Record) GetUndoOperation() string {
+	return Operations[record.Operation.UndoOp]
+}
+
+func (record Record) ShowInfo() {
+	fmt.Printf("LSN %d transaction %d %s redo %s undo %s", record.ThisLsn, record.TransactionID,
+		record.Action, record.GetRedoOperation(), record.GetUndoOperation())
+	if record.AttributeType != "" {
+		fmt.Printf(" attribute %s", record.AttributeType)
+	}
+	if record.Action == "rename" {
+		fmt.Printf(" %s -> %s", record.OldFname, record.Fname)
+	} else if record.Fname != "" {
+		fmt.Printf(" name %s", record.Fname)
+	}
+	if record.ParentEntry >= 0 {
+		fmt.Printf(" parent %d", record.ParentEntry)
+	}
+	fmt.Printf("\n")
+}
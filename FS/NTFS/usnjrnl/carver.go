@@ -0,0 +1,116 @@
+package UsnJrnl
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/aarsakian/FileSystemForensics/FS/NTFS/MFT"
+	"github.com/aarsakian/FileSystemForensics/disk"
+	"github.com/aarsakian/FileSystemForensics/logger"
+)
+
+// earliest plausible timestamp of a carved record, 1 Jan 1995
+const MinCarvedTime = 788918400
+
+// seconds between 1601 and 1970
+const WindowsToUnixEpoch = 11644473600
+
+// USNs restart when the journal is recreated, records of older instances share them
+type carvedKey struct {
+	usn       uint64
+	entry     uint64
+	seq       uint16
+	eventTime uint64
+}
+
+func (record Record) getCarvedKey() carvedKey {
+	return carvedKey{usn: record.USN, entry: record.EntryRef, seq: record.EntrySeq, eventTime: record.EventTime.Stamp}
+}
+
+// scans unallocated clusters for v2 and v3 records not present in the live journal
+func Carve(mftrecords MFT.Records, disk disk.Disk, partitionId int, liveRecords Records) Records {
+	seen := map[carvedKey]bool{}
+	for _, record := range liveRecords {
+		seen[record.getCarvedKey()] = true
+	}
+
+	var records Records
+	blocks := make(chan []byte, 16)
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		disk.CollectPartitionUnallocated(partitionId, blocks)
+	}()
+
+	maxTime := time.Now().Add(24 * time.Hour).Unix()
+	for block := range blocks {
+		for offset := 0; offset+V2HeaderLength <= len(block); {
+			record, ok := carveRecord(block[offset:], maxTime)
+			if !ok {
+				offset += 8
+				continue
+			}
+			offset += int(record.Length)
+			key := record.getCarvedKey()
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			records = append(records, *record)
+		}
+	}
+	wg.Wait()
+
+	records.ResolvePaths(MFT.MFTTable{Records: mftrecords})
+
+	msg := fmt.Sprintf("Carved %d USN records from unallocated clusters", len(records))
+	fmt.Printf("%s\n", msg)
+	logger.MFTExtractorlogger.Info(msg)
+	return records
+}
+
+// validates the structure before parsing, name must follow the header and fill the record
+func carveRecord(data []byte, maxTime int64) (*Record, bool) {
+	recordLen := int(binary.LittleEndian.Uint32(data[:4]))
+	majorVer := binary.LittleEndian.Uint16(data[4:6])
+	minorVer := binary.LittleEndian.Uint16(data[6:8])
+	if !isValidHeader(recordLen, majorVer) || majorVer == 4 || minorVer != 0 || recordLen > len(data) {
+		return nil, false
+	}
+
+	record := new(Record)
+	if record.Parse(data[:recordLen]) != nil {
+		return nil, false
+	}
+
+	headerLen := V2HeaderLength
+	if majorVer == 3 {
+		headerLen = V3HeaderLength
+	}
+	if int(record.FnameOffset) != headerLen || record.FnameLen == 0 || record.FnameLen%2 != 0 ||
+		align8(headerLen+int(record.FnameLen)) != recordLen {
+		return nil, false
+	}
+
+	unixTime := int64(record.EventTime.Stamp/10000000) - WindowsToUnixEpoch
+	if unixTime < MinCarvedTime || unixTime > maxTime || record.EntryRef == 0 {
+		return nil, false
+	}
+
+	for _, char := range record.Fname {
+		if !unicode.IsPrint(char) || char == unicode.ReplacementChar {
+			return nil, false
+		}
+	}
+
+	record.Carved = true
+	return record, true
+}
+
+func align8(length int) int {
+	return (length + 7) &^ 7
+}
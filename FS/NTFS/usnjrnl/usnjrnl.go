@@ -4,8 +4,11 @@ package UsnJrnl
 the Logfile does, what happened to a file (or directory, all the same)*/
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/aarsakian/FileSystemForensics/FS/NTFS/MFT"
@@ -37,7 +40,8 @@ var reasons = map[uint32]string{
 	0x00100000: "USN_REASON_REPARSE_POINT_CHANGE",
 	0x00000800: "USN_REASON_SECURITY_CHANGE",
 	0x00200000: "USN_REASON_STREAM_CHANGE",
-	0x00400000: "USN_REASON_TRANSACTED_CHANGE"}
+	0x00400000: "USN_REASON_TRANSACTED_CHANGE",
+	0x01000000: "USN_REASON_DESIRED_STORAGE_CLASS_CHANGE"}
 
 var source = map[uint32]string{
 	0x00000001: "USN_SOURCE_DATA_MANAGEMENT",
@@ -47,7 +51,7 @@ var source = map[uint32]string{
 }
 
 var fileattributes = map[uint32]string{
-	1: "Read Only", 2: "Hidden", 4: "System",
+	1: "Read Only", 2: "Hidden", 4: "System", 16: "Directory",
 	32: "Archive", 64: "Device", 128: "Normal", 256: "Temporary", 512: "Sparse file",
 	1024: "Reparse", 2048: "Compressed", 4096: "Offline",
 	8192:    "Content  is not being indexed for faster searches",
@@ -62,110 +66,405 @@ var fileattributes = map[uint32]string{
 	4194304: "FILE_ATTRIBUTE_RECALL_ON_DATA_ACCESS",
 }
 
+const PageSize = 4096
+
+const TransactedChange = 0x00400000
+
+const V2HeaderLength = 60
+
+const V3HeaderLength = 76
+
+const V4HeaderLength = 64
+
+const ExtentLength = 16
+
+const RootEntry = 5
+
+const MaxPathDepth = 256
+
+const UnknownParent = "<unknown>"
+
 type Records []Record
 
 type Record struct {
-	Length      uint32
-	MajorVer    uint16 //2-> USN v2, 3-> USN v3
-	MinorVer    uint16
-	EntryRef    uint64
-	EntrySeq    uint16
-	ParRef      uint64
-	ParSeq      uint16
-	USN         uint64
-	EventTime   utils.WindowsTime
-	ReasonFlag  uint32
-	SourceInfo  uint32
-	SecurityId  uint32
-	FileAttrs   uint32
-	FnameLen    uint16 //length of name
-	FnameOffset uint16 //format of name 58-60
-	Fname       string //special string type without nulls
+	Length           uint32
+	MajorVer         uint16 //2-> USN v2, 3-> USN v3, 4-> USN v4 range tracking
+	MinorVer         uint16
+	EntryRef         uint64 //6 bytes
+	EntrySeq         uint16
+	ParRef           uint64
+	ParSeq           uint16
+	USN              uint64
+	EventTime        utils.WindowsTime
+	ReasonFlag       uint32
+	SourceInfo       uint32
+	SecurityId       uint32
+	FileAttrs        uint32
+	FnameLen         uint16 //length of name in bytes
+	FnameOffset      uint16 //format of name 58-60
+	Fname            string //special string type without nulls
+	FileID           string //128 bit file ids of v3 and v4
+	ParentFileID     string
+	RemainingExtents int //v4 extents in following records
+	Extents          []Extent
+	FullPath         string
+	PathInferred     bool //reconstructed from earlier journal records
+	Carved           bool //recovered from unallocated clusters
+}
+
+// file reference with its sequence
+type reference struct {
+	entry uint64
+	seq   uint16
+}
 
+// name and parent of a file as recorded by the journal
+type journalName struct {
+	fname  string
+	parent reference
+}
+
+// modified range of a file, v4 only
+type Extent struct {
+	Offset int64
+	Length int64
 }
 
 func Process(mftrecords MFT.Records, disk disk.Disk, partitionId int) Records {
+	usnjrnlRecords := utils.Filter(mftrecords, func(record MFT.Record) bool {
+		return record.GetFname() == "$UsnJrnl" && !record.IsDeleted()
+	})
+	if len(usnjrnlRecords) == 0 {
+		logger.MFTExtractorlogger.Warning("$UsnJrnl record not found.")
+		return nil
+	}
 
 	var records Records
-	for _, record := range mftrecords {
-		recordsCH := make(chan Record)
-		wg := new(sync.WaitGroup)
-		wg.Add(2)
-		dataClusters := make(chan []byte, record.GetLogicalFileSize())
-
-		go disk.AsyncWorker(wg, record, dataClusters, partitionId)
-		go AsyncProcess(wg, dataClusters, recordsCH)
-		for record := range recordsCH {
-			records = append(records, record)
-		}
+	unparseableB := 0
+	recordsCH := make(chan Record)
+	fragments := make(chan MFT.Fragment, 16)
+	wg := new(sync.WaitGroup)
+	wg.Add(2)
 
-		wg.Wait()
+	go disk.StreamWorker(wg, usnjrnlRecords[0], "$J", fragments, partitionId)
+	go AsyncProcess(wg, fragments, recordsCH, &unparseableB)
+	for record := range recordsCH {
+		records = append(records, record)
 	}
 
+	wg.Wait()
+
+	records.ResolvePaths(MFT.MFTTable{Records: mftrecords})
+
+	msg := fmt.Sprintf("Parsed %d USN records, %d bytes unparseable", len(records), unparseableB)
+	fmt.Printf("%s\n", msg)
+	logger.MFTExtractorlogger.Info(msg)
 	return records
 }
 
-func AsyncProcess(wg *sync.WaitGroup, dataClusters <-chan []byte, recordsCH chan<- Record) {
+// fragments are joined when contiguous so that records straddling them are parsed
+func AsyncProcess(wg *sync.WaitGroup, fragments <-chan MFT.Fragment, recordsCH chan<- Record, unparseableB *int) {
 	defer wg.Done()
 
-	for dataCluster := range dataClusters {
-		offset := 0
-		for offset < len(dataCluster) {
+	var buf []byte
+	bufOffset := int64(0) // logical offset of buf in $J
 
-			msg := fmt.Sprintf("USN record at rel %d", offset)
-			logger.MFTExtractorlogger.Info(msg)
-			record := new(Record)
-			parsedLen, err := record.Parse(dataCluster[offset:])
+	for fragment := range fragments {
+		if len(buf) > 0 && fragment.Offset != bufOffset+int64(len(buf)) {
+			msg := fmt.Sprintf("USN record at %d incomplete before gap at %d", bufOffset, fragment.Offset)
+			logger.MFTExtractorlogger.Warning(msg)
+			*unparseableB += len(buf)
+			buf = nil
+		}
+		if len(buf) == 0 {
+			bufOffset = fragment.Offset
+			buf = fragment.Data
+		} else {
+			buf = append(buf, fragment.Data...)
+		}
 
-			if err != nil {
-				msg := fmt.Sprintf("Parsing usnjrnl exceed available buffer by %d at offset %d",
-					parsedLen-len(dataCluster[offset:]), offset)
+		parsedB := parseRecords(buf, bufOffset, recordsCH, unparseableB)
+		buf = append([]byte{}, buf[parsedB:]...)
+		bufOffset += int64(parsedB)
+	}
+
+	if !isZeroed(buf) {
+		*unparseableB += len(buf)
+	}
+	close(recordsCH)
+
+}
+
+// returns the bytes consumed, an incomplete record at the end is left for the next fragment
+func parseRecords(buf []byte, bufOffset int64, recordsCH chan<- Record, unparseableB *int) int {
+	offset := 0
+	for offset+8 <= len(buf) {
+		recordLen := int(binary.LittleEndian.Uint32(buf[offset : offset+4]))
+		majorVer := binary.LittleEndian.Uint16(buf[offset+4 : offset+6])
+
+		if recordLen == 0 || !isValidHeader(recordLen, majorVer) {
+			nextPage := int((bufOffset+int64(offset))/PageSize+1)*PageSize - int(bufOffset)
+			if nextPage > len(buf) {
+				nextPage = len(buf)
+			}
+			if recordLen != 0 { // zeros pad the page
+				msg := fmt.Sprintf("USN invalid record length %d version %d at %d, resync at next page",
+					recordLen, majorVer, bufOffset+int64(offset))
 				logger.MFTExtractorlogger.Warning(msg)
-				break
+				*unparseableB += nextPage - offset
 			}
-			offset += parsedLen
+			offset = nextPage
+			continue
+		}
 
-			if record.EntryRef == 0 {
-				continue
-			}
+		if offset+recordLen > len(buf) {
+			break
+		}
 
+		record := new(Record)
+		err := record.Parse(buf[offset : offset+recordLen])
+		if err != nil {
+			msg := fmt.Sprintf("USN record at %d %s", bufOffset+int64(offset), err)
+			logger.MFTExtractorlogger.Warning(msg)
+			*unparseableB += recordLen
+		} else if record.EntryRef != 0 {
 			recordsCH <- *record
 		}
+		offset += recordLen
 	}
-	close(recordsCH)
+	return offset
+}
+
+// records are 8 bytes aligned and do not cross pages
+func isValidHeader(recordLen int, majorVer uint16) bool {
+	return recordLen >= V2HeaderLength && recordLen%8 == 0 && recordLen <= PageSize &&
+		majorVer >= 2 && majorVer <= 4
+}
+
+func isZeroed(data []byte) bool {
+	for _, val := range data {
+		if val != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (record *Record) Parse(data []byte) error {
+	if len(data) < 8 {
+		return errors.New("not enough data to unmarshal record usnjrnl")
+	}
+	record.MajorVer = binary.LittleEndian.Uint16(data[4:6])
+
+	switch record.MajorVer {
+	case 2:
+		return record.parseV2(data)
+	case 3:
+		return record.parseV3(data)
+	case 4:
+		return record.parseV4(data)
+	}
+	return fmt.Errorf("unsupported USN record version %d", record.MajorVer)
+}
 
+func (record *Record) parseV2(data []byte) error {
+	if len(data) < V2HeaderLength {
+		return errors.New("not enough data to unmarshal record usnjrnl v2")
+	}
+	utils.Unmarshal(data[:V2HeaderLength], record)
+	return record.parseFname(data)
+}
+
+// NTFS file reference occupies the lower 8 bytes of 128 bit file ids
+func (record *Record) parseV3(data []byte) error {
+	if len(data) < V3HeaderLength {
+		return errors.New("not enough data to unmarshal record usnjrnl v3")
+	}
+	record.parseHeader128(data)
+	record.EventTime = utils.WindowsTime{Stamp: binary.LittleEndian.Uint64(data[48:56])}
+	record.ReasonFlag = binary.LittleEndian.Uint32(data[56:60])
+	record.SourceInfo = binary.LittleEndian.Uint32(data[60:64])
+	record.SecurityId = binary.LittleEndian.Uint32(data[64:68])
+	record.FileAttrs = binary.LittleEndian.Uint32(data[68:72])
+	record.FnameLen = binary.LittleEndian.Uint16(data[72:74])
+	record.FnameOffset = binary.LittleEndian.Uint16(data[74:76])
+	return record.parseFname(data)
 }
 
-func (record *Record) Parse(data []byte) (int, error) {
-	readFrom := 60
-	if len(data) < readFrom {
-		return readFrom, errors.New("not enough data to unmarshal record usnjrnl")
+// range tracking records have no name and timestamp
+func (record *Record) parseV4(data []byte) error {
+	if len(data) < V4HeaderLength {
+		return errors.New("not enough data to unmarshal record usnjrnl v4")
+	}
+	record.parseHeader128(data)
+	record.ReasonFlag = binary.LittleEndian.Uint32(data[48:52])
+	record.SourceInfo = binary.LittleEndian.Uint32(data[52:56])
+	record.RemainingExtents = int(binary.LittleEndian.Uint32(data[56:60]))
+	numberOfExtents := int(binary.LittleEndian.Uint16(data[60:62]))
+	extentSize := int(binary.LittleEndian.Uint16(data[62:64]))
+	if extentSize < ExtentLength {
+		extentSize = ExtentLength
+	}
+
+	for idx := 0; idx < numberOfExtents; idx++ {
+		extentOffset := 64 + idx*extentSize
+		if extentOffset+ExtentLength > len(data) {
+			return fmt.Errorf("extent %d exceeded available data", idx)
+		}
+		record.Extents = append(record.Extents, Extent{
+			Offset: int64(binary.LittleEndian.Uint64(data[extentOffset : extentOffset+8])),
+			Length: int64(binary.LittleEndian.Uint64(data[extentOffset+8 : extentOffset+16]))})
 	}
+	return nil
+}
 
-	utils.Unmarshal(data, record)
+func (record *Record) parseHeader128(data []byte) {
+	record.Length = binary.LittleEndian.Uint32(data[:4])
+	record.MinorVer = binary.LittleEndian.Uint16(data[6:8])
+	record.FileID = utils.Hexify(utils.Bytereverse(append([]byte{}, data[8:24]...))) //reversed in place
+	record.ParentFileID = utils.Hexify(utils.Bytereverse(append([]byte{}, data[24:40]...)))
+	record.EntryRef = binary.LittleEndian.Uint64(data[8:16]) & 0xFFFFFFFFFFFF
+	record.EntrySeq = binary.LittleEndian.Uint16(data[14:16])
+	record.ParRef = binary.LittleEndian.Uint64(data[24:32]) & 0xFFFFFFFFFFFF
+	record.ParSeq = binary.LittleEndian.Uint16(data[30:32])
+	record.USN = binary.LittleEndian.Uint64(data[40:48])
+}
 
-	readTo := 60 + 2*int(record.FnameLen)
+func (record *Record) parseFname(data []byte) error {
+	readTo := int(record.FnameOffset) + int(record.FnameLen)
 	if readTo > len(data) {
-		return readTo, errors.New("exceeded available data")
+		return errors.New("file name exceeded available data")
+	}
+	record.Fname = utils.DecodeUTF16(data[record.FnameOffset:readTo])
+	return nil
+}
+
+// full paths from parent records of $MFT, reallocated parents are resolved from earlier journal records
+func (records Records) ResolvePaths(mfttable MFT.MFTTable) {
+	journalNames := map[reference]journalName{}
+	for idx := range records {
+		record := &records[idx]
+		if record.Fname == "" {
+			continue
+		}
+		parentRef := reference{record.ParRef, record.ParSeq}
+
+		parentPath, err := mfttable.GetParentPath(parentRef.entry, parentRef.seq)
+		if err != nil {
+			parentPath = inferPath(parentRef, journalNames, mfttable)
+			record.PathInferred = true
+		}
+		record.FullPath = filepath.Join(parentPath, record.Fname)
+
+		journalNames[reference{record.EntryRef, record.EntrySeq}] = journalName{record.Fname, parentRef}
+	}
+}
+
+// walks up the journal names until a parent still allocated in $MFT or the root is reached
+func inferPath(parentRef reference, journalNames map[reference]journalName, mfttable MFT.MFTTable) string {
+	var pathParts []string
+	for depth := 0; depth < MaxPathDepth; depth++ {
+		if parentRef.entry == RootEntry {
+			break
+		}
+		name, ok := journalNames[parentRef]
+		if !ok {
+			parentPath, err := mfttable.GetParentPath(parentRef.entry, parentRef.seq)
+			if err != nil {
+				parentPath = UnknownParent
+			}
+			pathParts = append([]string{parentPath}, pathParts...)
+			break
+		}
+		pathParts = append([]string{name.fname}, pathParts...)
+		parentRef = name.parent
+	}
+	return filepath.Join(pathParts...)
+}
+
+// names of the set bits in ascending order
+func decodeFlags(flags uint32, names map[uint32]string) string {
+	var setFlags []string
+	for bit := 0; bit < 32; bit++ {
+		flag := uint32(1) << bit
+		if flags&flag == 0 {
+			continue
+		}
+		name, ok := names[flag]
+		if !ok {
+			name = fmt.Sprintf("%#x", flag)
+		}
+		setFlags = append(setFlags, name)
 	}
-	record.Fname = utils.DecodeUTF16(data[60:readTo])
-	return readTo, nil
+	return strings.Join(setFlags, "|")
 }
 
 func (record Record) GetSourceInfo() string {
-	return source[record.SourceInfo]
+	return decodeFlags(record.SourceInfo, source)
 }
 
 func (record Record) GetFileAttributes() string {
-	return fileattributes[record.FileAttrs]
+	return decodeFlags(record.FileAttrs, fileattributes)
 }
 
 func (record Record) GetReason() string {
-	return reasons[record.ReasonFlag]
+	return decodeFlags(record.ReasonFlag, reasons)
+}
+
+func (record Record) GetPath() string {
+	if record.FullPath == "" {
+		return record.Fname
+	}
+	if record.PathInferred {
+		return record.FullPath + " (inferred)"
+	}
+	return record.FullPath
+}
+
+// v4 range tracking records have neither a timestamp nor a name, they follow the v3 record of the change
+func (record Record) GetInfo() string {
+	var info strings.Builder
+	if record.MajorVer == 4 {
+		fmt.Fprintf(&info, "v4 usn %d %s entry Ref %d entry Seq %d parent Ref %d parent Seq %d",
+			record.USN, record.GetReason(), record.EntryRef, record.EntrySeq, record.ParRef, record.ParSeq)
+	} else {
+		fmt.Fprintf(&info, "v%d usn %d %s %s %s %s entry Ref %d entry Seq %d parent Ref %d parent Seq %d",
+			record.MajorVer, record.USN, record.EventTime.ConvertToIsoTime(), record.GetPath(), record.GetReason(),
+			record.GetFileAttributes(), record.EntryRef, record.EntrySeq, record.ParRef, record.ParSeq)
+	}
+	if record.SourceInfo != 0 {
+		fmt.Fprintf(&info, " source %s", record.GetSourceInfo())
+	}
+	if record.Carved {
+		fmt.Fprintf(&info, " carved")
+	}
+	for _, extent := range record.Extents {
+		fmt.Fprintf(&info, " extent offset %d len %d", extent.Offset, extent.Length)
+	}
+	if record.RemainingExtents != 0 {
+		fmt.Fprintf(&info, " remaining extents %d", record.RemainingExtents)
+	}
+	return info.String()
 }
 
 func (record Record) ShowInfo() {
-	fmt.Printf("%s %s %s entry Ref %d entry Seq %d parent Ref %d parent Seq %d\n",
-		record.Fname, record.GetReason(), record.GetFileAttributes(), record.EntryRef, record.EntrySeq,
-		record.ParRef, record.ParSeq)
+	fmt.Printf("%s\n", record.GetInfo())
+}
+
+// NTFS file reference, sequence in the upper 16 bits
+func FileReference(entry uint64, seq uint16) uint64 {
+	return uint64(seq)<<48 | entry
+}
+
+// changes made within transactions per file reference, records of reallocated entries are kept apart
+func (records Records) GroupTransactedByReference() map[uint64]Records {
+	recordsPerRef := map[uint64]Records{}
+	for _, record := range records {
+		if record.ReasonFlag&TransactedChange == 0 {
+			continue
+		}
+		ref := FileReference(record.EntryRef, record.EntrySeq)
+		recordsPerRef[ref] = append(recordsPerRef[ref], record)
+	}
+	return recordsPerRef
 }
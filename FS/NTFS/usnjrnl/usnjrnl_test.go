@@ -0,0 +1,71 @@
+package UsnJrnl
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// USN_RECORD_V3 of test.txt, entry 1234 seq 7 in the root directory
+const v3Record = "60000000" + "0300" + "0000" + // length, major and minor version
+	"d2040000000007000000000000000000" + // file id
+	"05000000000005000000000000000000" + // parent file id
+	"0000050000000000" + "00d8f3a2f5e2d901" + // usn and timestamp
+	"00010000" + "00000000" + "00000000" + "20000000" + // reason, source, security id and attributes
+	"1000" + "4c00" + // name length and offset
+	"74006500730074002e00740078007400" + "00000000" // name and padding
+
+func TestParseV3(t *testing.T) {
+	data, err := hex.DecodeString(v3Record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record Record
+	if err := record.Parse(data); err != nil {
+		t.Fatal(err)
+	}
+	if record.EntryRef != 1234 || record.EntrySeq != 7 || record.ParRef != 5 || record.ParSeq != 5 {
+		t.Errorf("refs entry %d seq %d parent %d seq %d", record.EntryRef, record.EntrySeq, record.ParRef, record.ParSeq)
+	}
+	if record.FileID != "000000000000000000070000000004d2" {
+		t.Errorf("file id %s", record.FileID)
+	}
+	if record.USN != 0x50000 || record.Fname != "test.txt" || record.GetReason() != "USN_REASON_FILE_CREATE" {
+		t.Errorf("usn %d name %s reason %s", record.USN, record.Fname, record.GetReason())
+	}
+}
+
+func TestParseV4Truncated(t *testing.T) {
+	data := make([]byte, 60)
+	data[0], data[4] = 60, 4
+	var record Record
+	if err := record.Parse(data); err == nil {
+		t.Error("truncated v4 record parsed")
+	}
+}
+
+// USN_RECORD_V4 of entry 1234 seq 7 with one modified range
+const v4Record = "50000000" + "0400" + "0000" + // length, major and minor version
+	"d2040000000007000000000000000000" + // file id
+	"05000000000005000000000000000000" + // parent file id
+	"0000060000000000" + "02000000" + "00000000" + // usn, reason and source
+	"00000000" + "0100" + "1000" + // remaining extents, number and size of extents
+	"0010000000000000" + "0020000000000000" // offset and length
+
+func TestShowV4AsExtents(t *testing.T) {
+	data, err := hex.DecodeString(v4Record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record Record
+	if err := record.Parse(data); err != nil {
+		t.Fatal(err)
+	}
+	if record.EntryRef != 1234 || len(record.Extents) != 1 || record.Extents[0].Offset != 0x1000 {
+		t.Fatalf("entry %d extents %v", record.EntryRef, record.Extents)
+	}
+	info := record.GetInfo()
+	if strings.Contains(info, "1601") || !strings.Contains(info, "extent offset 4096 len 8192") {
+		t.Errorf("v4 record shown as %s", info)
+	}
+}
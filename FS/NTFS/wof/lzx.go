@@ -0,0 +1,308 @@
+package wof
+
+/*LZX as used by WIM archives and WOF, a 32KB window per chunk,
+block header without the intel E8 bit, translation always enabled with
+file size 12000000*/
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	lzxNumChars          = 256
+	lzxNumPrimaryLens    = 7
+	lzxMinMatchLen       = 2
+	lzxNumLenSyms        = 249
+	lzxNumPreSyms        = 20
+	lzxNumAlignedSyms    = 8
+	lzxNumOffsetSlots    = 30 // 32KB window
+	lzxNumMainSyms       = lzxNumChars + lzxNumOffsetSlots*8
+	lzxNumRecentOffsets  = 3
+	lzxOffsetAdjustment  = 2
+	lzxDefaultBlockSize  = 32768
+	lzxWimMagicFileSize  = 12000000
+	lzxMaxCodewordLength = 16
+)
+
+var LZXBlockTypes = map[uint32]string{1: "Verbatim", 2: "Aligned", 3: "Uncompressed"}
+
+var lzxOffsetSlotBase = [lzxNumOffsetSlots]uint32{
+	0, 1, 2, 3, 4, 6, 8, 12, 16, 24, 32, 48, 64, 96, 128, 192,
+	256, 384, 512, 768, 1024, 1536, 2048, 3072, 4096, 6144, 8192, 12288, 16384, 24576,
+}
+
+var lzxExtraOffsetBits = [lzxNumOffsetSlots]uint{
+	0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6,
+	7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13,
+}
+
+type lzxBitReader struct {
+	data     []byte
+	pos      int
+	bitbuf   uint64
+	bitsleft uint
+}
+
+func (br *lzxBitReader) ensure(nofBits uint) {
+	for br.bitsleft < nofBits {
+		word := uint64(0)
+		if br.pos+2 <= len(br.data) {
+			word = uint64(binary.LittleEndian.Uint16(br.data[br.pos:]))
+		}
+		br.pos += 2
+		br.bitbuf = br.bitbuf<<16 | word
+		br.bitsleft += 16
+	}
+}
+
+func (br *lzxBitReader) read(nofBits uint) uint32 {
+	if nofBits == 0 {
+		return 0
+	}
+	br.ensure(nofBits)
+	val := uint32(br.bitbuf>>(br.bitsleft-nofBits)) & (1<<nofBits - 1)
+	br.bitsleft -= nofBits
+	return val
+}
+
+// when already aligned the next 16 bits are padding
+func (br *lzxBitReader) align() {
+	br.ensure(1)
+	br.bitsleft = 0
+	br.bitbuf = 0
+}
+
+// canonical huffman code decoded one bit at a time
+type huffmanCode struct {
+	counts  [lzxMaxCodewordLength + 1]int
+	symbols []int
+}
+
+func newHuffmanCode(lens []uint8) huffmanCode {
+	var code huffmanCode
+	for _, codeLen := range lens {
+		code.counts[codeLen]++
+	}
+	code.counts[0] = 0
+
+	var offsets [lzxMaxCodewordLength + 2]int
+	for codeLen := 1; codeLen <= lzxMaxCodewordLength; codeLen++ {
+		offsets[codeLen+1] = offsets[codeLen] + code.counts[codeLen]
+	}
+	code.symbols = make([]int, offsets[lzxMaxCodewordLength+1])
+	for symbol, codeLen := range lens {
+		if codeLen == 0 {
+			continue
+		}
+		code.symbols[offsets[codeLen]] = symbol
+		offsets[codeLen]++
+	}
+	return code
+}
+
+func (code huffmanCode) decode(br *lzxBitReader) (int, error) {
+	codeword, first, index := 0, 0, 0
+	for codeLen := 1; codeLen <= lzxMaxCodewordLength; codeLen++ {
+		codeword |= int(br.read(1))
+		count := code.counts[codeLen]
+		if codeword-count < first {
+			return code.symbols[index+codeword-first], nil
+		}
+		index += count
+		first += count
+		first <<= 1
+		codeword <<= 1
+	}
+	return -1, errors.New("lzx invalid huffman codeword")
+}
+
+// lengths are delta coded against the previous block using a pretree
+func readCodewordLens(br *lzxBitReader, lens []uint8) error {
+	preLens := make([]uint8, lzxNumPreSyms)
+	for idx := range preLens {
+		preLens[idx] = uint8(br.read(4))
+	}
+	preCode := newHuffmanCode(preLens)
+
+	for idx := 0; idx < len(lens); {
+		presym, err := preCode.decode(br)
+		if err != nil {
+			return err
+		}
+		var runLen int
+		var codeLen uint8
+		switch presym {
+		case 17:
+			runLen = 4 + int(br.read(4))
+		case 18:
+			runLen = 20 + int(br.read(5))
+		case 19:
+			runLen = 4 + int(br.read(1))
+			presym, err = preCode.decode(br)
+			if err != nil {
+				return err
+			}
+			if presym > 16 {
+				return errors.New("lzx invalid pretree symbol in run")
+			}
+			codeLen = uint8((int(lens[idx]) - presym + 17) % 17)
+		default:
+			lens[idx] = uint8((int(lens[idx]) - presym + 17) % 17)
+			idx++
+			continue
+		}
+		for ; runLen > 0 && idx < len(lens); runLen-- {
+			lens[idx] = codeLen
+			idx++
+		}
+	}
+	return nil
+}
+
+func DecompressLZX(data []byte, uncompressedSize int) ([]byte, error) {
+	out := make([]byte, 0, uncompressedSize)
+	br := &lzxBitReader{data: data}
+
+	var mainLens [lzxNumMainSyms]uint8
+	var lenLens [lzxNumLenSyms]uint8
+	recentOffsets := [lzxNumRecentOffsets]uint32{1, 1, 1}
+
+	for len(out) < uncompressedSize {
+		blockType := br.read(3)
+		blockSize := lzxDefaultBlockSize
+		if br.read(1) == 0 {
+			blockSize = int(br.read(16))
+		}
+		if blockSize == 0 {
+			return out, errors.New("lzx zero sized block")
+		}
+		blockEnd := len(out) + blockSize
+		if blockEnd > uncompressedSize {
+			blockEnd = uncompressedSize
+		}
+
+		switch LZXBlockTypes[blockType] {
+		case "Verbatim", "Aligned":
+			var alignedCode huffmanCode
+			if LZXBlockTypes[blockType] == "Aligned" {
+				alignedLens := make([]uint8, lzxNumAlignedSyms)
+				for idx := range alignedLens {
+					alignedLens[idx] = uint8(br.read(3))
+				}
+				alignedCode = newHuffmanCode(alignedLens)
+			}
+
+			if err := readCodewordLens(br, mainLens[:lzxNumChars]); err != nil {
+				return out, err
+			}
+			if err := readCodewordLens(br, mainLens[lzxNumChars:]); err != nil {
+				return out, err
+			}
+			if err := readCodewordLens(br, lenLens[:]); err != nil {
+				return out, err
+			}
+			mainCode := newHuffmanCode(mainLens[:])
+			lenCode := newHuffmanCode(lenLens[:])
+
+			for len(out) < blockEnd {
+				mainSymbol, err := mainCode.decode(br)
+				if err != nil {
+					return out, err
+				}
+				if mainSymbol < lzxNumChars {
+					out = append(out, byte(mainSymbol))
+					continue
+				}
+
+				mainSymbol -= lzxNumChars
+				matchLen := mainSymbol & lzxNumPrimaryLens
+				offsetSlot := mainSymbol >> 3
+				if matchLen == lzxNumPrimaryLens {
+					lenSymbol, err := lenCode.decode(br)
+					if err != nil {
+						return out, err
+					}
+					matchLen += lenSymbol
+				}
+				matchLen += lzxMinMatchLen
+
+				var matchOffset uint32
+				if offsetSlot < lzxNumRecentOffsets {
+					matchOffset = recentOffsets[offsetSlot]
+					recentOffsets[offsetSlot] = recentOffsets[0]
+					recentOffsets[0] = matchOffset
+				} else {
+					extraBits := lzxExtraOffsetBits[offsetSlot]
+					matchOffset = lzxOffsetSlotBase[offsetSlot] - lzxOffsetAdjustment
+					if LZXBlockTypes[blockType] == "Aligned" && extraBits >= 3 {
+						matchOffset += br.read(extraBits-3) << 3
+						alignedSymbol, err := alignedCode.decode(br)
+						if err != nil {
+							return out, err
+						}
+						matchOffset += uint32(alignedSymbol)
+					} else {
+						matchOffset += br.read(extraBits)
+					}
+					recentOffsets[2] = recentOffsets[1]
+					recentOffsets[1] = recentOffsets[0]
+					recentOffsets[0] = matchOffset
+				}
+
+				if matchOffset == 0 || int(matchOffset) > len(out) {
+					return out, fmt.Errorf("lzx match offset %d exceeds output %d", matchOffset, len(out))
+				}
+				for idx := 0; idx < matchLen && len(out) < uncompressedSize; idx++ {
+					out = append(out, out[len(out)-int(matchOffset)])
+				}
+			}
+
+		case "Uncompressed":
+			br.align()
+			if br.pos+4*lzxNumRecentOffsets > len(data) {
+				return out, errors.New("lzx uncompressed block header exceeds input")
+			}
+			for idx := range recentOffsets {
+				recentOffsets[idx] = binary.LittleEndian.Uint32(data[br.pos:])
+				br.pos += 4
+			}
+			if br.pos+blockEnd-len(out) > len(data) {
+				return out, errors.New("lzx uncompressed block exceeds input")
+			}
+			out = append(out, data[br.pos:br.pos+blockEnd-len(out)]...)
+			br.pos += blockSize
+			if blockSize%2 == 1 { // realign to 16 bits
+				br.pos++
+			}
+
+		default:
+			return out, fmt.Errorf("lzx invalid block type %d", blockType)
+		}
+	}
+
+	lzxUndoE8Translation(out)
+	return out, nil
+}
+
+// call instructions were translated to absolute offsets by the compressor
+func lzxUndoE8Translation(data []byte) {
+	if len(data) <= 10 {
+		return
+	}
+	for pos := 0; pos < len(data)-10; pos++ {
+		if data[pos] != 0xe8 {
+			continue
+		}
+		absOffset := int32(binary.LittleEndian.Uint32(data[pos+1:]))
+		if absOffset >= 0 {
+			if absOffset < lzxWimMagicFileSize {
+				binary.LittleEndian.PutUint32(data[pos+1:], uint32(absOffset-int32(pos)))
+			}
+		} else if absOffset >= -int32(pos) {
+			binary.LittleEndian.PutUint32(data[pos+1:], uint32(absOffset+lzxWimMagicFileSize))
+		}
+		pos += 4
+	}
+}
@@ -0,0 +1,87 @@
+package wof
+
+/*Windows Overlay Filter stores the compressed content of a file in the
+WofCompressedData named stream, it consists of a chunk offsets table followed by
+independently compressed chunks*/
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/aarsakian/FileSystemForensics/utils"
+)
+
+const (
+	XPRESS4K  = 0
+	LZX       = 1
+	XPRESS8K  = 2
+	XPRESS16K = 3
+)
+
+var ChunkSizes = map[uint32]int64{
+	XPRESS4K: 4096, LZX: 32768, XPRESS8K: 8192, XPRESS16K: 16384,
+}
+
+func Decompress(data []byte, algorithm uint32, uncompressedSize int64) ([]byte, error) {
+	chunkSize, ok := ChunkSizes[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unknown WOF compression algorithm %d", algorithm)
+	}
+	if uncompressedSize == 0 {
+		return []byte{}, nil
+	}
+
+	nofChunks := (uncompressedSize + chunkSize - 1) / chunkSize
+	entrySize := int64(4)
+	if uncompressedSize > math.MaxUint32 {
+		entrySize = 8
+	}
+	tableSize := (nofChunks - 1) * entrySize
+	if tableSize > int64(len(data)) {
+		return nil, errors.New("WOF chunk table exceeds compressed stream")
+	}
+
+	//offsets are relative to the end of the table, first chunk follows the table
+	offsets := make([]int64, nofChunks+1)
+	for idx := int64(1); idx < nofChunks; idx++ {
+		entry := data[(idx-1)*entrySize : idx*entrySize]
+		offsets[idx] = int64(utils.ReadEndianUInt(entry))
+	}
+	offsets[nofChunks] = int64(len(data)) - tableSize
+
+	var buf bytes.Buffer
+	buf.Grow(int(uncompressedSize))
+
+	for idx := int64(0); idx < nofChunks; idx++ {
+		if offsets[idx] > offsets[idx+1] || tableSize+offsets[idx+1] > int64(len(data)) {
+			return buf.Bytes(), fmt.Errorf("WOF chunk %d has invalid offsets %d-%d", idx, offsets[idx], offsets[idx+1])
+		}
+		chunk := data[tableSize+offsets[idx] : tableSize+offsets[idx+1]]
+
+		expectedSize := chunkSize
+		if idx == nofChunks-1 {
+			expectedSize = uncompressedSize - idx*chunkSize
+		}
+
+		if int64(len(chunk)) == expectedSize { // stored uncompressed
+			buf.Write(chunk)
+			continue
+		}
+
+		var decompressed []byte
+		var err error
+		if algorithm == LZX {
+			decompressed, err = DecompressLZX(chunk, int(expectedSize))
+		} else {
+			decompressed, err = DecompressXpressHuffman(chunk, int(expectedSize))
+		}
+		if err != nil {
+			return buf.Bytes(), fmt.Errorf("WOF chunk %d: %w", idx, err)
+		}
+		buf.Write(decompressed)
+
+	}
+	return buf.Bytes(), nil
+}
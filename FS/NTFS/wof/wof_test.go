@@ -0,0 +1,118 @@
+package wof
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+)
+
+// a, b, c and the match symbol 256+(1<<4)+3 of length 6 and offset 2+1 share 2 bit codes
+func xpressABCMatch() []byte {
+	data := make([]byte, 256, 260)
+	data[48] = 0x20  // symbol 97 in the high nibble
+	data[49] = 0x22  // symbols 98 and 99
+	data[137] = 0x20 // symbol 275
+	// codes 00 01 10 11 and the offset bit 1
+	return append(data, 0x80, 0x1b, 0x00, 0x00)
+}
+
+func TestDecompressXpressHuffman(t *testing.T) {
+	out, err := DecompressXpressHuffman(xpressABCMatch(), 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "abcabcabc" {
+		t.Errorf("decompressed %q", out)
+	}
+}
+
+// the match length byte follows the two 16 bit words already read
+func TestDecompressXpressHuffmanLongMatch(t *testing.T) {
+	data := make([]byte, 256, 261)
+	data[48] = 0x10  // symbol 97 of 1 bit
+	data[135] = 0x10 // symbol 256+15 of offset 1
+	data = append(data, 0x00, 0x40, 0x00, 0x00, 36-15)
+
+	out, err := DecompressXpressHuffman(data, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, bytes.Repeat([]byte("a"), 40)) {
+		t.Errorf("decompressed %q", out)
+	}
+}
+
+func TestDecompressXpressHuffmanIncompleteTable(t *testing.T) {
+	data := make([]byte, 260)
+	data[48] = 0x10
+	if _, err := DecompressXpressHuffman(data, 1); err == nil {
+		t.Error("incomplete code lengths accepted")
+	}
+}
+
+// verbatim block of 9 bytes, a, b, c and the match symbol 256+4*8+4 of slot 4 share 2 bit codes,
+// each tree is delta coded by a pretree of symbols 15 (length 2) and 18 (run of zeros)
+const lzxABCMatch = "002000900000000000000110fa0fff1f007400000000000020001802ff3f80ff" +
+	"00000000000040003f04ffff1bf90080"
+
+func TestDecompressLZX(t *testing.T) {
+	data, err := hex.DecodeString(lzxABCMatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := DecompressLZX(data, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "abcabcabc" {
+		t.Errorf("decompressed %q", out)
+	}
+}
+
+func TestDecompressLZXUncompressedBlock(t *testing.T) {
+	// type 3, size 5, aligned to 16 bits, recent offsets and odd sized content padded
+	data := []byte{0x00, 0x60, 0x00, 0x50}
+	data = append(data, make([]byte, 12)...)
+	data = append(data, "hello"...)
+	data = append(data, 0x00)
+
+	out, err := DecompressLZX(data, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "hello" {
+		t.Errorf("decompressed %q", out)
+	}
+}
+
+func TestLZXUndoE8Translation(t *testing.T) {
+	data := make([]byte, 16)
+	data[0], data[5] = 0xe8, 0xe8
+	binary.LittleEndian.PutUint32(data[1:], 0x10)
+	binary.LittleEndian.PutUint32(data[6:], 0xfffffffe) // -2 relative to position 5
+
+	lzxUndoE8Translation(data)
+	if rel := binary.LittleEndian.Uint32(data[1:]); rel != 0x10 {
+		t.Errorf("call at 0 relative offset %x", rel)
+	}
+	if rel := binary.LittleEndian.Uint32(data[6:]); rel != lzxWimMagicFileSize-2 {
+		t.Errorf("call at 5 relative offset %x", rel)
+	}
+}
+
+// first chunk stored uncompressed, second chunk compressed at the offset of the table
+func TestDecompressChunks(t *testing.T) {
+	stored := bytes.Repeat([]byte{0x41}, 4096)
+	data := binary.LittleEndian.AppendUint32(nil, 4096)
+	data = append(data, stored...)
+	data = append(data, xpressABCMatch()...)
+
+	out, err := Decompress(data, XPRESS4K, 4096+9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, append(stored, "abcabcabc"...)) {
+		t.Errorf("decompressed %d bytes", len(out))
+	}
+}
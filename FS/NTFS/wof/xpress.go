@@ -0,0 +1,147 @@
+package wof
+
+/*LZ77+Huffman as described in MS-XCA 2.2, each 64KB block starts with
+a table of 512 4-bit code lengths followed by a bitstream of 16-bit little endian words*/
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const xpressBlockSize = 65536
+
+type xpressBitReader struct {
+	data          []byte
+	pos           int
+	nextBits      uint32
+	extraBitCount int
+}
+
+func (br *xpressBitReader) read16() uint32 {
+	if br.pos+2 > len(br.data) {
+		br.pos += 2
+		return 0
+	}
+	val := uint32(binary.LittleEndian.Uint16(br.data[br.pos:]))
+	br.pos += 2
+	return val
+}
+
+func (br *xpressBitReader) readByte() uint32 {
+	if br.pos >= len(br.data) {
+		br.pos++
+		return 0
+	}
+	val := uint32(br.data[br.pos])
+	br.pos++
+	return val
+}
+
+func (br *xpressBitReader) read32() uint32 {
+	return br.read16() | br.read16()<<16
+}
+
+func (br *xpressBitReader) consume(nofBits int) {
+	br.nextBits <<= uint(nofBits)
+	br.extraBitCount -= nofBits
+	if br.extraBitCount < 0 {
+		br.nextBits |= br.read16() << uint(-br.extraBitCount)
+		br.extraBitCount += 16
+	}
+}
+
+func buildXpressDecodingTable(bitLengths [512]uint8) ([]uint16, error) {
+	table := make([]uint16, 1<<15)
+	currentEntry := 0
+	for bitLength := uint8(1); bitLength <= 15; bitLength++ {
+		for symbol := range bitLengths {
+			if bitLengths[symbol] != bitLength {
+				continue
+			}
+			entryCount := 1 << (15 - bitLength)
+			if currentEntry+entryCount > len(table) {
+				return nil, errors.New("xpress huffman code lengths oversubscribed")
+			}
+			for idx := 0; idx < entryCount; idx++ {
+				table[currentEntry] = uint16(symbol)
+				currentEntry++
+			}
+		}
+	}
+	if currentEntry != len(table) {
+		return nil, errors.New("xpress huffman code lengths incomplete")
+	}
+	return table, nil
+}
+
+func DecompressXpressHuffman(data []byte, uncompressedSize int) ([]byte, error) {
+	out := make([]byte, 0, uncompressedSize)
+	pos := 0
+
+	for len(out) < uncompressedSize {
+		if pos+256+4 > len(data) {
+			return out, errors.New("xpress huffman table exceeds input")
+		}
+		var bitLengths [512]uint8
+		for idx, val := range data[pos : pos+256] {
+			bitLengths[2*idx] = val & 0x0f
+			bitLengths[2*idx+1] = val >> 4
+		}
+		table, err := buildXpressDecodingTable(bitLengths)
+		if err != nil {
+			return out, err
+		}
+
+		br := xpressBitReader{data: data, pos: pos + 256}
+		br.nextBits = br.read16()<<16 | br.read16()
+		br.extraBitCount = 16
+
+		blockEnd := len(out) + xpressBlockSize
+		if blockEnd > uncompressedSize {
+			blockEnd = uncompressedSize
+		}
+
+		for len(out) < blockEnd {
+			symbol := table[br.nextBits>>(32-15)]
+			br.consume(int(bitLengths[symbol]))
+
+			if symbol < 256 {
+				out = append(out, byte(symbol))
+				continue
+			}
+
+			symbol -= 256
+			matchLength := uint32(symbol & 0x0f)
+			matchOffsetBitLength := int(symbol >> 4)
+			if matchLength == 15 {
+				matchLength = br.readByte()
+				if matchLength == 255 {
+					matchLength = br.read16()
+					if matchLength == 0 {
+						matchLength = br.read32()
+					}
+					if matchLength < 15 {
+						return out, errors.New("xpress huffman invalid match length")
+					}
+					matchLength -= 15
+				}
+				matchLength += 15
+			}
+			matchLength += 3
+
+			// shifting a uint32 by 32 yields 0 when no offset bits are present
+			matchOffset := int(br.nextBits>>(32-uint(matchOffsetBitLength))) + 1<<matchOffsetBitLength
+			br.consume(matchOffsetBitLength)
+
+			if matchOffset > len(out) {
+				return out, fmt.Errorf("xpress huffman match offset %d exceeds output %d", matchOffset, len(out))
+			}
+			for idx := uint32(0); idx < matchLength && len(out) < uncompressedSize; idx++ {
+				out = append(out, out[len(out)-matchOffset])
+			}
+		}
+		pos = br.pos
+	}
+	return out, nil
+}
@@ -0,0 +1,273 @@
+package analysis
+
+/*$STANDARD_INFORMATION timestamps can be set from user mode, $FILE_NAME timestamps and
+journal events are maintained by the file system, disagreements among them hint at timestomping*/
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aarsakian/FileSystemForensics/FS/NTFS/MFT"
+	MFTAttributes "github.com/aarsakian/FileSystemForensics/FS/NTFS/MFT/attributes"
+	UsnJrnl "github.com/aarsakian/FileSystemForensics/FS/NTFS/usnjrnl"
+	"github.com/aarsakian/FileSystemForensics/logger"
+	"github.com/aarsakian/FileSystemForensics/utils"
+)
+
+// 100ns intervals
+const TicksPerSecond = 10000000
+
+// seconds between 1601 and 1970
+const WindowsToUnixEpoch = 11644473600
+
+// allowed difference between an SI change and the journal event that recorded it
+const USNTolerance = 10 * TicksPerSecond
+
+const USNFileCreate = 0x00000100
+
+type Finding struct {
+	Rule   string
+	Detail string
+}
+
+type Timestomp struct {
+	VolumeCreated uint64 //creation of $MFT, set when the volume was formatted
+	Collected     uint64 //acquisition time, or the newest journal event when not given
+	FromJournal   bool   //access times are not journaled, only compared to a given acquisition time
+	JournalStart  uint64 //oldest event still in the journal
+	usnEvents     map[uint64]UsnJrnl.Records
+}
+
+type rule struct {
+	name  string
+	check func(timestomp Timestomp, record MFT.Record, siattr *MFTAttributes.SIAttribute,
+		fnattr *MFTAttributes.FNAttribute) (string, bool)
+}
+
+var rules = []rule{
+	{"SI creation before FN creation", siCreationBeforeFN},
+	{"SI MFT change before FN MFT change", siMFTChangeBeforeFN},
+	{"zeroed sub-second precision", zeroedSubSeconds},
+	{"before volume creation", beforeVolumeCreation},
+	{"in the future", inTheFuture},
+	{"SI creation before USN file create", siCreationBeforeUSNCreate},
+	{"SI MFT change not in USN journal", siMFTChangeNotJournaled},
+}
+
+func ToWindowsTime(timestamp time.Time) uint64 {
+	return uint64(timestamp.Unix()+WindowsToUnixEpoch)*TicksPerSecond + uint64(timestamp.Nanosecond()/100)
+}
+
+// bounds of the volume lifetime and journal events per entry, records must not be filtered,
+// collected is the acquisition time in 100ns intervals since 1601, 0 when unknown
+func (timestomp *Timestomp) Prepare(records MFT.Records, usnjrnlRecords UsnJrnl.Records, collected uint64) {
+	timestomp.VolumeCreated = 0
+	for _, record := range records {
+		if record.Entry != 0 {
+			continue
+		}
+		siattr := getSIAttribute(record)
+		if siattr != nil {
+			timestomp.VolumeCreated = siattr.Crtime.Stamp
+		}
+		break
+	}
+
+	timestomp.JournalStart = 0
+	journalEnd := uint64(0)
+	timestomp.usnEvents = map[uint64]UsnJrnl.Records{}
+	for _, usnrecord := range usnjrnlRecords {
+		if usnrecord.Carved || usnrecord.MajorVer == 4 { // v4 range records carry no time
+			continue
+		}
+		timestomp.usnEvents[usnrecord.EntryRef] = append(timestomp.usnEvents[usnrecord.EntryRef], usnrecord)
+		if timestomp.JournalStart == 0 || usnrecord.EventTime.Stamp < timestomp.JournalStart {
+			timestomp.JournalStart = usnrecord.EventTime.Stamp
+		}
+		if usnrecord.EventTime.Stamp > journalEnd {
+			journalEnd = usnrecord.EventTime.Stamp
+		}
+	}
+
+	timestomp.Collected = collected
+	timestomp.FromJournal = false
+	if collected == 0 && journalEnd != 0 {
+		timestomp.Collected = journalEnd + USNTolerance
+		timestomp.FromJournal = true
+	} else if collected == 0 {
+		logger.MFTExtractorlogger.Warning("acquisition time unknown without collected time or usnjrnl, future timestamps are not checked.")
+	}
+}
+
+func (timestomp Timestomp) Analyze(record MFT.Record) []Finding {
+	siattr := getSIAttribute(record)
+	if siattr == nil {
+		return nil
+	}
+	var fnattr *MFTAttributes.FNAttribute
+	attr := record.FindAttribute("FileName")
+	if attr != nil {
+		fnattr = attr.(*MFTAttributes.FNAttribute)
+	}
+
+	var findings []Finding
+	for _, rule := range rules {
+		detail, fired := rule.check(timestomp, record, siattr, fnattr)
+		if fired {
+			findings = append(findings, Finding{Rule: rule.name, Detail: detail})
+		}
+	}
+	return findings
+}
+
+func (timestomp Timestomp) Filter(records MFT.Records) MFT.Records {
+	return utils.Filter(records, func(record MFT.Record) bool {
+		return len(timestomp.Analyze(record)) > 0
+	})
+}
+
+func (timestomp Timestomp) ShowInfo(record MFT.Record) {
+	findings := timestomp.Analyze(record)
+	if len(findings) == 0 {
+		return
+	}
+	fmt.Printf("%d %s timestamp anomalies %d\n", record.Entry, record.GetFname(), len(findings))
+	for _, finding := range findings {
+		fmt.Printf("rule %s: %s\n", finding.Rule, finding.Detail)
+	}
+}
+
+func getSIAttribute(record MFT.Record) *MFTAttributes.SIAttribute {
+	attr := record.FindAttribute("Standard Information")
+	if attr == nil {
+		return nil
+	}
+	return attr.(*MFTAttributes.SIAttribute)
+}
+
+// journal events of the current allocation, deletion increments the sequence
+func (timestomp Timestomp) getUSNEvents(record MFT.Record) UsnJrnl.Records {
+	return utils.Filter(timestomp.usnEvents[uint64(record.Entry)], func(usnrecord UsnJrnl.Record) bool {
+		return usnrecord.EntrySeq == record.Seq || record.IsDeleted() && usnrecord.EntrySeq+1 == record.Seq
+	})
+}
+
+// file name timestamps are set on creation, stomping tools rarely touch them
+func siCreationBeforeFN(timestomp Timestomp, record MFT.Record, siattr *MFTAttributes.SIAttribute,
+	fnattr *MFTAttributes.FNAttribute) (string, bool) {
+	if fnattr == nil || siattr.Crtime.Stamp >= fnattr.Crtime.Stamp {
+		return "", false
+	}
+	return fmt.Sprintf("SI %s FN %s", siattr.Crtime.ConvertToIsoTime(), fnattr.Crtime.ConvertToIsoTime()), true
+}
+
+// SI MFT change time is updated whenever the record changes, including when the name is written
+func siMFTChangeBeforeFN(timestomp Timestomp, record MFT.Record, siattr *MFTAttributes.SIAttribute,
+	fnattr *MFTAttributes.FNAttribute) (string, bool) {
+	if fnattr == nil || siattr.MFTmtime.Stamp >= fnattr.MFTmtime.Stamp {
+		return "", false
+	}
+	return fmt.Sprintf("SI %s FN %s", siattr.MFTmtime.ConvertToIsoTime(), fnattr.MFTmtime.ConvertToIsoTime()), true
+}
+
+// tools setting timestamps with second precision leave the 100ns part empty,
+// names with zeroed times as well originate from file systems lacking that precision
+func zeroedSubSeconds(timestomp Timestomp, record MFT.Record, siattr *MFTAttributes.SIAttribute,
+	fnattr *MFTAttributes.FNAttribute) (string, bool) {
+	if fnattr != nil && fnattr.Crtime.Stamp%TicksPerSecond == 0 {
+		return "", false
+	}
+	var zeroed []string
+	for _, timestamp := range []struct {
+		name  string
+		stamp uint64
+	}{{"creation", siattr.Crtime.Stamp}, {"modification", siattr.Mtime.Stamp},
+		{"MFT change", siattr.MFTmtime.Stamp}, {"access", siattr.Atime.Stamp}} {
+		if timestamp.stamp != 0 && timestamp.stamp%TicksPerSecond == 0 {
+			zeroed = append(zeroed, timestamp.name)
+		}
+	}
+	if len(zeroed) == 0 {
+		return "", false
+	}
+	return fmt.Sprintf("SI %s", strings.Join(zeroed, ", ")), true
+}
+
+// copies keep their modification time, creation and MFT change happen on this volume
+func beforeVolumeCreation(timestomp Timestomp, record MFT.Record, siattr *MFTAttributes.SIAttribute,
+	fnattr *MFTAttributes.FNAttribute) (string, bool) {
+	if timestomp.VolumeCreated == 0 || record.Entry < 16 { //metadata files are created by format
+		return "", false
+	}
+	volumeCreated := utils.WindowsTime{Stamp: timestomp.VolumeCreated}
+	if siattr.Crtime.Stamp < timestomp.VolumeCreated {
+		return fmt.Sprintf("SI creation %s volume %s", siattr.Crtime.ConvertToIsoTime(),
+			volumeCreated.ConvertToIsoTime()), true
+	}
+	if siattr.MFTmtime.Stamp < timestomp.VolumeCreated {
+		return fmt.Sprintf("SI MFT change %s volume %s", siattr.MFTmtime.ConvertToIsoTime(),
+			volumeCreated.ConvertToIsoTime()), true
+	}
+	return "", false
+}
+
+func inTheFuture(timestomp Timestomp, record MFT.Record, siattr *MFTAttributes.SIAttribute,
+	fnattr *MFTAttributes.FNAttribute) (string, bool) {
+	if timestomp.Collected == 0 {
+		return "", false
+	}
+	timestamps := []utils.WindowsTime{siattr.Crtime, siattr.Mtime, siattr.MFTmtime}
+	if fnattr != nil {
+		timestamps = append(timestamps, fnattr.Crtime, fnattr.Mtime, fnattr.MFTmtime)
+	}
+	if !timestomp.FromJournal {
+		timestamps = append(timestamps, siattr.Atime)
+		if fnattr != nil {
+			timestamps = append(timestamps, fnattr.Atime)
+		}
+	}
+	for _, timestamp := range timestamps {
+		if timestamp.Stamp > timestomp.Collected {
+			return fmt.Sprintf("%s after collection", timestamp.ConvertToIsoTime()), true
+		}
+	}
+	return "", false
+}
+
+// the journal records the actual creation of files created within its window
+func siCreationBeforeUSNCreate(timestomp Timestomp, record MFT.Record, siattr *MFTAttributes.SIAttribute,
+	fnattr *MFTAttributes.FNAttribute) (string, bool) {
+	for _, usnrecord := range timestomp.getUSNEvents(record) {
+		if usnrecord.ReasonFlag&USNFileCreate == 0 {
+			continue
+		}
+		if siattr.Crtime.Stamp+USNTolerance < usnrecord.EventTime.Stamp {
+			return fmt.Sprintf("SI %s USN %d %s", siattr.Crtime.ConvertToIsoTime(), usnrecord.USN,
+				usnrecord.EventTime.ConvertToIsoTime()), true
+		}
+		break
+	}
+	return "", false
+}
+
+// changes of the record within the journal window are expected to leave an event, directories change
+// with their children and metadata files are not journaled
+func siMFTChangeNotJournaled(timestomp Timestomp, record MFT.Record, siattr *MFTAttributes.SIAttribute,
+	fnattr *MFTAttributes.FNAttribute) (string, bool) {
+	if record.IsFolder() || record.IsMetadata() {
+		return "", false
+	}
+	if timestomp.JournalStart == 0 || siattr.MFTmtime.Stamp < timestomp.JournalStart+USNTolerance ||
+		siattr.MFTmtime.Stamp > timestomp.Collected {
+		return "", false
+	}
+	for _, usnrecord := range timestomp.getUSNEvents(record) {
+		if usnrecord.EventTime.Stamp+USNTolerance >= siattr.MFTmtime.Stamp &&
+			usnrecord.EventTime.Stamp <= siattr.MFTmtime.Stamp+USNTolerance {
+			return "", false
+		}
+	}
+	return fmt.Sprintf("SI MFT change %s no event within %ds", siattr.MFTmtime.ConvertToIsoTime(),
+		USNTolerance/TicksPerSecond), true
+}
@@ -0,0 +1,133 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aarsakian/FileSystemForensics/FS/NTFS/MFT"
+	MFTAttributes "github.com/aarsakian/FileSystemForensics/FS/NTFS/MFT/attributes"
+	UsnJrnl "github.com/aarsakian/FileSystemForensics/FS/NTFS/usnjrnl"
+	"github.com/aarsakian/FileSystemForensics/utils"
+)
+
+// 2020-01-01 with a sub-second part
+const created uint64 = 132223104000000000 + 1234567
+
+func newRecord(entry uint32, flags uint16, stamp uint64) (MFT.Record, *MFTAttributes.SIAttribute, *MFTAttributes.FNAttribute) {
+	siattr := &MFTAttributes.SIAttribute{Header: &MFTAttributes.AttributeHeader{Type: [4]byte{0x10}},
+		Crtime: utils.WindowsTime{Stamp: stamp}, Mtime: utils.WindowsTime{Stamp: stamp},
+		MFTmtime: utils.WindowsTime{Stamp: stamp}, Atime: utils.WindowsTime{Stamp: stamp}}
+	fnattr := &MFTAttributes.FNAttribute{Header: &MFTAttributes.AttributeHeader{Type: [4]byte{0x30}},
+		Crtime: utils.WindowsTime{Stamp: stamp}, Mtime: utils.WindowsTime{Stamp: stamp},
+		MFTmtime: utils.WindowsTime{Stamp: stamp}, Atime: utils.WindowsTime{Stamp: stamp}, Fname: "file.txt"}
+	record := MFT.Record{Entry: entry, Seq: 1, Flags: flags, Attributes: []MFT.Attribute{siattr, fnattr}}
+	return record, siattr, fnattr
+}
+
+// volume formatted at created, the file created an hour later and journaled
+func prepareVolume() Timestomp {
+	mftRecord, _, _ := newRecord(0, 1, created)
+	usnjrnlRecords := UsnJrnl.Records{
+		{EntryRef: 100, EntrySeq: 1, ReasonFlag: USNFileCreate, EventTime: utils.WindowsTime{Stamp: created + 3600*TicksPerSecond}},
+	}
+	var timestomp Timestomp
+	timestomp.Prepare(MFT.Records{mftRecord}, usnjrnlRecords, created+48*3600*TicksPerSecond)
+	return timestomp
+}
+
+func firedRules(findings []Finding) map[string]bool {
+	rules := map[string]bool{}
+	for _, finding := range findings {
+		rules[finding.Rule] = true
+	}
+	return rules
+}
+
+func TestAnalyzeRules(t *testing.T) {
+	timestomp := prepareVolume()
+	fileCreated := created + 3600*TicksPerSecond
+
+	record, _, _ := newRecord(100, 1, fileCreated)
+	if findings := timestomp.Analyze(record); len(findings) != 0 {
+		t.Errorf("clean record findings %v", findings)
+	}
+
+	for _, test := range []struct {
+		rule  string
+		stomp func(siattr *MFTAttributes.SIAttribute, fnattr *MFTAttributes.FNAttribute)
+	}{
+		{"SI creation before FN creation", func(siattr *MFTAttributes.SIAttribute, fnattr *MFTAttributes.FNAttribute) {
+			siattr.Crtime.Stamp -= 60 * TicksPerSecond
+		}},
+		{"SI MFT change before FN MFT change", func(siattr *MFTAttributes.SIAttribute, fnattr *MFTAttributes.FNAttribute) {
+			fnattr.MFTmtime.Stamp += TicksPerSecond
+		}},
+		{"zeroed sub-second precision", func(siattr *MFTAttributes.SIAttribute, fnattr *MFTAttributes.FNAttribute) {
+			siattr.Mtime.Stamp -= siattr.Mtime.Stamp % TicksPerSecond
+		}},
+		{"before volume creation", func(siattr *MFTAttributes.SIAttribute, fnattr *MFTAttributes.FNAttribute) {
+			siattr.Crtime.Stamp = created - 86400*TicksPerSecond
+		}},
+		{"in the future", func(siattr *MFTAttributes.SIAttribute, fnattr *MFTAttributes.FNAttribute) {
+			siattr.Mtime.Stamp = created + 96*3600*TicksPerSecond
+		}},
+		{"SI creation before USN file create", func(siattr *MFTAttributes.SIAttribute, fnattr *MFTAttributes.FNAttribute) {
+			siattr.Crtime.Stamp -= 60 * TicksPerSecond
+		}},
+		{"SI MFT change not in USN journal", func(siattr *MFTAttributes.SIAttribute, fnattr *MFTAttributes.FNAttribute) {
+			siattr.MFTmtime.Stamp += 3600 * TicksPerSecond
+		}},
+	} {
+		record, siattr, fnattr := newRecord(100, 1, fileCreated)
+		test.stomp(siattr, fnattr)
+		if !firedRules(timestomp.Analyze(record))[test.rule] {
+			t.Errorf("rule %s did not fire", test.rule)
+		}
+	}
+}
+
+// directories change with their children and metadata files are not journaled
+func TestSIMFTChangeNotJournaledSkipped(t *testing.T) {
+	timestomp := prepareVolume()
+	changed := created + 5*3600*TicksPerSecond
+
+	folder, siattr, _ := newRecord(100, 3, created+3600*TicksPerSecond)
+	siattr.MFTmtime.Stamp = changed
+
+	extend, _, _ := newRecord(11, 3, created)
+	usnJrnl, siattr, _ := newRecord(40, 1, created+3600*TicksPerSecond)
+	siattr.MFTmtime.Stamp = changed
+	usnJrnl.Parent = &extend
+
+	for _, record := range []MFT.Record{folder, usnJrnl} {
+		if firedRules(timestomp.Analyze(record))["SI MFT change not in USN journal"] {
+			t.Errorf("rule fired for entry %d", record.Entry)
+		}
+	}
+}
+
+func TestToWindowsTime(t *testing.T) {
+	if stamp := ToWindowsTime(time.Unix(0, 0)); stamp != 116444736000000000 {
+		t.Errorf("unix epoch %d", stamp)
+	}
+}
+
+func TestPrepareCollected(t *testing.T) {
+	usnjrnlRecords := UsnJrnl.Records{
+		{EventTime: utils.WindowsTime{Stamp: 2000}},
+		{EventTime: utils.WindowsTime{Stamp: 9000}, Carved: true},
+		{EventTime: utils.WindowsTime{Stamp: 1000}},
+		{MajorVer: 4},
+		{EventTime: utils.WindowsTime{Stamp: 1500}},
+	}
+	var timestomp Timestomp
+	timestomp.Prepare(nil, usnjrnlRecords, 0)
+	if timestomp.Collected != 2000+USNTolerance || !timestomp.FromJournal || timestomp.JournalStart != 1000 {
+		t.Errorf("collected %d from journal %t journal start %d", timestomp.Collected, timestomp.FromJournal, timestomp.JournalStart)
+	}
+
+	timestomp.Prepare(nil, usnjrnlRecords, 5000)
+	if timestomp.Collected != 5000 || timestomp.FromJournal {
+		t.Errorf("collected %d from journal %t", timestomp.Collected, timestomp.FromJournal)
+	}
+}
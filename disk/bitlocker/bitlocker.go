@@ -0,0 +1,231 @@
+package bitlocker
+
+/*BitLocker keeps FVE metadata in three copies, the volume master key (VMK) is protected by every
+key protector and decrypts the full volume encryption key (FVEK) used for the sectors*/
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/aarsakian/FileSystemForensics/img"
+	"github.com/aarsakian/FileSystemForensics/logger"
+	"github.com/aarsakian/FileSystemForensics/utils"
+)
+
+const Signature = "-FVE-FS-"
+
+// size read for each FVE metadata block
+const MetadataBlockSize = 0x10000
+
+const MetadataBlockHeaderSize = 64
+
+var ErrUnsupportedVersion = errors.New("BitLocker version 1 (Windows Vista) is not supported")
+
+var ErrNoMetadata = errors.New("no valid FVE metadata block found")
+
+var EncryptionMethods = map[uint16]string{
+	0x8000: "AES-CBC 128 Elephant diffuser", 0x8001: "AES-CBC 256 Elephant diffuser",
+	0x8002: "AES-CBC 128", 0x8003: "AES-CBC 256",
+	0x8004: "AES-XTS 128", 0x8005: "AES-XTS 256",
+}
+
+var EntryTypes = map[uint16]string{
+	0x0000: "property", 0x0002: "VMK", 0x0003: "FVEK", 0x0004: "validation",
+	0x0006: "startup key", 0x0007: "description", 0x000b: "FVEK backup", 0x000f: "volume header block",
+}
+
+var ValueTypes = map[uint16]string{
+	0x0000: "erased", 0x0001: "key", 0x0002: "unicode string", 0x0003: "stretch key",
+	0x0004: "use key", 0x0005: "AES-CCM encrypted key", 0x0006: "TPM encoded key",
+	0x0007: "validation", 0x0008: "volume master key", 0x0009: "external key",
+	0x000a: "update", 0x000b: "error", 0x000f: "offset and size",
+}
+
+var ProtectionTypes = map[uint16]string{
+	0x0000: "clear key", 0x0100: "TPM", 0x0200: "startup key", 0x0500: "TPM and PIN",
+	0x0800: "recovery password", 0x2000: "password",
+}
+
+type BitLocker struct {
+	Header              VolumeHeader
+	MetadataBlockHeader MetadataBlockHeader
+	MetadataHeader      MetadataHeader
+	Entries             Entries
+	EncryptionMethod    uint16 //of the FVEK
+	VMK                 []byte
+	FVEK                []byte
+	TweakKey            []byte //Elephant diffuser sector key
+}
+
+// boot sector of volumes encrypted by Windows 7 and later
+type VolumeHeader struct {
+	JumpInstruction      [3]byte   //0-3
+	Signature            [8]byte   //3-11
+	BytesPerSector       uint16    //11-13
+	SectorsPerCluster    uint8     //13
+	NotUsed1             [146]byte //14-160
+	Identifier           [16]byte  //160-176
+	FirstMetadataOffset  uint64    //176-184
+	SecondMetadataOffset uint64    //184-192
+	ThirdMetadataOffset  uint64    //192-200
+}
+
+type MetadataBlockHeader struct {
+	Signature            [8]byte //-FVE-FS-
+	Size                 uint16
+	Version              uint16 //1 Vista, 2 Windows 7 and later
+	Unknown1             uint16
+	Unknown2             uint16
+	EncryptedVolumeSize  uint64 //sectors beyond it are not encrypted yet
+	Unknown3             uint32
+	VolumeHeaderSectors  uint32
+	FirstMetadataOffset  uint64
+	SecondMetadataOffset uint64
+	ThirdMetadataOffset  uint64
+	VolumeHeaderOffset   uint64 //encrypted copy of the original boot sectors
+}
+
+type MetadataHeader struct {
+	Size             uint32 //including this header
+	Version          uint32
+	HeaderSize       uint32
+	SizeCopy         uint32
+	VolumeID         [16]byte
+	NonceCounter     uint32
+	EncryptionMethod uint16
+	Unknown          uint16
+	CreationTime     utils.WindowsTime
+}
+
+type EntryHeader struct {
+	Size      uint16 //including the header
+	Type      uint16
+	ValueType uint16
+	Version   uint16
+}
+
+type Entry struct {
+	Header EntryHeader
+	Data   []byte
+}
+
+type Entries []Entry
+
+func HasSignature(data []byte) bool {
+	return len(data) >= 11 && string(data[3:11]) == Signature
+}
+
+func (bitlocker *BitLocker) Process(hD img.DiskReader, volumeOffsetB int64) error {
+	data := hD.ReadFile(volumeOffsetB, 512)
+	if !HasSignature(data) {
+		return errors.New("no BitLocker signature")
+	}
+	utils.Unmarshal(data, &bitlocker.Header)
+
+	// any of the copies can be used
+	for _, offset := range []uint64{bitlocker.Header.FirstMetadataOffset, bitlocker.Header.SecondMetadataOffset,
+		bitlocker.Header.ThirdMetadataOffset} {
+		if offset == 0 {
+			continue
+		}
+		err := bitlocker.parseMetadata(hD.ReadFile(volumeOffsetB+int64(offset), MetadataBlockSize))
+		if errors.Is(err, ErrUnsupportedVersion) {
+			return err
+		}
+		if err != nil {
+			logger.MFTExtractorlogger.Warning(fmt.Sprintf("FVE metadata block at %d %s", offset, err))
+			continue
+		}
+		return nil
+	}
+	return ErrNoMetadata
+}
+
+func (bitlocker *BitLocker) parseMetadata(data []byte) error {
+	if len(data) < MetadataBlockHeaderSize+48 || string(data[:8]) != Signature {
+		return errors.New("invalid signature")
+	}
+	utils.Unmarshal(data, &bitlocker.MetadataBlockHeader)
+	if bitlocker.MetadataBlockHeader.Version == 1 {
+		return ErrUnsupportedVersion
+	}
+	utils.Unmarshal(data[MetadataBlockHeaderSize:], &bitlocker.MetadataHeader)
+
+	start := MetadataBlockHeaderSize + int(bitlocker.MetadataHeader.HeaderSize)
+	end := MetadataBlockHeaderSize + int(bitlocker.MetadataHeader.Size)
+	if bitlocker.MetadataHeader.HeaderSize < 48 || end > len(data) || start > end {
+		return fmt.Errorf("invalid metadata size %d", bitlocker.MetadataHeader.Size)
+	}
+	bitlocker.Entries = parseEntries(data[start:end])
+	return nil
+}
+
+func parseEntries(data []byte) Entries {
+	var entries Entries
+	for offset := 0; offset+8 <= len(data); {
+		var entry Entry
+		utils.Unmarshal(data[offset:offset+8], &entry.Header)
+		size := int(entry.Header.Size)
+		if size < 8 || offset+size > len(data) {
+			break
+		}
+		entry.Data = data[offset+8 : offset+size]
+		entries = append(entries, entry)
+		offset += size
+	}
+	return entries
+}
+
+func (entries Entries) FilterByType(entryType uint16) Entries {
+	return utils.Filter(entries, func(entry Entry) bool {
+		return entry.Header.Type == entryType
+	})
+}
+
+func (entries Entries) FilterByValueType(valueType uint16) Entries {
+	return utils.Filter(entries, func(entry Entry) bool {
+		return entry.Header.ValueType == valueType
+	})
+}
+
+// VMK entries start with the key identifier, modification time and protection type
+func (entry Entry) GetProtectionType() uint16 {
+	if len(entry.Data) < 28 {
+		return 0xffff
+	}
+	return binary.LittleEndian.Uint16(entry.Data[26:28])
+}
+
+func (entry Entry) GetNestedEntries(offset int) Entries {
+	if offset > len(entry.Data) {
+		return nil
+	}
+	return parseEntries(entry.Data[offset:])
+}
+
+func (bitlocker BitLocker) GetEncryptedVolumeSize() int64 {
+	return int64(bitlocker.MetadataBlockHeader.EncryptedVolumeSize)
+}
+
+func (bitlocker BitLocker) GetProtectors() []string {
+	var protectors []string
+	for _, entry := range bitlocker.Entries.FilterByType(0x0002) {
+		if len(entry.Data) < 28 {
+			continue
+		}
+		protectionType, ok := ProtectionTypes[entry.GetProtectionType()]
+		if !ok {
+			protectionType = fmt.Sprintf("unknown %x", entry.GetProtectionType())
+		}
+		protectors = append(protectors, fmt.Sprintf("%s %s", protectionType, utils.StringifyGUID(entry.Data[:16])))
+	}
+	return protectors
+}
+
+func (bitlocker BitLocker) GetInfo() string {
+	return fmt.Sprintf("BitLocker volume %s created %s encrypted size %d method %s protectors %v",
+		utils.StringifyGUID(bitlocker.MetadataHeader.VolumeID[:]), bitlocker.MetadataHeader.CreationTime.ConvertToIsoTime(),
+		bitlocker.MetadataBlockHeader.EncryptedVolumeSize, EncryptionMethods[bitlocker.MetadataHeader.EncryptionMethod],
+		bitlocker.GetProtectors())
+}
@@ -0,0 +1,139 @@
+package bitlocker
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"math/bits"
+)
+
+// ciphers of the FVEK and the tweak key, created once the volume is unlocked
+type sectorCipher struct {
+	method    uint16
+	fvek      cipher.Block
+	tweak     cipher.Block //diffuser sector key or XTS tweak
+	xtsCipher cipher.Block
+}
+
+func (bitlocker BitLocker) newSectorCipher() (*sectorCipher, error) {
+	sc := &sectorCipher{method: bitlocker.EncryptionMethod}
+	var err error
+	switch bitlocker.EncryptionMethod {
+	case 0x8004, 0x8005:
+		half := len(bitlocker.FVEK) / 2
+		sc.xtsCipher, err = aes.NewCipher(bitlocker.FVEK[:half])
+		if err != nil {
+			return nil, err
+		}
+		sc.tweak, err = aes.NewCipher(bitlocker.FVEK[half:])
+	default:
+		sc.fvek, err = aes.NewCipher(bitlocker.FVEK)
+		if err == nil && bitlocker.TweakKey != nil {
+			sc.tweak, err = aes.NewCipher(bitlocker.TweakKey)
+		}
+	}
+	return sc, err
+}
+
+// offset of the sector in the volume and its number key the decryption
+func (sc sectorCipher) decrypt(data []byte, offset uint64, sectorNum uint64) {
+	switch sc.method {
+	case 0x8004, 0x8005:
+		decryptXTS(sc.xtsCipher, sc.tweak, sectorNum, data)
+	case 0x8000, 0x8001:
+		decryptCBC(sc.fvek, offset, data)
+		diffuserBDecrypt(data)
+		diffuserADecrypt(data)
+		sectorKey := getSectorKey(sc.tweak, offset)
+		for idx := range data {
+			data[idx] ^= sectorKey[idx%len(sectorKey)]
+		}
+	default:
+		decryptCBC(sc.fvek, offset, data)
+	}
+}
+
+// IV is the encrypted offset
+func decryptCBC(block cipher.Block, offset uint64, data []byte) {
+	iv := make([]byte, aes.BlockSize)
+	binary.LittleEndian.PutUint64(iv, offset)
+	block.Encrypt(iv, iv)
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(data, data)
+}
+
+func decryptXTS(block cipher.Block, tweakBlock cipher.Block, sectorNum uint64, data []byte) {
+	tweak := make([]byte, aes.BlockSize)
+	binary.LittleEndian.PutUint64(tweak, sectorNum)
+	tweakBlock.Encrypt(tweak, tweak)
+	for offset := 0; offset+aes.BlockSize <= len(data); offset += aes.BlockSize {
+		chunk := data[offset : offset+aes.BlockSize]
+		for idx := range chunk {
+			chunk[idx] ^= tweak[idx]
+		}
+		block.Decrypt(chunk, chunk)
+		for idx := range chunk {
+			chunk[idx] ^= tweak[idx]
+		}
+		// multiply the tweak by x in GF(2^128)
+		carry := tweak[15] >> 7
+		for idx := 15; idx > 0; idx-- {
+			tweak[idx] = tweak[idx]<<1 | tweak[idx-1]>>7
+		}
+		tweak[0] <<= 1
+		if carry != 0 {
+			tweak[0] ^= 0x87
+		}
+	}
+}
+
+// encrypted offset followed by the encrypted offset with the last byte set
+func getSectorKey(block cipher.Block, offset uint64) []byte {
+	sectorKey := make([]byte, 2*aes.BlockSize)
+	binary.LittleEndian.PutUint64(sectorKey, offset)
+	block.Encrypt(sectorKey[:aes.BlockSize], sectorKey[:aes.BlockSize])
+	binary.LittleEndian.PutUint64(sectorKey[aes.BlockSize:], offset)
+	sectorKey[2*aes.BlockSize-1] = 0x80
+	block.Encrypt(sectorKey[aes.BlockSize:], sectorKey[aes.BlockSize:])
+	return sectorKey
+}
+
+// Elephant diffuser A, 5 cycles over the sector words
+func diffuserADecrypt(data []byte) {
+	words := toWords(data)
+	nofWords := len(words)
+	rotations := []int{9, 0, 13, 0}
+	for cycle := 0; cycle < 5; cycle++ {
+		for idx := 0; idx < nofWords; idx++ {
+			words[idx] += words[(idx-2+nofWords)%nofWords] ^
+				bits.RotateLeft32(words[(idx-5+nofWords)%nofWords], rotations[idx%4])
+		}
+	}
+	fromWords(words, data)
+}
+
+// Elephant diffuser B, 3 cycles over the sector words
+func diffuserBDecrypt(data []byte) {
+	words := toWords(data)
+	nofWords := len(words)
+	rotations := []int{0, 10, 0, 25}
+	for cycle := 0; cycle < 3; cycle++ {
+		for idx := 0; idx < nofWords; idx++ {
+			words[idx] += words[(idx+2)%nofWords] ^ bits.RotateLeft32(words[(idx+5)%nofWords], rotations[idx%4])
+		}
+	}
+	fromWords(words, data)
+}
+
+func toWords(data []byte) []uint32 {
+	words := make([]uint32, len(data)/4)
+	for idx := range words {
+		words[idx] = binary.LittleEndian.Uint32(data[idx*4:])
+	}
+	return words
+}
+
+func fromWords(words []uint32, data []byte) {
+	for idx, word := range words {
+		binary.LittleEndian.PutUint32(data[idx*4:], word)
+	}
+}
@@ -0,0 +1,75 @@
+package bitlocker
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func decodeHex(t *testing.T, val string) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func sequence(start byte, length int) []byte {
+	data := make([]byte, length)
+	for idx := range data {
+		data[idx] = start + byte(idx)
+	}
+	return data
+}
+
+// encrypted by running the diffuser backwards with subtraction, as in the Elephant paper
+func TestDiffuserDecrypt(t *testing.T) {
+	data := decodeHex(t, "a07e69e703bc44da147ef4ae6f8d15aae0d745743be06560650211bc3325e344")
+	diffuserADecrypt(data)
+	if !bytes.Equal(data, sequence(0, 32)) {
+		t.Errorf("diffuser A decrypted %x", data)
+	}
+
+	data = decodeHex(t, "48dd75ee3c971953de53b380dd95516968d1c2e9dace6e16c16a2773781f9850")
+	diffuserBDecrypt(data)
+	if !bytes.Equal(data, sequence(0, 32)) {
+		t.Errorf("diffuser B decrypted %x", data)
+	}
+}
+
+// AES-CBC of the diffused sector xored with the sector key at offset 0x10000
+func TestDecryptElephantSector(t *testing.T) {
+	bitlocker := BitLocker{EncryptionMethod: 0x8000, FVEK: sequence(0x40, 16), TweakKey: sequence(0x50, 16)}
+	sc, err := bitlocker.newSectorCipher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := decodeHex(t, "109918640372be71885912575694ba62f74e272e556a8a006ef593c9cc5d1eb2"+
+		"88ab5c81b1fc2ffb93c1bd42d96f9b0c1118e916b98205e45ab18c51a40676d5")
+	sc.decrypt(data, 0x10000, 0x10000/512)
+	if !bytes.Equal(data, sequence(0x80, 64)) {
+		t.Errorf("sector decrypted %x", data)
+	}
+}
+
+// IEEE 1619 XTS-AES-128 vectors 2 and 3
+func TestDecryptXTS(t *testing.T) {
+	for _, vector := range []struct{ key, ciphertext string }{
+		{"1111111111111111111111111111111122222222222222222222222222222222",
+			"c454185e6a16936e39334038acef838bfb186fff7480adc4289382ecd6d394f0"},
+		{"fffefdfcfbfaf9f8f7f6f5f4f3f2f1f022222222222222222222222222222222",
+			"af85336b597afc1a900b2eb21ec949d292df4c047e0b21532186a5971a227a89"},
+	} {
+		bitlocker := BitLocker{EncryptionMethod: 0x8004, FVEK: decodeHex(t, vector.key)}
+		sc, err := bitlocker.newSectorCipher()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := decodeHex(t, vector.ciphertext)
+		sc.decrypt(data, 0, 0x3333333333)
+		if !bytes.Equal(data, bytes.Repeat([]byte{0x44}, 32)) {
+			t.Errorf("key %s decrypted %x", vector.key, data)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package bitlocker
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SHA256 rounds applied to passwords and recovery passwords
+const StretchIterations = 0x100000
+
+// size of the VMK entry fields before the nested entries
+const VMKHeaderSize = 28
+
+// size of the external key entry fields before the nested entries
+const ExternalKeyHeaderSize = 24
+
+var ErrInvalidKey = errors.New("key does not decrypt the volume master key")
+
+// entry types
+const VMKEntryType = 0x0002
+
+const FVEKEntryType = 0x0003
+
+const StartupKeyEntryType = 0x0006
+
+// value types
+const KeyValueType = 0x0001
+
+const StretchKeyValueType = 0x0003
+
+const AESCCMValueType = 0x0005
+
+const ExternalKeyValueType = 0x0009
+
+// protection types
+const StartupKeyProtection = 0x0200
+
+const RecoveryPasswordProtection = 0x0800
+
+// 48 digits in 8 groups, each group divided by 11 gives 2 bytes of the key
+func ParseRecoveryPassword(password string) ([]byte, error) {
+	groups := strings.Split(strings.TrimSpace(password), "-")
+	if len(groups) != 8 {
+		return nil, errors.New("recovery password must have 8 groups of 6 digits")
+	}
+	key := make([]byte, 16)
+	for idx, group := range groups {
+		value, err := strconv.ParseUint(group, 10, 32)
+		if err != nil || len(group) != 6 || value%11 != 0 || value/11 > 0xffff {
+			return nil, fmt.Errorf("invalid recovery password group %d", idx+1)
+		}
+		binary.LittleEndian.PutUint16(key[idx*2:], uint16(value/11))
+	}
+	return key, nil
+}
+
+func (bitlocker *BitLocker) UnlockWithRecoveryPassword(password string) error {
+	key, err := ParseRecoveryPassword(password)
+	if err != nil {
+		return err
+	}
+	passwordHash := sha256.Sum256(key)
+
+	for _, entry := range bitlocker.Entries.FilterByType(VMKEntryType) {
+		if entry.GetProtectionType() != RecoveryPasswordProtection {
+			continue
+		}
+		nestedEntries := entry.GetNestedEntries(VMKHeaderSize)
+		stretchEntries := nestedEntries.FilterByValueType(StretchKeyValueType)
+		encryptedEntries := nestedEntries.FilterByValueType(AESCCMValueType)
+		if len(stretchEntries) == 0 || len(encryptedEntries) == 0 || len(stretchEntries[0].Data) < 20 {
+			continue
+		}
+		stretchedKey := stretchKey(passwordHash[:], stretchEntries[0].Data[4:20])
+		vmk, err := decryptKeyEntry(stretchedKey, encryptedEntries[0])
+		if err != nil {
+			continue // another recovery password protector
+		}
+		bitlocker.VMK = vmk
+		return bitlocker.decryptFVEK()
+	}
+	return ErrInvalidKey
+}
+
+// .BEK startup key files hold an external key entry named after the protector identifier
+func (bitlocker *BitLocker) UnlockWithKeyFile(data []byte) error {
+	if len(data) < 48 {
+		return errors.New("key file too small")
+	}
+	headerSize := int(binary.LittleEndian.Uint32(data[8:12]))
+	if headerSize > len(data) {
+		return errors.New("invalid key file header")
+	}
+
+	for _, externalKey := range parseEntries(data[headerSize:]).FilterByValueType(ExternalKeyValueType) {
+		if len(externalKey.Data) < ExternalKeyHeaderSize {
+			continue
+		}
+		keys := externalKey.GetNestedEntries(ExternalKeyHeaderSize).FilterByValueType(KeyValueType)
+		if len(keys) == 0 || len(keys[0].Data) < 4 {
+			continue
+		}
+		startupKey := keys[0].Data[4:]
+
+		for _, entry := range bitlocker.Entries.FilterByType(VMKEntryType) {
+			if entry.GetProtectionType() != StartupKeyProtection || !bytes.Equal(entry.Data[:16], externalKey.Data[:16]) {
+				continue
+			}
+			encryptedEntries := entry.GetNestedEntries(VMKHeaderSize).FilterByValueType(AESCCMValueType)
+			if len(encryptedEntries) == 0 {
+				continue
+			}
+			vmk, err := decryptKeyEntry(startupKey, encryptedEntries[0])
+			if err != nil {
+				return err
+			}
+			bitlocker.VMK = vmk
+			return bitlocker.decryptFVEK()
+		}
+	}
+	return errors.New("key file does not match any startup key protector")
+}
+
+func (bitlocker *BitLocker) decryptFVEK() error {
+	for _, entry := range bitlocker.Entries.FilterByType(FVEKEntryType) {
+		if entry.Header.ValueType != AESCCMValueType {
+			continue
+		}
+		key, err := decryptKeyEntry(bitlocker.VMK, entry)
+		if err != nil {
+			return fmt.Errorf("FVEK %s", err)
+		}
+		return bitlocker.setFVEK(key)
+	}
+	return errors.New("FVEK entry not found")
+}
+
+// keys of AES-CBC with diffuser hold the tweak key at 32, AES-XTS keys are split in two halves
+func (bitlocker *BitLocker) setFVEK(key []byte) error {
+	if len(key) < 4 {
+		return errors.New("FVEK too small")
+	}
+	bitlocker.EncryptionMethod = binary.LittleEndian.Uint16(key[:2])
+	key = key[4:]
+
+	keySizes := map[uint16]int{0x8000: 16, 0x8001: 32, 0x8002: 16, 0x8003: 32, 0x8004: 32, 0x8005: 64}
+	keySize, ok := keySizes[bitlocker.EncryptionMethod]
+	if !ok {
+		return fmt.Errorf("unsupported encryption method %x", bitlocker.EncryptionMethod)
+	}
+	if bitlocker.EncryptionMethod == 0x8000 || bitlocker.EncryptionMethod == 0x8001 {
+		if len(key) < 32+keySize {
+			return errors.New("FVEK too small")
+		}
+		bitlocker.FVEK = key[:keySize]
+		bitlocker.TweakKey = key[32 : 32+keySize]
+		return nil
+	}
+	if len(key) < keySize {
+		return errors.New("FVEK too small")
+	}
+	bitlocker.FVEK = key[:keySize]
+	return nil
+}
+
+func stretchKey(passwordHash []byte, salt []byte) []byte {
+	// last hash, password hash, salt and iteration count
+	buf := make([]byte, 32+32+16+8)
+	copy(buf[32:64], passwordHash)
+	copy(buf[64:80], salt)
+	for count := uint64(0); count < StretchIterations; count++ {
+		binary.LittleEndian.PutUint64(buf[80:], count)
+		hash := sha256.Sum256(buf)
+		copy(buf[:32], hash[:])
+	}
+	return buf[:32]
+}
+
+// AES-CCM encrypted entries start with a 12 byte nonce and decrypt to a key entry
+func decryptKeyEntry(key []byte, entry Entry) ([]byte, error) {
+	if len(entry.Data) < 12+16+8 {
+		return nil, errors.New("encrypted key too small")
+	}
+	plaintext, err := decryptCCM(key, entry.Data[:12], entry.Data[12:])
+	if err != nil {
+		return nil, err
+	}
+	keyEntries := parseEntries(plaintext).FilterByValueType(KeyValueType)
+	if len(keyEntries) == 0 {
+		return nil, ErrInvalidKey
+	}
+	if entry.Header.Type == FVEKEntryType {
+		return keyEntries[0].Data, nil // encryption method is needed
+	}
+	if len(keyEntries[0].Data) < 4+32 {
+		return nil, ErrInvalidKey
+	}
+	return keyEntries[0].Data[4 : 4+32], nil
+}
+
+// the encrypted message authentication code precedes the data
+func decryptCCM(key []byte, nonce []byte, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	decrypted := make([]byte, len(data))
+	counter := make([]byte, aes.BlockSize)
+	counter[0] = 2 // 3 bytes counter
+	copy(counter[1:13], nonce)
+	keystream := make([]byte, aes.BlockSize)
+	for offset := 0; offset < len(data); offset += aes.BlockSize {
+		block.Encrypt(keystream, counter)
+		for idx := offset; idx < offset+aes.BlockSize && idx < len(data); idx++ {
+			decrypted[idx] = data[idx] ^ keystream[idx-offset]
+		}
+		for idx := 15; idx > 12; idx-- {
+			counter[idx]++
+			if counter[idx] != 0 {
+				break
+			}
+		}
+	}
+	mac, plaintext := decrypted[:aes.BlockSize], decrypted[aes.BlockSize:]
+
+	// CBC-MAC over the flags, nonce, length and plaintext
+	tag := make([]byte, aes.BlockSize)
+	tag[0] = 0x3a // 16 bytes tag, 3 bytes length
+	copy(tag[1:13], nonce)
+	tag[13], tag[14], tag[15] = byte(len(plaintext)>>16), byte(len(plaintext)>>8), byte(len(plaintext))
+	block.Encrypt(tag, tag)
+	for offset := 0; offset < len(plaintext); offset += aes.BlockSize {
+		for idx := 0; idx < aes.BlockSize && offset+idx < len(plaintext); idx++ {
+			tag[idx] ^= plaintext[offset+idx]
+		}
+		block.Encrypt(tag, tag)
+	}
+	if !bytes.Equal(tag, mac) {
+		return nil, ErrInvalidKey
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,25 @@
+package bitlocker
+
+import (
+	"bytes"
+	"testing"
+)
+
+// AES-256-CCM with a 12 byte nonce and a 16 byte tag, the encrypted tag precedes the ciphertext
+func TestDecryptCCM(t *testing.T) {
+	data := decodeHex(t, "2ad790b6758256500914815611b8322a"+
+		"5191d320426e464744dab74510729e1e06c5951ed131033e416c0c431cf75133e554638dd9fa40b5cd762ea7")
+
+	plaintext, err := decryptCCM(sequence(0, 32), sequence(0x10, 12), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plaintext, sequence(0x20, 44)) {
+		t.Errorf("decrypted %x", plaintext)
+	}
+
+	data[len(data)-1] ^= 1
+	if _, err := decryptCCM(sequence(0, 32), sequence(0x10, 12), data); err != ErrInvalidKey {
+		t.Errorf("tampered ciphertext error %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+package bitlocker
+
+import (
+	"fmt"
+
+	"github.com/aarsakian/FileSystemForensics/img"
+	"github.com/aarsakian/FileSystemForensics/logger"
+)
+
+// presents the decrypted volume, reads outside the encrypted part of the volume pass through
+type DecryptingReader struct {
+	Handler       img.DiskReader
+	VolumeOffsetB int64
+	BitLocker     *BitLocker
+	sectorCipher  *sectorCipher
+	sectorSize    int64
+}
+
+func NewDecryptingReader(hD img.DiskReader, volumeOffsetB int64, bitlocker *BitLocker) (*DecryptingReader, error) {
+	sc, err := bitlocker.newSectorCipher()
+	if err != nil {
+		return nil, err
+	}
+	sectorSize := int64(bitlocker.Header.BytesPerSector)
+	if sectorSize == 0 {
+		sectorSize = 512
+	}
+	return &DecryptingReader{Handler: hD, VolumeOffsetB: volumeOffsetB, BitLocker: bitlocker,
+		sectorCipher: sc, sectorSize: sectorSize}, nil
+}
+
+func (reader *DecryptingReader) CreateHandler() {
+
+}
+
+func (reader *DecryptingReader) CloseHandler() {
+	reader.Handler.CloseHandler()
+}
+
+func (reader DecryptingReader) GetDiskSize() int64 {
+	return reader.Handler.GetDiskSize()
+}
+
+func (reader DecryptingReader) ReadFile(offset int64, length int) []byte {
+	encryptedEnd := reader.VolumeOffsetB + reader.BitLocker.GetEncryptedVolumeSize()
+	end := offset + int64(length)
+	if end <= reader.VolumeOffsetB || offset >= encryptedEnd {
+		return reader.Handler.ReadFile(offset, length)
+	}
+
+	var data []byte
+	if offset < reader.VolumeOffsetB { // part before the volume
+		data = reader.Handler.ReadFile(offset, int(reader.VolumeOffsetB-offset))
+		offset = reader.VolumeOffsetB
+	}
+	decryptedEnd := end
+	if decryptedEnd > encryptedEnd {
+		decryptedEnd = encryptedEnd
+	}
+
+	// sector aligned range relative to the volume
+	start := (offset - reader.VolumeOffsetB) / reader.sectorSize * reader.sectorSize
+	alignedEnd := (decryptedEnd - reader.VolumeOffsetB + reader.sectorSize - 1) / reader.sectorSize * reader.sectorSize
+	sectors := reader.readSectors(start, alignedEnd)
+	data = append(data, sectors[offset-reader.VolumeOffsetB-start:decryptedEnd-reader.VolumeOffsetB-start]...)
+
+	if end > encryptedEnd { // not encrypted yet
+		data = append(data, reader.Handler.ReadFile(encryptedEnd, int(end-encryptedEnd))...)
+	}
+	return data
+}
+
+// decrypted sectors between the volume relative offsets
+func (reader DecryptingReader) readSectors(start int64, end int64) []byte {
+	header := reader.BitLocker.MetadataBlockHeader
+	volumeHeaderSize := int64(header.VolumeHeaderSectors) * reader.sectorSize
+
+	data := reader.Handler.ReadFile(reader.VolumeOffsetB+start, int(end-start))
+	if int64(len(data)) < end-start {
+		msg := fmt.Sprintf("BitLocker read %d bytes instead of %d at %d", len(data), end-start, start)
+		logger.MFTExtractorlogger.Warning(msg)
+		data = append(data, make([]byte, end-start-int64(len(data)))...)
+	}
+
+	for pos := start; pos < end; pos += reader.sectorSize {
+		sector := data[pos-start : pos-start+reader.sectorSize]
+		location := pos
+		if pos < volumeHeaderSize { // original boot sectors are relocated
+			location = int64(header.VolumeHeaderOffset) + pos
+			copy(sector, reader.Handler.ReadFile(reader.VolumeOffsetB+location, int(reader.sectorSize)))
+		} else if reader.isMetadata(pos) {
+			copy(sector, make([]byte, reader.sectorSize))
+			continue
+		}
+		reader.sectorCipher.decrypt(sector, uint64(location), uint64(location/reader.sectorSize))
+	}
+	return data
+}
+
+// FVE metadata blocks are not encrypted and read as zeros
+func (reader DecryptingReader) isMetadata(pos int64) bool {
+	header := reader.BitLocker.MetadataBlockHeader
+	for _, offset := range []uint64{header.FirstMetadataOffset, header.SecondMetadataOffset, header.ThirdMetadataOffset} {
+		if pos >= int64(offset) && pos < int64(offset)+MetadataBlockSize {
+			return true
+		}
+	}
+	return false
+}
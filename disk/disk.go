@@ -6,9 +6,12 @@ import (
 	"sync"
 
 	"github.com/aarsakian/FileSystemForensics/FS/NTFS/MFT"
+	"github.com/aarsakian/FileSystemForensics/disk/bitlocker"
+	"github.com/aarsakian/FileSystemForensics/disk/luks"
 	gptLib "github.com/aarsakian/FileSystemForensics/disk/partition/GPT"
 	mbrLib "github.com/aarsakian/FileSystemForensics/disk/partition/MBR"
 	"github.com/aarsakian/FileSystemForensics/disk/volume"
+	"github.com/aarsakian/FileSystemForensics/disk/vss"
 	"github.com/aarsakian/FileSystemForensics/img"
 	"github.com/aarsakian/FileSystemForensics/logger"
 	"github.com/aarsakian/FileSystemForensics/utils"
@@ -16,11 +19,29 @@ import (
 
 var ErrNTFSVol = errors.New("NTFS volume discovered instead of MBR")
 
+var ErrBitLockerVol = errors.New("BitLocker volume discovered instead of MBR")
+
 type Disk struct {
-	MBR        *mbrLib.MBR
-	GPT        *gptLib.GPT
-	Handler    img.DiskReader
-	Partitions []Partition
+	MBR          *mbrLib.MBR
+	GPT          *gptLib.GPT
+	Handler      img.DiskReader
+	Partitions   []Partition
+	ShadowCopies map[int]*vss.VSS //per partition
+	ShadowCopy   int              //snapshot to process instead of the live volume, 0 for none
+	BitLockerKey BitLockerKey
+	LUKSKey      LUKSKey
+}
+
+// credentials of BitLocker volumes, key file takes precedence
+type BitLockerKey struct {
+	RecoveryPassword string
+	KeyFile          string //path to .BEK startup key file
+}
+
+// credentials of LUKS volumes, key file takes precedence
+type LUKSKey struct {
+	Passphrase string
+	KeyFile    string //its content is the passphrase
 }
 
 func (disk *Disk) Initialize(evidencefile string, physicaldrive int, vmdkfile string) {
@@ -49,10 +70,24 @@ func (disk *Disk) Process(partitionNum int, MFTentries []int, fromMFTEntry int,
 		fmt.Printf("%s\n", msg)
 		logger.MFTExtractorlogger.Warning(msg)
 
+		disk.CreatePseudoMBR("NTFS")
+	} else if errors.Is(err, ErrBitLockerVol) {
+		msg := "No MBR discovered, instead BitLocker volume found at 1st sector"
+		fmt.Printf("%s\n", msg)
+		logger.MFTExtractorlogger.Warning(msg)
+
 		disk.CreatePseudoMBR("NTFS")
 	}
 	disk.ProcessPartitions(partitionNum)
 
+	disk.UnlockBitLockerVolumes(partitionNum)
+	disk.UnlockLUKSVolumes(partitionNum)
+
+	disk.DiscoverShadowCopies(partitionNum)
+	if disk.ShadowCopy > 0 {
+		disk.MountShadowCopy(partitionNum, disk.ShadowCopy)
+	}
+
 	disk.DiscoverFileSystems(MFTentries, fromMFTEntry, toMFTEntry)
 
 	return disk.GetFileSystemMetadata(partitionNum)
@@ -68,6 +103,7 @@ func (disk Disk) hasProtectiveMBR() bool {
 
 type Partition interface {
 	GetOffset() uint64
+	GetSize() uint64
 	LocateVolume(img.DiskReader)
 	GetVolume() volume.Volume
 	GetInfo() string
@@ -99,6 +135,9 @@ func (disk *Disk) populateMBR() error {
 	if string(data[3:7]) == "NTFS" {
 		return ErrNTFSVol
 	}
+	if bitlocker.HasSignature(data) {
+		return ErrBitLockerVol
+	}
 
 	mbr.Parse(data)
 	offset, err := mbr.GetExtendedPartitionOffset()
@@ -176,6 +215,18 @@ func (disk *Disk) ProcessPartitions(partitionNum int) {
 		disk.Partitions[idx].LocateVolume(disk.Handler)
 		parttionOffset := disk.Partitions[idx].GetOffset()
 		vol := disk.Partitions[idx].GetVolume()
+		if vol == nil && disk.isBitLocker(idx) {
+			msg := "Partition %d  BitLocker at %d sector"
+			fmt.Printf(msg+"\n", idx+1, parttionOffset)
+			logger.MFTExtractorlogger.Info(fmt.Sprintf(msg, idx+1, parttionOffset))
+			continue
+		}
+		if vol == nil && disk.isLUKS(idx) {
+			msg := "Partition %d  LUKS at %d sector"
+			fmt.Printf(msg+"\n", idx+1, parttionOffset)
+			logger.MFTExtractorlogger.Info(fmt.Sprintf(msg, idx+1, parttionOffset))
+			continue
+		}
 		if vol == nil {
 			msg := "No Known Volume at partition %d (Currently supported NTFS)."
 			logger.MFTExtractorlogger.Error(fmt.Sprintf(msg, idx))
@@ -189,6 +240,196 @@ func (disk *Disk) ProcessPartitions(partitionNum int) {
 
 }
 
+func (disk Disk) isBitLocker(partitionNum int) bool {
+	partitionOffsetB := int64(disk.Partitions[partitionNum].GetOffset() * 512)
+	return bitlocker.HasSignature(disk.Handler.ReadFile(partitionOffsetB, 512))
+}
+
+// reads of unlocked partitions return decrypted sectors, volumes are located again from them
+func (disk *Disk) UnlockBitLockerVolumes(partitionNum int) {
+	for idx := range disk.Partitions {
+		if partitionNum != -1 && idx+1 != partitionNum {
+			continue
+		}
+		if disk.Partitions[idx].GetVolume() != nil || !disk.isBitLocker(idx) {
+			continue
+		}
+		partitionOffsetB := int64(disk.Partitions[idx].GetOffset() * 512)
+		bde := new(bitlocker.BitLocker)
+		err := bde.Process(disk.Handler, partitionOffsetB)
+		if err != nil {
+			msg := fmt.Sprintf("partition %d %s", idx+1, err)
+			fmt.Printf("%s\n", msg)
+			logger.MFTExtractorlogger.Error(msg)
+			continue
+		}
+		fmt.Printf("Partition %d %s\n", idx+1, bde.GetInfo())
+
+		if disk.BitLockerKey.KeyFile != "" {
+			var data []byte
+			data, _, err = utils.ReadFile(disk.BitLockerKey.KeyFile)
+			if err == nil {
+				err = bde.UnlockWithKeyFile(data)
+			}
+		} else if disk.BitLockerKey.RecoveryPassword != "" {
+			err = bde.UnlockWithRecoveryPassword(disk.BitLockerKey.RecoveryPassword)
+		} else {
+			err = errors.New("locked, supply a recovery password or a key file")
+		}
+		if err != nil {
+			msg := fmt.Sprintf("partition %d BitLocker %s", idx+1, err)
+			fmt.Printf("%s\n", msg)
+			logger.MFTExtractorlogger.Error(msg)
+			continue
+		}
+
+		reader, err := bitlocker.NewDecryptingReader(disk.Handler, partitionOffsetB, bde)
+		if err != nil {
+			logger.MFTExtractorlogger.Error(fmt.Sprintf("partition %d BitLocker %s", idx+1, err))
+			continue
+		}
+		disk.Handler = reader
+		disk.Partitions[idx].LocateVolume(disk.Handler)
+		if disk.Partitions[idx].GetVolume() == nil {
+			msg := fmt.Sprintf("partition %d decrypted volume is not NTFS", idx+1)
+			fmt.Printf("%s\n", msg)
+			logger.MFTExtractorlogger.Error(msg)
+			continue
+		}
+
+		msg := "Partition %d BitLocker unlocked with %s"
+		fmt.Printf(msg+"\n", idx+1, bitlocker.EncryptionMethods[bde.EncryptionMethod])
+		logger.MFTExtractorlogger.Info(fmt.Sprintf(msg, idx+1, bitlocker.EncryptionMethods[bde.EncryptionMethod]))
+	}
+}
+
+func (disk Disk) isLUKS(partitionNum int) bool {
+	partitionOffsetB := int64(disk.Partitions[partitionNum].GetOffset() * 512)
+	return luks.HasSignature(disk.Handler.ReadFile(partitionOffsetB, 512))
+}
+
+// reads of unlocked partitions return the decrypted payload, volumes are located again from it
+func (disk *Disk) UnlockLUKSVolumes(partitionNum int) {
+	for idx := range disk.Partitions {
+		if partitionNum != -1 && idx+1 != partitionNum {
+			continue
+		}
+		if disk.Partitions[idx].GetVolume() != nil || !disk.isLUKS(idx) {
+			continue
+		}
+		partitionOffsetB := int64(disk.Partitions[idx].GetOffset() * 512)
+		luksVol := new(luks.LUKS)
+		err := luksVol.Process(disk.Handler, partitionOffsetB)
+		if err != nil {
+			msg := fmt.Sprintf("partition %d %s", idx+1, err)
+			fmt.Printf("%s\n", msg)
+			logger.MFTExtractorlogger.Error(msg)
+			continue
+		}
+		fmt.Printf("Partition %d %s\n", idx+1, luksVol.GetInfo())
+
+		if disk.LUKSKey.KeyFile != "" {
+			var data []byte
+			data, _, err = utils.ReadFile(disk.LUKSKey.KeyFile)
+			if err == nil {
+				err = luksVol.Unlock(disk.Handler, partitionOffsetB, data)
+			}
+		} else if disk.LUKSKey.Passphrase != "" {
+			err = luksVol.Unlock(disk.Handler, partitionOffsetB, []byte(disk.LUKSKey.Passphrase))
+		} else {
+			err = errors.New("locked, supply a passphrase or a key file")
+		}
+		if err != nil {
+			msg := fmt.Sprintf("partition %d LUKS %s", idx+1, err)
+			fmt.Printf("%s\n", msg)
+			logger.MFTExtractorlogger.Error(msg)
+			continue
+		}
+
+		partitionSizeB := int64(disk.Partitions[idx].GetSize() * 512)
+		reader, err := luks.NewDecryptingReader(disk.Handler, partitionOffsetB, partitionSizeB, luksVol)
+		if err != nil {
+			logger.MFTExtractorlogger.Error(fmt.Sprintf("partition %d LUKS %s", idx+1, err))
+			continue
+		}
+		disk.Handler = reader
+		disk.Partitions[idx].LocateVolume(disk.Handler)
+		if disk.Partitions[idx].GetVolume() == nil {
+			msg := fmt.Sprintf("partition %d decrypted payload has no known volume", idx+1)
+			fmt.Printf("%s\n", msg)
+			logger.MFTExtractorlogger.Error(msg)
+			continue
+		}
+
+		msg := "Partition %d LUKS unlocked, payload %s"
+		fmt.Printf(msg+"\n", idx+1, disk.Partitions[idx].GetVolume().GetSignature())
+		logger.MFTExtractorlogger.Info(fmt.Sprintf(msg, idx+1, disk.Partitions[idx].GetVolume().GetSignature()))
+	}
+}
+
+func (disk *Disk) DiscoverShadowCopies(partitionNum int) {
+	disk.ShadowCopies = map[int]*vss.VSS{}
+	for idx, partition := range disk.Partitions {
+		if partitionNum != -1 && idx+1 != partitionNum {
+			continue
+		}
+		vol := partition.GetVolume()
+		if vol == nil || vol.GetSignature() != "NTFS" {
+			continue
+		}
+		partitionOffsetB := int64(partition.GetOffset() * vol.GetBytesPerSector())
+		shadowCopies := new(vss.VSS)
+		err := shadowCopies.Process(disk.Handler, partitionOffsetB)
+		if err != nil {
+			logger.MFTExtractorlogger.Info(fmt.Sprintf("partition %d %s", idx+1, err))
+			continue
+		}
+		msg := "Partition %d has %d volume shadow copies"
+		fmt.Printf(msg+"\n", idx+1, len(shadowCopies.Snapshots))
+		logger.MFTExtractorlogger.Info(fmt.Sprintf(msg, idx+1, len(shadowCopies.Snapshots)))
+		disk.ShadowCopies[idx] = shadowCopies
+	}
+}
+
+// reads of the partitions having the snapshot return its content, volumes are located again from the snapshot
+func (disk *Disk) MountShadowCopy(partitionNum int, snapshotIdx int) {
+	for idx := range disk.Partitions {
+		if partitionNum != -1 && idx+1 != partitionNum {
+			continue
+		}
+		shadowCopies, ok := disk.ShadowCopies[idx]
+		if !ok {
+			continue
+		}
+		vol := disk.Partitions[idx].GetVolume()
+		partitionOffsetB := int64(disk.Partitions[idx].GetOffset() * vol.GetBytesPerSector())
+		reader, err := vss.NewSnapshotReader(disk.Handler, partitionOffsetB, *shadowCopies, snapshotIdx)
+		if err != nil {
+			msg := fmt.Sprintf("partition %d %s", idx+1, err)
+			fmt.Printf("%s\n", msg)
+			logger.MFTExtractorlogger.Error(msg)
+			continue
+		}
+		disk.Handler = reader
+		disk.Partitions[idx].LocateVolume(disk.Handler)
+
+		msg := "Partition %d processing volume shadow copy %d"
+		fmt.Printf(msg+"\n", idx+1, snapshotIdx)
+		logger.MFTExtractorlogger.Info(fmt.Sprintf(msg, idx+1, snapshotIdx))
+	}
+}
+
+func (disk Disk) ListShadowCopies() {
+	for idx := range disk.Partitions {
+		shadowCopies, ok := disk.ShadowCopies[idx]
+		if !ok {
+			continue
+		}
+		fmt.Printf("Partition %d ", idx+1)
+		shadowCopies.ShowInfo()
+	}
+}
+
 func (disk Disk) GetFileSystemMetadata(partitionNum int) map[int]MFT.Records {
 
 	recordsPerPartition := map[int]MFT.Records{}
@@ -200,43 +441,26 @@ func (disk Disk) GetFileSystemMetadata(partitionNum int) map[int]MFT.Records {
 		if vol == nil {
 			continue
 		}
-		//	recordsPerPartition[idx] = fs.GetMetadata()
+		recordsPerPartition[idx] = vol.GetFSMetadata()
 
 	}
 	return recordsPerPartition
 }
 
-func (disk Disk) AsyncWorker(wg *sync.WaitGroup, record MFT.Record, dataClusters chan<- []byte, partitionNum int) {
+func (disk Disk) StreamWorker(wg *sync.WaitGroup, record MFT.Record, streamName string, fragments chan<- MFT.Fragment, partitionNum int) {
 	defer wg.Done()
 	partition := disk.Partitions[partitionNum]
 
 	vol := partition.GetVolume()
-	sectorsPerCluster := int(vol.GetSectorsPerCluster())
-	bytesPerSector := int(vol.GetBytesPerSector())
-	partitionOffsetB := int64(partition.GetOffset()) * int64(bytesPerSector)
+	clusterSizeB := int64(vol.GetSectorsPerCluster()) * int64(vol.GetBytesPerSector())
+	partitionOffsetB := int64(partition.GetOffset()) * int64(vol.GetBytesPerSector())
 
-	if record.IsFolder() {
-		msg := fmt.Sprintf("Record %s Id %d is folder! No data to export.", record.GetFname(), record.Entry)
-		logger.MFTExtractorlogger.Warning(msg)
-		close(dataClusters)
-		return
-	}
-	fmt.Printf("pulling data file %s Id %d\n", record.GetFname(), record.Entry)
-
-	if len(record.LinkedRecords) == 0 {
-		record.LocateDataAsync(disk.Handler, partitionOffsetB, sectorsPerCluster, bytesPerSector, dataClusters)
-	} else { // attribute runlist
-
-		for _, linkedRecord := range record.LinkedRecords {
-			linkedRecord.LocateDataAsync(disk.Handler, partitionOffsetB, sectorsPerCluster, bytesPerSector, dataClusters)
-
-		}
-	}
-	// use lsize to make sure that we cannot exceed the logical size
-
-	close(dataClusters)
+	fmt.Printf("pulling stream %s of file %s Id %d\n", streamName, record.GetFname(), record.Entry)
+	record.LocateStreamFragments(disk.Handler, partitionOffsetB, clusterSizeB, streamName, fragments)
 
+	close(fragments)
 }
+
 func (disk Disk) Worker(wg *sync.WaitGroup, records MFT.Records, results chan<- utils.AskedFile, partitionNum int) {
 	defer wg.Done()
 	partition := disk.Partitions[partitionNum]
@@ -255,16 +479,8 @@ func (disk Disk) Worker(wg *sync.WaitGroup, records MFT.Records, results chan<-
 		}
 		fmt.Printf("pulling data file %s Id %d\n", record.GetFname(), record.Entry)
 
-		if len(record.LinkedRecords) == 0 {
-			record.LocateData(disk.Handler, partitionOffsetB, sectorsPerCluster, bytesPerSector, results)
-		} else { // attribute runlist
-
-			for _, linkedRecord := range record.LinkedRecords {
-				linkedRecord.LocateData(disk.Handler, partitionOffsetB, sectorsPerCluster, bytesPerSector, results)
-
-			}
-		}
-		// use lsize to make sure that we cannot exceed the logical size
+		// runlists of linked records are collected by the record, output has the logical size
+		record.LocateData(disk.Handler, partitionOffsetB, sectorsPerCluster, bytesPerSector, results)
 
 	}
 	close(results)
@@ -282,6 +498,30 @@ func (disk Disk) ShowVolumeInfo() {
 	}
 }
 
+// compares $MFTMirr with $MFT and validates the records of processed volumes
+func (disk Disk) ShowVolumeHealth() {
+	for idx, partition := range disk.Partitions {
+		vol := partition.GetVolume()
+		if vol == nil {
+			continue
+		}
+		fmt.Printf("Partition %d %s\n", idx+1, vol.GetSignature())
+		partitionOffsetB := int64(partition.GetOffset() * vol.GetBytesPerSector())
+		vol.ShowHealth(disk.Handler, partitionOffsetB)
+	}
+}
+
+func (disk Disk) AssessRecoverability() {
+	for _, partition := range disk.Partitions {
+		vol := partition.GetVolume()
+		if vol == nil {
+			continue
+		}
+		partitionOffsetB := int64(partition.GetOffset() * vol.GetBytesPerSector())
+		vol.AssessRecoverability(disk.Handler, partitionOffsetB)
+	}
+}
+
 func (disk Disk) ListPartitions() {
 	if disk.hasProtectiveMBR() {
 		fmt.Printf("GPT:\n")
@@ -301,15 +541,41 @@ func (disk Disk) ListPartitions() {
 }
 
 func (disk Disk) CollectedUnallocated(blocks chan<- []byte) {
-	for _, partition := range disk.Partitions {
+	for idx := range disk.Partitions {
+		disk.collectUnallocated(idx, blocks)
+	}
+	close(blocks)
+}
 
-		vol := partition.GetVolume()
-		if vol == nil {
-			continue
-		}
-		bytesPerSector := int(vol.GetBytesPerSector())
-		partitionOffsetB := int64(partition.GetOffset()) * int64(bytesPerSector)
+func (disk Disk) CollectPartitionUnallocated(partitionNum int, blocks chan<- []byte) {
+	disk.collectUnallocated(partitionNum, blocks)
+	close(blocks)
+}
+
+// MFT records surviving in unallocated clusters of the partition
+func (disk Disk) CarveRecords(partitionNum int) MFT.Records {
+	var records MFT.Records
+	blocks := make(chan []byte, 16)
+	go disk.CollectPartitionUnallocated(partitionNum, blocks)
+	for block := range blocks {
+		records = append(records, MFT.CarveRecords(block)...)
+	}
+	records = records.Deduplicate()
+
+	msg := fmt.Sprintf("Carved %d MFT records from unallocated clusters of partition %d", len(records), partitionNum+1)
+	fmt.Printf("%s\n", msg)
+	logger.MFTExtractorlogger.Info(msg)
+	return records
+}
 
-		vol.CollectUnallocated(disk.Handler, partitionOffsetB, blocks)
+func (disk Disk) collectUnallocated(partitionNum int, blocks chan<- []byte) {
+	partition := disk.Partitions[partitionNum]
+	vol := partition.GetVolume()
+	if vol == nil || vol.GetFSMetadata() == nil { // volume not processed
+		return
 	}
+	bytesPerSector := int(vol.GetBytesPerSector())
+	partitionOffsetB := int64(partition.GetOffset()) * int64(bytesPerSector)
+
+	vol.CollectUnallocated(disk.Handler, partitionOffsetB, blocks)
 }
@@ -0,0 +1,220 @@
+package luks
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"sort"
+	"strconv"
+
+	"github.com/aarsakian/FileSystemForensics/img"
+	"github.com/aarsakian/FileSystemForensics/logger"
+	"github.com/aarsakian/FileSystemForensics/utils"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+var ErrInvalidPassphrase = errors.New("passphrase does not unlock any keyslot")
+
+// 4000 stripes of a 512 bit key take 250KB
+const MaxKeyMaterialSize = 4 * 1024 * 1024
+
+var Hashes = map[string]func() hash.Hash{
+	"sha1": sha1.New, "sha256": sha256.New, "sha512": sha512.New,
+}
+
+// passphrase or the content of a key file
+func (luks *LUKS) Unlock(hD img.DiskReader, volumeOffsetB int64, passphrase []byte) error {
+	if luks.Header != nil {
+		return luks.unlockKeySlots(hD, volumeOffsetB, passphrase)
+	}
+	return luks.unlockKeyslots2(hD, volumeOffsetB, passphrase)
+}
+
+func (luks *LUKS) unlockKeySlots(hD img.DiskReader, volumeOffsetB int64, passphrase []byte) error {
+	header := luks.Header
+	hashSpec := string(utils.RemoveNulls(header.HashSpec[:]))
+	newHash, ok := Hashes[hashSpec]
+	if !ok {
+		return fmt.Errorf("unsupported hash %s", hashSpec)
+	}
+	keySize := int(header.KeyBytes)
+
+	for _, slot := range header.KeySlots {
+		if slot.Active != KeySlotEnabled {
+			continue
+		}
+		if !isValidKeyMaterial(keySize, int(slot.Stripes)) {
+			logger.MFTExtractorlogger.Warning(fmt.Sprintf("LUKS keyslot key size %d stripes %d skipped", keySize, slot.Stripes))
+			continue
+		}
+		derivedKey := pbkdf2.Key(passphrase, slot.Salt[:], int(slot.Iterations), keySize, newHash)
+		material, err := readKeyMaterial(hD, volumeOffsetB+int64(slot.KeyMaterialOffset)*SectorSize,
+			keySize*int(slot.Stripes), luks.Encryption, derivedKey)
+		if err != nil {
+			logger.MFTExtractorlogger.Warning(fmt.Sprintf("LUKS keyslot %s", err))
+			continue
+		}
+		masterKey := afMerge(material, keySize, int(slot.Stripes), newHash)
+		digest := pbkdf2.Key(masterKey, header.MKDigestSalt[:], int(header.MKDigestIterations), len(header.MKDigest), newHash)
+		if bytes.Equal(digest, header.MKDigest[:]) {
+			luks.MasterKey = masterKey
+			return nil
+		}
+	}
+	return ErrInvalidPassphrase
+}
+
+func (luks *LUKS) unlockKeyslots2(hD img.DiskReader, volumeOffsetB int64, passphrase []byte) error {
+	var ids []string
+	for id := range luks.Metadata.Keyslots {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		keyslot := luks.Metadata.Keyslots[id]
+		if keyslot.Type != "luks2" || keyslot.AF.Type != "luks1" || keyslot.Area.Type != "raw" {
+			continue
+		}
+		newHash, ok := Hashes[keyslot.AF.Hash]
+		if !ok {
+			logger.MFTExtractorlogger.Warning(fmt.Sprintf("LUKS keyslot %s unsupported hash %s", id, keyslot.AF.Hash))
+			continue
+		}
+		if !isValidKeyMaterial(keyslot.KeySize, keyslot.AF.Stripes) {
+			logger.MFTExtractorlogger.Warning(fmt.Sprintf("LUKS keyslot %s key size %d stripes %d skipped",
+				id, keyslot.KeySize, keyslot.AF.Stripes))
+			continue
+		}
+		derivedKey, err := keyslot.KDF.deriveKey(passphrase, keyslot.Area.KeySize)
+		if err != nil {
+			logger.MFTExtractorlogger.Warning(fmt.Sprintf("LUKS keyslot %s %s", id, err))
+			continue
+		}
+		areaOffset, _ := strconv.ParseInt(keyslot.Area.Offset, 10, 64)
+		material, err := readKeyMaterial(hD, volumeOffsetB+areaOffset, keyslot.KeySize*keyslot.AF.Stripes,
+			keyslot.Area.Encryption, derivedKey)
+		if err != nil {
+			logger.MFTExtractorlogger.Warning(fmt.Sprintf("LUKS keyslot %s %s", id, err))
+			continue
+		}
+		masterKey := afMerge(material, keyslot.KeySize, keyslot.AF.Stripes, newHash)
+		if luks.verifyDigest(id, masterKey) {
+			luks.MasterKey = masterKey
+			return nil
+		}
+	}
+	return ErrInvalidPassphrase
+}
+
+// digests name the keyslots they verify
+func (luks LUKS) verifyDigest(keyslotID string, masterKey []byte) bool {
+	for _, digest := range luks.Metadata.Digests {
+		hasKeyslot := false
+		for _, id := range digest.Keyslots {
+			hasKeyslot = hasKeyslot || id == keyslotID
+		}
+		newHash, ok := Hashes[digest.Hash]
+		if !hasKeyslot || digest.Type != "pbkdf2" || !ok {
+			continue
+		}
+		salt, err := base64.StdEncoding.DecodeString(digest.Salt)
+		if err != nil {
+			continue
+		}
+		expected, err := base64.StdEncoding.DecodeString(digest.Digest)
+		if err != nil {
+			continue
+		}
+		if bytes.Equal(pbkdf2.Key(masterKey, salt, digest.Iterations, len(expected), newHash), expected) {
+			return true
+		}
+	}
+	return false
+}
+
+func (kdf KDF) deriveKey(passphrase []byte, keySize int) ([]byte, error) {
+	salt, err := base64.StdEncoding.DecodeString(kdf.Salt)
+	if err != nil {
+		return nil, err
+	}
+	switch kdf.Type {
+	case "pbkdf2":
+		newHash, ok := Hashes[kdf.Hash]
+		if !ok {
+			return nil, fmt.Errorf("unsupported hash %s", kdf.Hash)
+		}
+		return pbkdf2.Key(passphrase, salt, kdf.Iterations, keySize, newHash), nil
+	case "argon2i":
+		return argon2.Key(passphrase, salt, uint32(kdf.Time), uint32(kdf.Memory), uint8(kdf.CPUs), uint32(keySize)), nil
+	case "argon2id":
+		return argon2.IDKey(passphrase, salt, uint32(kdf.Time), uint32(kdf.Memory), uint8(kdf.CPUs), uint32(keySize)), nil
+	}
+	return nil, fmt.Errorf("unsupported KDF %s", kdf.Type)
+}
+
+// key material is encrypted with the derived key, sectors are numbered from its start
+func readKeyMaterial(hD img.DiskReader, offsetB int64, size int, encryption string, key []byte) ([]byte, error) {
+	sc, err := newSectorCipher(encryption, key, SectorSize)
+	if err != nil {
+		return nil, err
+	}
+	alignedSize := (size + SectorSize - 1) / SectorSize * SectorSize
+	material := hD.ReadFile(offsetB, alignedSize)
+	if len(material) < alignedSize {
+		return nil, errors.New("key material could not be read")
+	}
+	for sector := 0; sector < alignedSize/SectorSize; sector++ {
+		sc.decrypt(material[sector*SectorSize:(sector+1)*SectorSize], uint64(sector))
+	}
+	return material[:size], nil
+}
+
+// corrupt keyslots must not size the key material
+func isValidKeyMaterial(keySize int, stripes int) bool {
+	return keySize > 0 && stripes > 0 && stripes <= MaxKeyMaterialSize/keySize
+}
+
+// anti-forensic merge, every stripe but the last is xored and diffused
+func afMerge(material []byte, keySize int, stripes int, newHash func() hash.Hash) []byte {
+	merged := make([]byte, keySize)
+	for stripe := 0; stripe < stripes-1; stripe++ {
+		xorBytes(merged, material[stripe*keySize:(stripe+1)*keySize])
+		merged = diffuse(merged, newHash)
+	}
+	xorBytes(merged, material[(stripes-1)*keySize:stripes*keySize])
+	return merged
+}
+
+// hashes digest sized blocks prefixed by their big endian index
+func diffuse(data []byte, newHash func() hash.Hash) []byte {
+	h := newHash()
+	digestSize := h.Size()
+	diffused := make([]byte, len(data))
+	iv := make([]byte, 4)
+	for block := 0; block*digestSize < len(data); block++ {
+		end := (block + 1) * digestSize
+		if end > len(data) {
+			end = len(data)
+		}
+		h.Reset()
+		binary.BigEndian.PutUint32(iv, uint32(block))
+		h.Write(iv)
+		h.Write(data[block*digestSize : end])
+		copy(diffused[block*digestSize:end], h.Sum(nil))
+	}
+	return diffused
+}
+
+func xorBytes(dst []byte, src []byte) {
+	for idx := range dst {
+		dst[idx] ^= src[idx]
+	}
+}
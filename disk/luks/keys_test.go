@@ -0,0 +1,54 @@
+package luks
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// stripes split as in cryptsetup AF_split, the random stripes are a byte sequence
+// and the last one is the diffused xor of them with the master key
+func TestAFMerge(t *testing.T) {
+	for _, vector := range []struct {
+		hash       string
+		keySize    int
+		stripes    int
+		lastStripe string
+	}{
+		{"sha1", 32, 4, "54d114d2ce84e0c25f3e8d1e788dffb999d8b6d7e469a1c6c12cb69e28b57b25"},
+		{"sha256", 32, 4, "3ad5adf16cebf1c1e284fc2f251ca830e6783531c93a3f4ade6368f1b87fb9d9"},
+		{"sha256", 40, 3, "a1db417ec1bda07f099b00b79f179366ddaf3e5872d3217826d756824fd2f8d14a93d6f756fa3586"},
+	} {
+		material := make([]byte, vector.keySize*(vector.stripes-1))
+		for idx := range material {
+			material[idx] = byte(idx)
+		}
+		lastStripe, err := hex.DecodeString(vector.lastStripe)
+		if err != nil {
+			t.Fatal(err)
+		}
+		material = append(material, lastStripe...)
+
+		masterKey := make([]byte, vector.keySize)
+		for idx := range masterKey {
+			masterKey[idx] = 0xa0 + byte(idx)
+		}
+		merged := afMerge(material, vector.keySize, vector.stripes, Hashes[vector.hash])
+		if !bytes.Equal(merged, masterKey) {
+			t.Errorf("%s %d stripes merged %x", vector.hash, vector.stripes, merged)
+		}
+	}
+}
+
+// corrupt keyslots are skipped instead of aborting the others
+func TestUnlockCorruptKeySlots(t *testing.T) {
+	header := &Header{KeyBytes: 32}
+	copy(header.HashSpec[:], "sha256")
+	header.KeySlots[0] = KeySlot{Active: KeySlotEnabled, Iterations: 1}
+	header.KeySlots[1] = KeySlot{Active: KeySlotEnabled, Iterations: 1, Stripes: 4000, KeyMaterialOffset: 8}
+	luks := LUKS{Header: header, Encryption: "aes-xts-plain64"}
+
+	if err := luks.Unlock(memoryReader{}, 0, []byte("passphrase")); err != ErrInvalidPassphrase {
+		t.Errorf("unlock error %v", err)
+	}
+}
@@ -0,0 +1,243 @@
+package luks
+
+/*LUKS keeps the master key in keyslots, each encrypted by a key derived from a passphrase and split
+in stripes by the anti-forensic splitter, the digest of the master key tells which keyslot unlocked*/
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aarsakian/FileSystemForensics/img"
+	"github.com/aarsakian/FileSystemForensics/utils"
+)
+
+const Magic = "LUKS\xba\xbe"
+
+const HeaderSize = 592
+
+// binary header of LUKS2 precedes the JSON metadata area
+const BinaryHeaderSize = 4096
+
+// header sizes allowed by cryptsetup, powers of two
+const (
+	MinHeader2Size = 16 * 1024
+	MaxHeader2Size = 4 * 1024 * 1024
+)
+
+const SectorSize = 512
+
+// LUKS1 keyslot states
+const KeySlotEnabled = 0x00AC71F3
+
+const KeySlotDisabled = 0x0000DEAD
+
+var ErrUnsupportedVersion = errors.New("unsupported LUKS version")
+
+type LUKS struct {
+	Version        uint16
+	Header         *Header  //LUKS1
+	Header2        *Header2 //LUKS2
+	Metadata       *Metadata
+	Encryption     string //cipher-mode-iv e.g. aes-xts-plain64
+	PayloadOffsetB int64  //from the start of the header
+	PayloadSizeB   int64  //0 extends to the end of the partition
+	SectorSize     int
+	IVTweak        uint64
+	MasterKey      []byte
+}
+
+// LUKS1 header, fields are big endian
+type Header struct {
+	Magic              [6]byte
+	Version            uint16
+	CipherName         [32]byte
+	CipherMode         [32]byte
+	HashSpec           [32]byte
+	PayloadOffset      uint32 //sectors
+	KeyBytes           uint32
+	MKDigest           [20]byte
+	MKDigestSalt       [32]byte
+	MKDigestIterations uint32
+	UUID               [40]byte
+	KeySlots           [8]KeySlot
+}
+
+type KeySlot struct {
+	Active            uint32
+	Iterations        uint32
+	Salt              [32]byte
+	KeyMaterialOffset uint32 //sectors
+	Stripes           uint32
+}
+
+// LUKS2 binary header, fields are big endian
+type Header2 struct {
+	Magic             [6]byte
+	Version           uint16
+	HeaderSize        uint64 //binary header and JSON area
+	SequenceID        uint64
+	Label             [48]byte
+	ChecksumAlgorithm [32]byte
+	Salt              [64]byte
+	UUID              [40]byte
+	Subsystem         [48]byte
+	HeaderOffset      uint64
+	Padding           [184]byte
+	Checksum          [64]byte
+}
+
+// LUKS2 JSON metadata, sizes and offsets are strings of bytes
+type Metadata struct {
+	Keyslots map[string]Keyslot `json:"keyslots"`
+	Segments map[string]Segment `json:"segments"`
+	Digests  map[string]Digest  `json:"digests"`
+}
+
+type Keyslot struct {
+	Type    string `json:"type"`
+	KeySize int    `json:"key_size"`
+	AF      struct {
+		Type    string `json:"type"`
+		Stripes int    `json:"stripes"`
+		Hash    string `json:"hash"`
+	} `json:"af"`
+	Area struct {
+		Type       string `json:"type"`
+		Offset     string `json:"offset"`
+		Size       string `json:"size"`
+		Encryption string `json:"encryption"`
+		KeySize    int    `json:"key_size"`
+	} `json:"area"`
+	KDF KDF `json:"kdf"`
+}
+
+type KDF struct {
+	Type       string `json:"type"` //pbkdf2, argon2i or argon2id
+	Hash       string `json:"hash"`
+	Iterations int    `json:"iterations"`
+	Time       int    `json:"time"`
+	Memory     int    `json:"memory"` //KiB
+	CPUs       int    `json:"cpus"`
+	Salt       string `json:"salt"` //base64
+}
+
+type Segment struct {
+	Type       string `json:"type"`
+	Offset     string `json:"offset"`
+	Size       string `json:"size"` //dynamic extends to the end of the device
+	IVTweak    string `json:"iv_tweak"`
+	Encryption string `json:"encryption"`
+	SectorSize int    `json:"sector_size"`
+}
+
+type Digest struct {
+	Type       string   `json:"type"`
+	Keyslots   []string `json:"keyslots"`
+	Segments   []string `json:"segments"`
+	Hash       string   `json:"hash"`
+	Iterations int      `json:"iterations"`
+	Salt       string   `json:"salt"`
+	Digest     string   `json:"digest"`
+}
+
+func HasSignature(data []byte) bool {
+	return len(data) >= 6 && string(data[:6]) == Magic
+}
+
+func (luks *LUKS) Process(hD img.DiskReader, volumeOffsetB int64) error {
+	data := hD.ReadFile(volumeOffsetB, BinaryHeaderSize)
+	if !HasSignature(data) || len(data) < HeaderSize {
+		return errors.New("no LUKS signature")
+	}
+	luks.Version = binary.BigEndian.Uint16(data[6:8])
+	switch luks.Version {
+	case 1:
+		return luks.parseHeader(data)
+	case 2:
+		return luks.parseHeader2(hD, volumeOffsetB, data)
+	}
+	return ErrUnsupportedVersion
+}
+
+func (luks *LUKS) parseHeader(data []byte) error {
+	luks.Header = new(Header)
+	err := binary.Read(bytes.NewReader(data), binary.BigEndian, luks.Header)
+	if err != nil {
+		return err
+	}
+	luks.Encryption = fmt.Sprintf("%s-%s", utils.RemoveNulls(luks.Header.CipherName[:]),
+		utils.RemoveNulls(luks.Header.CipherMode[:]))
+	luks.PayloadOffsetB = int64(luks.Header.PayloadOffset) * SectorSize
+	luks.SectorSize = SectorSize
+	return nil
+}
+
+func (luks *LUKS) parseHeader2(hD img.DiskReader, volumeOffsetB int64, data []byte) error {
+	luks.Header2 = new(Header2)
+	err := binary.Read(bytes.NewReader(data), binary.BigEndian, luks.Header2)
+	if err != nil {
+		return err
+	}
+	headerSize := luks.Header2.HeaderSize
+	if headerSize < MinHeader2Size || headerSize > MaxHeader2Size || headerSize&(headerSize-1) != 0 {
+		return fmt.Errorf("invalid LUKS2 header size %d", luks.Header2.HeaderSize)
+	}
+	jsonArea := hD.ReadFile(volumeOffsetB+BinaryHeaderSize, int(luks.Header2.HeaderSize-BinaryHeaderSize))
+	luks.Metadata = new(Metadata)
+	err = json.Unmarshal(bytes.TrimRight(jsonArea, "\x00"), luks.Metadata)
+	if err != nil {
+		return fmt.Errorf("LUKS2 metadata %s", err)
+	}
+
+	// a single crypt segment maps the payload
+	for _, segment := range luks.Metadata.Segments {
+		if segment.Type != "crypt" {
+			continue
+		}
+		luks.Encryption = segment.Encryption
+		luks.PayloadOffsetB, _ = strconv.ParseInt(segment.Offset, 10, 64)
+		if segment.Size != "dynamic" {
+			luks.PayloadSizeB, _ = strconv.ParseInt(segment.Size, 10, 64)
+		}
+		luks.IVTweak, _ = strconv.ParseUint(segment.IVTweak, 10, 64)
+		luks.SectorSize = segment.SectorSize
+		if luks.SectorSize == 0 {
+			luks.SectorSize = SectorSize
+		}
+		return nil
+	}
+	return errors.New("LUKS2 has no crypt segment")
+}
+
+func (luks LUKS) GetUUID() string {
+	if luks.Header != nil {
+		return string(utils.RemoveNulls(luks.Header.UUID[:]))
+	}
+	return string(utils.RemoveNulls(luks.Header2.UUID[:]))
+}
+
+func (luks LUKS) GetKeyslots() []string {
+	var keyslots []string
+	if luks.Header != nil {
+		for idx, slot := range luks.Header.KeySlots {
+			if slot.Active == KeySlotEnabled {
+				keyslots = append(keyslots, fmt.Sprintf("%d pbkdf2 %s", idx, utils.RemoveNulls(luks.Header.HashSpec[:])))
+			}
+		}
+		return keyslots
+	}
+	for id, keyslot := range luks.Metadata.Keyslots {
+		keyslots = append(keyslots, fmt.Sprintf("%s %s", id, keyslot.KDF.Type))
+	}
+	return keyslots
+}
+
+func (luks LUKS) GetInfo() string {
+	return fmt.Sprintf("LUKS%d %s %s payload at %d sector size %d keyslots %s", luks.Version, luks.GetUUID(),
+		luks.Encryption, luks.PayloadOffsetB, luks.SectorSize, strings.Join(luks.GetKeyslots(), ", "))
+}
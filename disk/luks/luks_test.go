@@ -0,0 +1,44 @@
+package luks
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// unreadable areas are short reads
+type memoryReader struct {
+	data []byte
+}
+
+func (reader memoryReader) CreateHandler() {}
+
+func (reader memoryReader) CloseHandler() {}
+
+func (reader memoryReader) ReadFile(offset int64, length int) []byte {
+	if offset >= int64(len(reader.data)) {
+		return nil
+	}
+	end := offset + int64(length)
+	if end > int64(len(reader.data)) {
+		end = int64(len(reader.data))
+	}
+	return reader.data[offset:end]
+}
+
+func (reader memoryReader) GetDiskSize() int64 {
+	return int64(len(reader.data))
+}
+
+func TestProcessHeader2Size(t *testing.T) {
+	for _, headerSize := range []uint64{0, 4096, 24 * 1024, 8 * 1024 * 1024, 1 << 63} {
+		data := make([]byte, BinaryHeaderSize)
+		copy(data, Magic)
+		binary.BigEndian.PutUint16(data[6:], 2)
+		binary.BigEndian.PutUint64(data[8:], headerSize)
+
+		var luks LUKS
+		if err := luks.Process(memoryReader{data: data}, 0); err == nil {
+			t.Errorf("header size %d accepted", headerSize)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package luks
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/aarsakian/FileSystemForensics/img"
+	"github.com/aarsakian/FileSystemForensics/logger"
+	"golang.org/x/crypto/xts"
+)
+
+// cipher-mode-iv specifications of dm-crypt
+var Encryptions = map[string]bool{
+	"aes-xts-plain64": true, "aes-xts-plain": true, "aes-cbc-essiv:sha256": true,
+	"aes-cbc-plain64": true, "aes-cbc-plain": true,
+}
+
+type sectorCipher struct {
+	encryption string
+	sectorSize int
+	xtsCipher  *xts.Cipher
+	block      cipher.Block
+	essiv      cipher.Block
+}
+
+func newSectorCipher(encryption string, key []byte, sectorSize int) (*sectorCipher, error) {
+	if !Encryptions[encryption] {
+		return nil, fmt.Errorf("unsupported encryption %s", encryption)
+	}
+	sc := &sectorCipher{encryption: encryption, sectorSize: sectorSize}
+	var err error
+	switch encryption {
+	case "aes-xts-plain64", "aes-xts-plain":
+		sc.xtsCipher, err = xts.NewCipher(aes.NewCipher, key)
+	case "aes-cbc-essiv:sha256":
+		sc.block, err = aes.NewCipher(key)
+		if err == nil {
+			hashedKey := sha256.Sum256(key)
+			sc.essiv, err = aes.NewCipher(hashedKey[:])
+		}
+	default:
+		sc.block, err = aes.NewCipher(key)
+	}
+	return sc, err
+}
+
+// plain IVs keep the lower 32 bits of the sector number
+func (sc sectorCipher) decrypt(data []byte, sectorNum uint64) {
+	if sc.encryption == "aes-xts-plain" || sc.encryption == "aes-cbc-plain" {
+		sectorNum &= 0xffffffff
+	}
+	if sc.xtsCipher != nil {
+		sc.xtsCipher.Decrypt(data, data, sectorNum)
+		return
+	}
+	iv := make([]byte, aes.BlockSize)
+	binary.LittleEndian.PutUint64(iv, sectorNum)
+	if sc.essiv != nil {
+		sc.essiv.Encrypt(iv, iv)
+	}
+	cipher.NewCBCDecrypter(sc.block, iv).CryptBlocks(data, data)
+}
+
+// presents the decrypted payload in place of the LUKS volume, reads outside it pass through
+type DecryptingReader struct {
+	Handler       img.DiskReader
+	VolumeOffsetB int64
+	VolumeSizeB   int64 //0 when the partition size is unknown
+	LUKS          *LUKS
+	sectorCipher  *sectorCipher
+}
+
+func NewDecryptingReader(hD img.DiskReader, volumeOffsetB int64, volumeSizeB int64, luks *LUKS) (*DecryptingReader, error) {
+	sc, err := newSectorCipher(luks.Encryption, luks.MasterKey, luks.SectorSize)
+	if err != nil {
+		return nil, err
+	}
+	return &DecryptingReader{Handler: hD, VolumeOffsetB: volumeOffsetB, VolumeSizeB: volumeSizeB, LUKS: luks,
+		sectorCipher: sc}, nil
+}
+
+func (reader *DecryptingReader) CreateHandler() {
+
+}
+
+func (reader *DecryptingReader) CloseHandler() {
+	reader.Handler.CloseHandler()
+}
+
+func (reader DecryptingReader) GetDiskSize() int64 {
+	return reader.Handler.GetDiskSize()
+}
+
+// dynamic segments end with the partition, reads of the following partitions pass through
+func (reader DecryptingReader) getPayloadSize() int64 {
+	volumeSizeB := reader.VolumeSizeB
+	if volumeSizeB == 0 {
+		volumeSizeB = reader.Handler.GetDiskSize() - reader.VolumeOffsetB
+	}
+	maxPayloadSizeB := volumeSizeB - reader.LUKS.PayloadOffsetB
+	if reader.LUKS.PayloadSizeB != 0 && reader.LUKS.PayloadSizeB < maxPayloadSizeB {
+		return reader.LUKS.PayloadSizeB
+	}
+	return maxPayloadSizeB
+}
+
+func (reader DecryptingReader) ReadFile(offset int64, length int) []byte {
+	payloadEnd := reader.VolumeOffsetB + reader.getPayloadSize()
+	end := offset + int64(length)
+	if end <= reader.VolumeOffsetB || offset >= payloadEnd {
+		return reader.Handler.ReadFile(offset, length)
+	}
+
+	var data []byte
+	if offset < reader.VolumeOffsetB { // part before the volume
+		data = reader.Handler.ReadFile(offset, int(reader.VolumeOffsetB-offset))
+		offset = reader.VolumeOffsetB
+	}
+	decryptedEnd := end
+	if decryptedEnd > payloadEnd {
+		decryptedEnd = payloadEnd
+	}
+
+	sectorSize := int64(reader.LUKS.SectorSize)
+	start := (offset - reader.VolumeOffsetB) / sectorSize * sectorSize
+	alignedEnd := (decryptedEnd - reader.VolumeOffsetB + sectorSize - 1) / sectorSize * sectorSize
+	sectors := reader.Handler.ReadFile(reader.VolumeOffsetB+reader.LUKS.PayloadOffsetB+start, int(alignedEnd-start))
+	if int64(len(sectors)) < alignedEnd-start {
+		msg := fmt.Sprintf("LUKS read %d bytes instead of %d at %d", len(sectors), alignedEnd-start, start)
+		logger.MFTExtractorlogger.Warning(msg)
+		sectors = append(sectors, make([]byte, alignedEnd-start-int64(len(sectors)))...)
+	}
+	for pos := int64(0); pos < alignedEnd-start; pos += sectorSize {
+		sectorNum := uint64((start+pos)/sectorSize) + reader.LUKS.IVTweak
+		reader.sectorCipher.decrypt(sectors[pos:pos+sectorSize], sectorNum)
+	}
+	data = append(data, sectors[offset-reader.VolumeOffsetB-start:decryptedEnd-reader.VolumeOffsetB-start]...)
+
+	if end > payloadEnd {
+		data = append(data, reader.Handler.ReadFile(payloadEnd, int(end-payloadEnd))...)
+	}
+	return data
+}
@@ -13,6 +13,8 @@ import (
 var PartitionTypeGuids = map[string]string{
 	"ebd0a0a2-b9e5-4433-87c0-68b6b72699c7": "Windows",
 	"a19d880f-05fc-4d3b-a006-743f0f84911e": "Linux RAID",
+	"0fc63daf-8483-4772-8e79-3d69d8477de4": "Linux filesystem",
+	"e6d6d379-f507-44c2-a23c-238f2a3df928": "Linux LVM",
 }
 
 type GPT struct {
@@ -104,6 +106,11 @@ func (partition Partition) GetOffset() uint64 {
 	return partition.StartLBA + offset
 }
 
+// sectors from the offset to the last LBA
+func (partition Partition) GetSize() uint64 {
+	return partition.EndLBA + 1 - partition.GetOffset()
+}
+
 func (partition Partition) GetVolInfo() string {
 	if partition.Volume != nil {
 		return partition.Volume.GetInfo()
@@ -122,7 +129,11 @@ func (partition *Partition) LocateVolume(hD img.DiskReader) {
 
 		ntfs := new(volume.NTFS)
 		ntfs.AddVolume(data)
-		partition.Volume = ntfs
+		if ntfs.HasValidSignature() { // encrypted volumes are located after unlocking
+			partition.Volume = ntfs
+		} else {
+			partition.Volume = nil
+		}
 	} else if partition.GetPartitionType() == "Linux RAID" {
 		data := hD.ReadFile(int64(partitionOffetB+8*512), 512)       //8 sectors after superblock
 		if utils.Hexify(utils.Bytereverse(data[:4])) == "a92b4efc" { //valid ?
@@ -135,6 +146,15 @@ func (partition *Partition) LocateVolume(hD img.DiskReader) {
 			partition.Volume = lvm2
 		}
 
+	} else if partition.GetPartitionType() == "Linux filesystem" || partition.GetPartitionType() == "Linux LVM" {
+		data := hD.ReadFile(int64(partitionOffetB), 1024) // LUKS payloads are located after unlocking
+		if lvmlib.HasLVM2Label(data) {
+			lvm2 := new(lvmlib.LVM2)
+			lvm2.ProcessHeader(hD, int64(partitionOffetB))
+			partition.Volume = lvm2
+		} else {
+			partition.Volume = nil
+		}
 	} else {
 		partition.Volume = nil
 	}
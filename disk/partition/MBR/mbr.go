@@ -39,23 +39,35 @@ func (partition Partition) GetOffset() uint64 {
 	return uint64(partition.StartLBA)
 }
 
+func (partition Partition) GetSize() uint64 {
+	return uint64(partition.Size)
+}
+
 func (partition Partition) GetPartitionType() string {
 	return PartitionTypes[partition.Type]
 }
 
 func (partition *Partition) LocateVolume(hD img.DiskReader) {
 	partitionOffetB := uint64(partition.GetOffset() * 512)
-	data := hD.ReadFile(int64(partitionOffetB), 512)
+	data := hD.ReadFile(int64(partitionOffetB), 1024)
 	if partition.Type == 0x07 || partition.Type == 0x17 {
 
 		ntfs := new(volume.NTFS)
-		ntfs.AddVolume(data)
+		ntfs.AddVolume(data[:512])
 
 		if ntfs.HasValidSignature() {
 			partition.Volume = ntfs
 		} else {
 			partition.Volume = nil
 		}
+	} else if partition.Type == 0x83 || partition.Type == 0x8e {
+		if volume.HasLVM2Label(data) {
+			lvm2 := new(volume.LVM2)
+			lvm2.ProcessHeader(hD, int64(partitionOffetB))
+			partition.Volume = lvm2
+		} else {
+			partition.Volume = nil
+		}
 	}
 
 }
@@ -64,6 +76,10 @@ func (extPartition ExtendedPartition) GetOffset() uint64 {
 	return uint64(extPartition.Partition.StartLBA) + uint64(extPartition.TableOffset)
 }
 
+func (extPartition ExtendedPartition) GetSize() uint64 {
+	return uint64(extPartition.Partition.Size)
+}
+
 func (extPartition *ExtendedPartition) LocateVolume(hD img.DiskReader) {
 	extPartition.Partition.LocateVolume(hD)
 }
@@ -134,6 +150,9 @@ func (mbr *MBR) UpdateExtendedPartitionsOffsets(extendedTableSectorOffset uint32
 }
 
 func (partition Partition) GetVolInfo() string {
+	if partition.Volume != nil {
+		return partition.Volume.GetInfo()
+	}
 	return ""
 }
 
@@ -0,0 +1,61 @@
+package volume
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aarsakian/FileSystemForensics/utils"
+)
+
+const AttrDefEntrySize = 160
+
+// $AttrDef flags
+var AttrDefFlags = map[uint32]string{
+	0x02: "Indexed", 0x04: "Multiple", 0x08: "Not null", 0x10: "Unique",
+	0x20: "Named", 0x40: "Resident", 0x80: "Log non resident",
+}
+
+// definition of an attribute type, entry of $AttrDef
+type AttrDef struct {
+	Name          [128]byte //0-128 UTF16 padded with zeros
+	Type          uint32    //128-132
+	DisplayRule   uint32    //132-136
+	CollationRule uint32    //136-140
+	Flags         uint32    //140-144
+	MinSize       uint64    //144-152
+	MaxSize       uint64    //152-160
+}
+
+type AttrDefs []AttrDef
+
+func ParseAttrDefs(data []byte) AttrDefs {
+	var attrDefs AttrDefs
+	for offset := 0; offset+AttrDefEntrySize <= len(data); offset += AttrDefEntrySize {
+		var attrDef AttrDef
+		utils.Unmarshal(data[offset:offset+AttrDefEntrySize], &attrDef)
+		if attrDef.Type == 0 { // list ends with an empty entry
+			break
+		}
+		attrDefs = append(attrDefs, attrDef)
+	}
+	return attrDefs
+}
+
+func (attrDef AttrDef) GetName() string {
+	return string(utils.RemoveNulls([]byte(utils.DecodeUTF16(attrDef.Name[:]))))
+}
+
+func (attrDef AttrDef) GetFlags() []string {
+	var flags []string
+	for _, flag := range []uint32{0x02, 0x04, 0x08, 0x10, 0x20, 0x40, 0x80} {
+		if attrDef.Flags&flag != 0 {
+			flags = append(flags, AttrDefFlags[flag])
+		}
+	}
+	return flags
+}
+
+func (attrDef AttrDef) GetInfo() string {
+	return fmt.Sprintf("%-32s type 0x%x size %d-%d flags %s", attrDef.GetName(), attrDef.Type,
+		attrDef.MinSize, int64(attrDef.MaxSize), strings.Join(attrDef.GetFlags(), ", "))
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 
 	"github.com/aarsakian/FileSystemForensics/FS/BTRFS"
+	"github.com/aarsakian/FileSystemForensics/FS/NTFS/MFT"
 	"github.com/aarsakian/FileSystemForensics/img"
 	"github.com/aarsakian/FileSystemForensics/utils"
 )
@@ -56,6 +57,11 @@ type RawLocationDescriptor struct {
 	Flags  uint64
 }
 
+// label resides at the 2nd sector of the physical volume
+func HasLVM2Label(data []byte) bool {
+	return len(data) >= 1024 && string(data[512:520]) == "LABELONE"
+}
+
 func (lvm2 *LVM2) ProcessHeader(hD img.DiskReader, physicalOffsetB int64) {
 	data := hD.ReadFile(physicalOffsetB, 4096)
 	lvm2.Parse(data)
@@ -138,10 +144,24 @@ func (lvm2 LVM2) GetSignature() string {
 	return string(lvm2.Header.PhysicalVolLabelHeader.Signature[:])
 }
 
+// logical volumes hold no MFT records
+func (lvm2 LVM2) GetFSMetadata() []MFT.Record {
+	return nil
+}
+
 func (lvm2 LVM2) CollectUnallocated(hD img.DiskReader, partitionOffsetB int64, blocks chan<- []byte) {
 
 }
 
+// no file system records to validate
+func (lvm2 LVM2) ShowHealth(hD img.DiskReader, partitionOffsetB int64) {
+
+}
+
+func (lvm2 LVM2) AssessRecoverability(hD img.DiskReader, partitionOffsetB int64) {
+
+}
+
 func (lvm2 LVM2) GetInfo() string {
 	prettyJson, err := json.MarshalIndent(lvm2.ConfigurationInfo, "", " ")
 	if err != nil {
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"math"
+	"strings"
 
 	"github.com/aarsakian/FileSystemForensics/FS/NTFS/MFT"
 	MFTAttributes "github.com/aarsakian/FileSystemForensics/FS/NTFS/MFT/attributes"
@@ -13,20 +14,56 @@ import (
 )
 
 type NTFS struct {
-	VBR *VBR
-	MFT *MFT.MFTTable
+	VBR       *VBR
+	BackupVBR *VBR //last sector of the volume
+	MFT       *MFT.MFTTable
+	AttrDefs  AttrDefs
 }
 
 type VBR struct { //Volume Boot Record
-	JumpInstruction   [3]byte //0-3
-	Signature         [4]byte //4 bytes NTFS 3-7
-	NotUsed1          [4]byte
-	BytesPerSector    uint16   // 11-13
-	SectorsPerCluster uint8    //13
-	NotUsed2          [26]byte //13-39
-	TotalSectors      uint64   //39-47
-	MFTOffset         uint64   //48-56
-	MFTMirrOffset     uint64   //56-64
+	JumpInstruction   [3]byte   //0-3
+	Signature         [4]byte   //4 bytes NTFS 3-7
+	NotUsed1          [4]byte   //OEM ID padding 7-11
+	BytesPerSector    uint16    // 11-13
+	SectorsPerCluster uint8     //13
+	ReservedSectors   uint16    //14-16
+	NotUsed2          [5]byte   //16-21 always zero
+	MediaDescriptor   uint8     //21
+	NotUsed3          [2]byte   //22-24
+	SectorsPerTrack   uint16    //24-26
+	NumberOfHeads     uint16    //26-28
+	HiddenSectors     uint32    //28-32 sectors before the volume
+	NotUsed4          [8]byte   //32-40
+	TotalSectors      uint64    //40-48
+	MFTOffset         uint64    //48-56
+	MFTMirrOffset     uint64    //56-64
+	ClustersPerRecord uint8     //64 signed, negative gives the size as a power of two
+	NotUsed5          [3]byte   //65-68
+	ClustersPerIndex  uint8     //68 signed, as per record
+	NotUsed6          [3]byte   //69-72
+	SerialNumber      uint64    //72-80
+	Checksum          uint32    //80-84
+	BootCode          [426]byte //84-510
+	EndMarker         uint16    //510-512 0xAA55
+}
+
+// fields expected to agree between the boot sector and its backup
+var vbrFields = []struct {
+	name  string
+	value func(vbr VBR) uint64
+}{
+	{"signature", func(vbr VBR) uint64 { return uint64(utils.ToUint32(vbr.Signature[:])) }},
+	{"bytes per sector", func(vbr VBR) uint64 { return uint64(vbr.BytesPerSector) }},
+	{"sectors per cluster", func(vbr VBR) uint64 { return uint64(vbr.SectorsPerCluster) }},
+	{"hidden sectors", func(vbr VBR) uint64 { return uint64(vbr.HiddenSectors) }},
+	{"total sectors", func(vbr VBR) uint64 { return vbr.TotalSectors }},
+	{"$MFT cluster", func(vbr VBR) uint64 { return vbr.MFTOffset }},
+	{"$MFTMirr cluster", func(vbr VBR) uint64 { return vbr.MFTMirrOffset }},
+	{"clusters per record", func(vbr VBR) uint64 { return uint64(vbr.ClustersPerRecord) }},
+	{"clusters per index", func(vbr VBR) uint64 { return uint64(vbr.ClustersPerIndex) }},
+	{"serial number", func(vbr VBR) uint64 { return vbr.SerialNumber }},
+	{"checksum", func(vbr VBR) uint64 { return uint64(vbr.Checksum) }},
+	{"end marker", func(vbr VBR) uint64 { return uint64(vbr.EndMarker) }},
 }
 
 func (ntfs *NTFS) AddVolume(data []byte) {
@@ -46,6 +83,8 @@ func (ntfs *NTFS) Process(hD img.DiskReader, partitionOffsetB int64, MFTSelected
 
 	data := hD.ReadFile(physicalOffset, length)
 
+	ntfs.BackupVBR = ntfs.readBackupVBR(hD, partitionOffsetB)
+
 	ntfs.MFT = new(MFT.MFTTable)
 	ntfs.MFT.ProcessRecords(data)
 	ntfs.MFT.DetermineClusterOffsetLength()
@@ -66,13 +105,133 @@ func (ntfs *NTFS) Process(hD img.DiskReader, partitionOffsetB int64, MFTSelected
 		logger.MFTExtractorlogger.Info(msg)
 		ntfs.MFT.FindParentRecords()
 
+		msg = "Resolving symbolic links and junctions targets"
+		fmt.Printf("%s\n", msg)
+		logger.MFTExtractorlogger.Info(msg)
+		ntfs.MFT.ResolveLinks()
+
+		msg = "Resolving security descriptors from $Secure:$SDS"
+		fmt.Printf("%s\n", msg)
+		logger.MFTExtractorlogger.Info(msg)
+		ntfs.MFT.ResolveSecurityDescriptors(hD, partitionOffsetB, int64(ntfs.VBR.SectorsPerCluster)*int64(ntfs.VBR.BytesPerSector))
+
+		msg = "Loading $UpCase for case insensitive name matching"
+		fmt.Printf("%s\n", msg)
+		logger.MFTExtractorlogger.Info(msg)
+		ntfs.MFT.ResolveUpCase(hD, partitionOffsetB, int64(ntfs.VBR.SectorsPerCluster)*int64(ntfs.VBR.BytesPerSector))
+
+		msg = "Resolving object ids from $ObjId:$O"
+		fmt.Printf("%s\n", msg)
+		logger.MFTExtractorlogger.Info(msg)
+		ntfs.MFT.ResolveObjectIDs()
+
 		msg = "Calculating files sizes from $I30"
 		fmt.Printf("%s\n", msg)
 		logger.MFTExtractorlogger.Info(msg)
 		ntfs.MFT.CalculateFileSizes()
 
+		ntfs.AttrDefs = ntfs.readAttrDefs(hD, partitionOffsetB)
+
+	}
+
+}
+
+// $MFTMirr holds copies of the first $MFT records, at least four
+const MinMirrorRecords = 4
+
+// findings of comparing $MFTMirr with $MFT and validating the $MFT records
+type HealthReport struct {
+	MirrorRecords int
+	Issues        []MFT.IntegrityIssue
+}
+
+// compares $MFTMirr with the first records of $MFT, the boot sector offsets with the runlists,
+// and validates the $MFT bitmap, sequence numbers and base references
+func (ntfs NTFS) CheckHealth(hD img.DiskReader, partitionOffsetB int64) HealthReport {
+	clusterSizeB := int64(ntfs.VBR.SectorsPerCluster) * int64(ntfs.VBR.BytesPerSector)
+	var report HealthReport
+
+	for _, metadataFile := range []struct {
+		entry  uint32
+		offset uint64
+	}{{0, ntfs.VBR.MFTOffset}, {1, ntfs.VBR.MFTMirrOffset}} {
+		if int(metadataFile.entry) >= len(ntfs.MFT.Records) {
+			break
+		}
+		record := ntfs.MFT.Records[metadataFile.entry]
+		firstCluster := getFirstCluster(record)
+		if firstCluster != int64(metadataFile.offset) {
+			report.Issues = append(report.Issues, MFT.IntegrityIssue{Entry: metadataFile.entry, Check: "boot sector",
+				Detail: fmt.Sprintf("cluster %d in boot sector, %d in %s runlist", metadataFile.offset, firstCluster,
+					record.GetFname())})
+		}
+	}
+
+	report.MirrorRecords = int(clusterSizeB) / MFT.RecordSize
+	if report.MirrorRecords < MinMirrorRecords {
+		report.MirrorRecords = MinMirrorRecords
+	}
+	mftData := hD.ReadFile(partitionOffsetB+int64(ntfs.VBR.MFTOffset)*clusterSizeB, report.MirrorRecords*MFT.RecordSize)
+	mirrorData := hD.ReadFile(partitionOffsetB+int64(ntfs.VBR.MFTMirrOffset)*clusterSizeB, report.MirrorRecords*MFT.RecordSize)
+	for entry := 0; entry < report.MirrorRecords; entry++ {
+		start, end := entry*MFT.RecordSize, (entry+1)*MFT.RecordSize
+		if end > len(mftData) || end > len(mirrorData) {
+			report.Issues = append(report.Issues, MFT.IntegrityIssue{Entry: uint32(entry), Check: "$MFTMirr",
+				Detail: "could not be read"})
+			continue
+		}
+		if string(mirrorData[start:start+4]) != "FILE" {
+			report.Issues = append(report.Issues, MFT.IntegrityIssue{Entry: uint32(entry), Check: "$MFTMirr",
+				Detail: "copy has no FILE signature"})
+		} else if !bytes.Equal(mftData[start:end], mirrorData[start:end]) {
+			report.Issues = append(report.Issues, MFT.IntegrityIssue{Entry: uint32(entry), Check: "$MFTMirr",
+				Detail: "copy differs from $MFT record"})
+		}
 	}
 
+	report.Issues = append(report.Issues, ntfs.MFT.ValidateRecords()...)
+	return report
+}
+
+// start cluster of the unnamed data stream, -1 when it is resident or missing
+func getFirstCluster(record MFT.Record) int64 {
+	attr := record.FindAttribute("DATA")
+	if attr == nil || !attr.IsNoNResident() || attr.GetHeader().ATRrecordNoNResident.RunList == nil {
+		return -1
+	}
+	return attr.GetHeader().ATRrecordNoNResident.RunList.Offset
+}
+
+func (report HealthReport) ShowInfo() {
+	issuesPerCheck := map[string]int{}
+	for _, issue := range report.Issues {
+		issuesPerCheck[issue.Check]++
+	}
+	fmt.Printf("volume health: %d $MFTMirr records compared, %d issues\n", report.MirrorRecords, len(report.Issues))
+	for _, check := range []string{"boot sector", "$MFTMirr", "bitmap", "sequence", "base reference"} {
+		fmt.Printf("%s: %d\n", check, issuesPerCheck[check])
+	}
+	for _, issue := range report.Issues {
+		issue.ShowInfo()
+	}
+}
+
+// clusters of deleted records are compared with the runs of allocated records and $Bitmap, all $MFT records are needed
+func (ntfs NTFS) AssessRecoverability(hD img.DiskReader, partitionOffsetB int64) {
+	if ntfs.MFT == nil { // volume not processed
+		return
+	}
+	msg := "Assessing recoverability of deleted records from $Bitmap"
+	fmt.Printf("%s\n", msg)
+	logger.MFTExtractorlogger.Info(msg)
+	ntfs.MFT.AssessRecoverability(ntfs.readBitmap(hD, partitionOffsetB))
+}
+
+func (ntfs NTFS) ShowHealth(hD img.DiskReader, partitionOffsetB int64) {
+	if ntfs.MFT == nil { // volume not processed
+		return
+	}
+	ntfs.CheckHealth(hD, partitionOffsetB).ShowInfo()
 }
 
 func (vbr *VBR) Parse(data []byte) {
@@ -80,46 +239,134 @@ func (vbr *VBR) Parse(data []byte) {
 }
 
 func (ntfs NTFS) GetFSMetadata() []MFT.Record {
+	if ntfs.MFT == nil { // volume not processed
+		return nil
+	}
 	return ntfs.MFT.Records
 }
 
 func (ntfs NTFS) GetInfo() string {
-	return fmt.Sprintf("%s size %d cluster size %d", ntfs.GetSignature(), ntfs.VBR.TotalSectors*uint64(ntfs.VBR.BytesPerSector),
-		ntfs.VBR.SectorsPerCluster)
+	var info strings.Builder
+	vbr := ntfs.VBR
+	fmt.Fprintf(&info, "%s size %d cluster size %d\n", ntfs.GetSignature(), vbr.TotalSectors*uint64(vbr.BytesPerSector),
+		vbr.SectorsPerCluster)
+	fmt.Fprintf(&info, "serial number %s bytes per sector %d sectors per cluster %d hidden sectors %d total sectors %d\n",
+		vbr.GetSerialNumber(), vbr.BytesPerSector, vbr.SectorsPerCluster, vbr.HiddenSectors, vbr.TotalSectors)
+	fmt.Fprintf(&info, "$MFT cluster %d $MFTMirr cluster %d record size %d index buffer size %d checksum %x\n",
+		vbr.MFTOffset, vbr.MFTMirrOffset, vbr.GetRecordSize(), vbr.GetIndexBufferSize(), vbr.Checksum)
+
+	if ntfs.BackupVBR != nil {
+		differences := vbr.Compare(*ntfs.BackupVBR)
+		if len(differences) == 0 {
+			info.WriteString("backup boot sector matches\n")
+		} else {
+			fmt.Fprintf(&info, "backup boot sector differs in %s\n", strings.Join(differences, ", "))
+		}
+	}
+
+	var volumeRecords MFT.Records
+	if ntfs.MFT != nil { // selected entries may not include $Volume
+		volumeRecords = utils.Filter(ntfs.MFT.Records, func(record MFT.Record) bool {
+			return record.Entry == 3 && record.GetFname() == "$Volume"
+		})
+	}
+	if len(volumeRecords) > 0 {
+		volumeRecord := volumeRecords[0]
+		attr := volumeRecord.FindAttribute("Volume Name")
+		if attr != nil {
+			fmt.Fprintf(&info, "volume name %s\n", attr.(*MFTAttributes.VolumeName).Name)
+		}
+		attr = volumeRecord.FindAttribute("Volume Information")
+		if attr != nil {
+			volinfo := attr.(*MFTAttributes.VolumeInfo)
+			fmt.Fprintf(&info, "NTFS version %s dirty %t flags %s\n", volinfo.GetVersion(), volinfo.IsDirty(),
+				strings.Join(volinfo.GetFlags(), ", "))
+		}
+	} else {
+		logger.MFTExtractorlogger.Warning("$Volume record not found.")
+	}
+
+	if len(ntfs.AttrDefs) > 0 {
+		fmt.Fprintf(&info, "$AttrDef %d attribute types\n", len(ntfs.AttrDefs))
+		for _, attrDef := range ntfs.AttrDefs {
+			fmt.Fprintf(&info, "%s\n", attrDef.GetInfo())
+		}
+	}
+	return info.String()
 }
 
+// backup boot sector follows the last sector of the volume
+func (ntfs NTFS) readBackupVBR(hD img.DiskReader, partitionOffsetB int64) *VBR {
+	data := hD.ReadFile(partitionOffsetB+int64(ntfs.VBR.TotalSectors)*int64(ntfs.VBR.BytesPerSector),
+		int(ntfs.VBR.BytesPerSector))
+	if len(data) < 512 {
+		logger.MFTExtractorlogger.Warning("backup boot sector could not be read.")
+		return nil
+	}
+	backupVBR := new(VBR)
+	backupVBR.Parse(data)
+	return backupVBR
+}
+
+func (ntfs NTFS) readAttrDefs(hD img.DiskReader, partitionOffsetB int64) AttrDefs {
+	clusterSizeB := int64(ntfs.VBR.SectorsPerCluster) * int64(ntfs.VBR.BytesPerSector)
+
+	attrDefRecords := utils.Filter(ntfs.MFT.Records, func(record MFT.Record) bool {
+		return record.Entry == 4 && record.GetFname() == "$AttrDef"
+	})
+	if len(attrDefRecords) == 0 {
+		logger.MFTExtractorlogger.Warning("$AttrDef record not found.")
+		return nil
+	}
+	return ParseAttrDefs(attrDefRecords[0].ReadStream(hD, partitionOffsetB, clusterSizeB, ""))
+}
+
+// sends unallocated clusters of $Bitmap, consecutive clusters are read in blocks up to fragment size
 func (ntfs NTFS) CollectUnallocated(hD img.DiskReader, partitionOffsetB int64, blocks chan<- []byte) {
+	clusterSizeB := int64(ntfs.VBR.SectorsPerCluster) * int64(ntfs.VBR.BytesPerSector)
 
-	record := ntfs.MFT.Records[0]
-	bitmap := record.FindAttribute("BitMap").(*MFTAttributes.BitMap)
-	unallocatedClusters := bitmap.GetUnallocatedClusters()
-	var buf bytes.Buffer
+	allocationStatus := ntfs.readBitmap(hD, partitionOffsetB)
+	if allocationStatus == nil {
+		return
+	}
 
-	blockSize := 1 // nof consecutive clusters
-	prevClusterOffset := unallocatedClusters[0]
+	bitmap := MFTAttributes.BitMap{AllocationStatus: allocationStatus}
+	totalClusters := int(ntfs.VBR.TotalSectors / uint64(ntfs.VBR.SectorsPerCluster))
+	clustersPerBlock := int(MFT.FragmentSize / clusterSizeB)
 
-	for idx, unallocatedCluster := range unallocatedClusters {
-		if idx == 0 {
-			continue
+	for _, run := range bitmap.GetUnallocatedRuns() {
+		if run.Start >= totalClusters { // bitmap is padded to bytes
+			break
 		}
-		if unallocatedCluster-prevClusterOffset <= 1 {
-			blockSize += 1
-		} else {
-			buf.Grow(blockSize * int(ntfs.VBR.BytesPerSector))
-			firstBlockCluster := unallocatedClusters[idx-blockSize]
-			offset := partitionOffsetB + int64(firstBlockCluster)*int64(ntfs.VBR.SectorsPerCluster*uint8(ntfs.VBR.BytesPerSector))
-			buf.Write(hD.ReadFile(offset, int(uint16(blockSize)*(uint16(ntfs.VBR.SectorsPerCluster)*ntfs.VBR.BytesPerSector))))
-			blockSize = 1
-			blocks <- buf.Bytes()
-
+		if run.Start+run.Length > totalClusters {
+			run.Length = totalClusters - run.Start
+		}
+		for cluster := 0; cluster < run.Length; cluster += clustersPerBlock {
+			nofClusters := clustersPerBlock
+			if cluster+nofClusters > run.Length {
+				nofClusters = run.Length - cluster
+			}
+			offset := partitionOffsetB + int64(run.Start+cluster)*clusterSizeB
+			blocks <- hD.ReadFile(offset, nofClusters*int(clusterSizeB))
 		}
-		prevClusterOffset = unallocatedCluster
-
 	}
-	close(blocks)
 
 }
 
+// allocation status of the volume clusters, a bit per cluster
+func (ntfs NTFS) readBitmap(hD img.DiskReader, partitionOffsetB int64) []byte {
+	clusterSizeB := int64(ntfs.VBR.SectorsPerCluster) * int64(ntfs.VBR.BytesPerSector)
+
+	bitmapRecords := utils.Filter(ntfs.MFT.Records, func(record MFT.Record) bool {
+		return record.Entry == 6 && record.GetFname() == "$Bitmap"
+	})
+	if len(bitmapRecords) == 0 {
+		logger.MFTExtractorlogger.Warning("$Bitmap record not found, cannot locate unallocated clusters.")
+		return nil
+	}
+	return bitmapRecords[0].ReadStream(hD, partitionOffsetB, clusterSizeB, "")
+}
+
 func (ntfs *NTFS) ProcessMFT(data []byte, MFTSelectedEntries []int,
 	fromMFTEntry int, toMFTEntry int) {
 
@@ -200,6 +447,37 @@ func (ntfs NTFS) CollectMFTArea(hD img.DiskReader, partitionOffsetB int64) []byt
 	return buf.Bytes()
 }
 
+// names of the fields that differ from the other boot sector
+func (vbr VBR) Compare(other VBR) []string {
+	var differences []string
+	for _, field := range vbrFields {
+		if field.value(vbr) != field.value(other) {
+			differences = append(differences, field.name)
+		}
+	}
+	return differences
+}
+
+func (vbr VBR) GetSerialNumber() string {
+	return fmt.Sprintf("%04X-%04X", uint16(vbr.SerialNumber>>16), uint16(vbr.SerialNumber))
+}
+
+func (vbr VBR) GetRecordSize() int {
+	return vbr.clustersToBytes(vbr.ClustersPerRecord)
+}
+
+func (vbr VBR) GetIndexBufferSize() int {
+	return vbr.clustersToBytes(vbr.ClustersPerIndex)
+}
+
+// positive values count clusters, negative ones are the exponent of the size
+func (vbr VBR) clustersToBytes(clusters uint8) int {
+	if int8(clusters) < 0 {
+		return 1 << uint(-int8(clusters))
+	}
+	return int(clusters) * int(vbr.SectorsPerCluster) * int(vbr.BytesPerSector)
+}
+
 func (vbr VBR) GetSignature() string {
 	return string(vbr.Signature[:])
 }
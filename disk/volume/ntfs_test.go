@@ -0,0 +1,30 @@
+package volume
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aarsakian/FileSystemForensics/FS/NTFS/MFT"
+	MFTAttributes "github.com/aarsakian/FileSystemForensics/FS/NTFS/MFT/attributes"
+	"github.com/aarsakian/FileSystemForensics/utils"
+)
+
+func newNamedRecord(entry uint32, fname string, volumeName string) MFT.Record {
+	fnattr := &MFTAttributes.FNAttribute{Header: &MFTAttributes.AttributeHeader{Type: [4]byte{0x30}},
+		Fname: fname, Nspace: 3}
+	volName := &MFTAttributes.VolumeName{Header: &MFTAttributes.AttributeHeader{Type: [4]byte{0x60}},
+		Name: utils.NoNull(volumeName)}
+	return MFT.Record{Entry: entry, Attributes: []MFT.Attribute{fnattr, volName}}
+}
+
+// selected entries shift the records, $Volume is not at index 3
+func TestGetInfoFindsVolumeRecord(t *testing.T) {
+	ntfs := NTFS{VBR: &VBR{}, MFT: &MFT.MFTTable{Records: MFT.Records{
+		newNamedRecord(0, "$MFT", ""), newNamedRecord(3, "$Volume", "EVIDENCE"),
+		newNamedRecord(30, "a", ""), newNamedRecord(31, "b", "STALE"),
+	}}}
+	info := ntfs.GetInfo()
+	if !strings.Contains(info, "volume name EVIDENCE") || strings.Contains(info, "STALE") {
+		t.Errorf("volume information %s", info)
+	}
+}
@@ -1,13 +1,18 @@
 package volume
 
-import "github.com/aarsakian/FileSystemForensics/img"
+import (
+	"github.com/aarsakian/FileSystemForensics/FS/NTFS/MFT"
+	"github.com/aarsakian/FileSystemForensics/img"
+)
 
 type Volume interface {
 	Process(img.DiskReader, int64, []int, int, int)
 	GetSectorsPerCluster() int
 	GetBytesPerSector() uint64
 	GetInfo() string
-	//GetFSMetadata() []MFT.Record
+	GetFSMetadata() []MFT.Record
 	CollectUnallocated(img.DiskReader, int64, chan<- []byte)
 	GetSignature() string
+	ShowHealth(img.DiskReader, int64)
+	AssessRecoverability(img.DiskReader, int64)
 }
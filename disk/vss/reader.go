@@ -0,0 +1,105 @@
+package vss
+
+import (
+	"github.com/aarsakian/FileSystemForensics/img"
+)
+
+// presents the volume as it was when the snapshot was created, reads outside the volume pass through
+type SnapshotReader struct {
+	Handler       img.DiskReader
+	VolumeOffsetB int64
+	VolumeSize    int64
+	Snapshots     []*Snapshot //selected snapshot followed by the newer ones
+}
+
+func NewSnapshotReader(hD img.DiskReader, volumeOffsetB int64, vss VSS, index int) (*SnapshotReader, error) {
+	snapshot, err := vss.GetSnapshot(index)
+	if err != nil {
+		return nil, err
+	}
+	reader := &SnapshotReader{Handler: hD, VolumeOffsetB: volumeOffsetB,
+		VolumeSize: int64(snapshot.SnapshotEntry.VolumeSize)}
+	for _, snapshot := range vss.Snapshots[index-1:] {
+		snapshot.ReadBlockList(hD, volumeOffsetB)
+		reader.Snapshots = append(reader.Snapshots, snapshot)
+	}
+	return reader, nil
+}
+
+func (reader *SnapshotReader) CreateHandler() {
+
+}
+
+func (reader *SnapshotReader) CloseHandler() {
+	reader.Handler.CloseHandler()
+}
+
+func (reader SnapshotReader) GetDiskSize() int64 {
+	return reader.Handler.GetDiskSize()
+}
+
+func (reader SnapshotReader) ReadFile(offset int64, length int) []byte {
+	volumeEnd := reader.VolumeOffsetB + reader.VolumeSize
+	end := offset + int64(length)
+	if end <= reader.VolumeOffsetB || offset >= volumeEnd {
+		return reader.Handler.ReadFile(offset, length)
+	}
+
+	data := make([]byte, 0, length)
+	for pos := offset; pos < end; {
+		if pos < reader.VolumeOffsetB { // part before the volume
+			data = append(data, reader.Handler.ReadFile(pos, int(reader.VolumeOffsetB-pos))...)
+			pos = reader.VolumeOffsetB
+			continue
+		}
+		if pos >= volumeEnd { // part after the volume
+			data = append(data, reader.Handler.ReadFile(pos, int(end-pos))...)
+			break
+		}
+		blockOffset := (pos - reader.VolumeOffsetB) / BlockSize * BlockSize
+		start := pos - reader.VolumeOffsetB - blockOffset
+		nofBytes := BlockSize - start
+		if pos+nofBytes > end {
+			nofBytes = end - pos
+		}
+		block := reader.readBlock(uint64(blockOffset))
+		data = append(data, block[start:start+nofBytes]...)
+		pos += nofBytes
+	}
+	return data
+}
+
+// the oldest copy made after the snapshot holds the content, unchanged blocks are read from the volume
+func (reader SnapshotReader) readBlock(blockOffset uint64) []byte {
+	lookupOffset := blockOffset
+	var data []byte
+	for _, snapshot := range reader.Snapshots {
+		descriptor, ok := snapshot.Blocks[lookupOffset]
+		if !ok {
+			continue
+		}
+		if descriptor.IsForwarder() { // content moved, continue with newer stores
+			lookupOffset = descriptor.RelativeOffset
+			continue
+		}
+		data = reader.Handler.ReadFile(reader.VolumeOffsetB+int64(descriptor.StoreOffset), BlockSize)
+		break
+	}
+	if data == nil {
+		data = reader.Handler.ReadFile(reader.VolumeOffsetB+int64(lookupOffset), BlockSize)
+	}
+	if len(data) < BlockSize {
+		data = append(data, make([]byte, BlockSize-len(data))...)
+	}
+
+	// sectors copied before a partial overwrite, a bit per sector
+	for _, overlay := range reader.Snapshots[0].Overlays[blockOffset] {
+		overlayData := reader.Handler.ReadFile(reader.VolumeOffsetB+int64(overlay.StoreOffset), BlockSize)
+		for sector := 0; sector < BlockSize/512 && (sector+1)*512 <= len(overlayData); sector++ {
+			if overlay.AllocationBitmap&(1<<sector) != 0 {
+				copy(data[sector*512:(sector+1)*512], overlayData[sector*512:(sector+1)*512])
+			}
+		}
+	}
+	return data
+}
@@ -0,0 +1,305 @@
+package vss
+
+/*volume shadow copies keep the original content of blocks overwritten after the snapshot
+in store files under System Volume Information, the catalog locates the stores of every snapshot*/
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/aarsakian/FileSystemForensics/img"
+	"github.com/aarsakian/FileSystemForensics/logger"
+	"github.com/aarsakian/FileSystemForensics/utils"
+)
+
+// relative to the start of the volume
+const VolumeHeaderOffset = 0x1e00
+
+// size of catalog, block list blocks and of copied data blocks
+const BlockSize = 0x4000
+
+const BlockHeaderSize = 128
+
+const CatalogEntrySize = 128
+
+const BlockDescriptorSize = 32
+
+var ErrNoShadowCopies = errors.New("no volume shadow copies found")
+
+var Identifier = [16]byte{0x6b, 0x87, 0x08, 0x38, 0x76, 0xc1, 0x48, 0x4e, 0xb7, 0xae, 0x04, 0x04, 0x6e, 0x6c, 0xc7, 0x52}
+
+var RecordTypes = map[uint32]string{
+	1: "volume header", 2: "catalog", 3: "block list", 4: "store header",
+	5: "store block range", 6: "store bitmap",
+}
+
+// catalog entry types
+const SnapshotEntryType = 2
+
+const StoreEntryType = 3
+
+// block descriptor flags
+const ForwarderFlag = 0x01
+
+const OverlayFlag = 0x02
+
+const NotUsedFlag = 0x04
+
+type VSS struct {
+	Header    VolumeHeader
+	Snapshots []*Snapshot //oldest first
+}
+
+type VolumeHeader struct {
+	Identifier      [16]byte
+	Version         uint32
+	RecordType      uint32
+	CurrentOffset   uint64
+	Unknown1        uint64
+	Unknown2        uint64
+	CatalogOffset   uint64 //0 when no snapshots
+	MaximumSize     uint64
+	VolumeID        [16]byte
+	StorageVolumeID [16]byte
+}
+
+// starts catalog, block list and store header blocks
+type BlockHeader struct {
+	Identifier     [16]byte
+	Version        uint32
+	RecordType     uint32
+	RelativeOffset uint64
+	CurrentOffset  uint64
+	NextOffset     uint64 //0 for the last block
+}
+
+// catalog entry type 2
+type SnapshotEntry struct {
+	Type           uint64
+	VolumeSize     uint64
+	StoreID        [16]byte
+	SequenceNumber uint64
+	Flags          uint64
+	CreationTime   utils.WindowsTime
+}
+
+// catalog entry type 3
+type StoreEntry struct {
+	Type                 uint64
+	BlockListOffset      uint64
+	StoreID              [16]byte
+	StoreHeaderOffset    uint64
+	BlockRangeListOffset uint64
+	CurrentBitmapOffset  uint64
+	FileRef              uint64
+	AllocatedSize        uint64
+	PreviousBitmapOffset uint64
+}
+
+// follows the block header of the store header
+type StoreInfo struct {
+	Unknown         [16]byte
+	ShadowCopyID    [16]byte
+	ShadowCopySetID [16]byte
+	Context         uint32
+	Unknown2        uint32
+	AttributeFlags  uint32
+	Unknown3        uint32
+}
+
+// original offset of a block and where its copy was stored, offsets are relative to the volume
+type BlockDescriptor struct {
+	OriginalOffset   uint64
+	RelativeOffset   uint64 //forwarded original offset
+	StoreOffset      uint64
+	Flags            uint32
+	AllocationBitmap uint32 //sectors of overlay blocks
+}
+
+type Snapshot struct {
+	Index            int
+	SnapshotEntry    SnapshotEntry
+	StoreEntry       StoreEntry
+	StoreInfo        StoreInfo
+	OperatingMachine string
+	ServiceMachine   string
+	Blocks           map[uint64]BlockDescriptor
+	Overlays         map[uint64][]BlockDescriptor
+}
+
+func (vss *VSS) Process(hD img.DiskReader, volumeOffsetB int64) error {
+	data := hD.ReadFile(volumeOffsetB+VolumeHeaderOffset, 512)
+	if len(data) < 512 {
+		return ErrNoShadowCopies
+	}
+	utils.Unmarshal(data, &vss.Header)
+	if vss.Header.Identifier != Identifier || RecordTypes[vss.Header.RecordType] != "volume header" ||
+		vss.Header.CatalogOffset == 0 {
+		return ErrNoShadowCopies
+	}
+
+	snapshots := map[[16]byte]*Snapshot{}
+	var storeIDs [][16]byte
+	visited := map[uint64]bool{}
+	for offset := vss.Header.CatalogOffset; offset != 0 && !visited[offset]; {
+		visited[offset] = true
+		data := hD.ReadFile(volumeOffsetB+int64(offset), BlockSize)
+		header, err := parseBlockHeader(data, "catalog")
+		if err != nil {
+			logger.MFTExtractorlogger.Warning(fmt.Sprintf("VSS catalog at %d %s", offset, err))
+			break
+		}
+		for entryOffset := BlockHeaderSize; entryOffset+CatalogEntrySize <= len(data); entryOffset += CatalogEntrySize {
+			entry := data[entryOffset : entryOffset+CatalogEntrySize]
+			switch binary.LittleEndian.Uint64(entry[:8]) {
+			case SnapshotEntryType:
+				snapshot := &Snapshot{}
+				utils.Unmarshal(entry, &snapshot.SnapshotEntry)
+				snapshots[snapshot.SnapshotEntry.StoreID] = snapshot
+				storeIDs = append(storeIDs, snapshot.SnapshotEntry.StoreID)
+			case StoreEntryType:
+				var storeEntry StoreEntry
+				utils.Unmarshal(entry, &storeEntry)
+				snapshot, ok := snapshots[storeEntry.StoreID]
+				if ok {
+					snapshot.StoreEntry = storeEntry
+				}
+			}
+		}
+		offset = header.NextOffset
+	}
+
+	for _, storeID := range storeIDs {
+		snapshot := snapshots[storeID]
+		if snapshot.StoreEntry.BlockListOffset == 0 {
+			logger.MFTExtractorlogger.Warning(fmt.Sprintf("VSS store %s has no location entry",
+				utils.StringifyGUID(storeID[:])))
+			continue
+		}
+		snapshot.readStoreHeader(hD, volumeOffsetB)
+		vss.Snapshots = append(vss.Snapshots, snapshot)
+	}
+
+	sort.Slice(vss.Snapshots, func(i, j int) bool {
+		return vss.Snapshots[i].SnapshotEntry.CreationTime.Stamp < vss.Snapshots[j].SnapshotEntry.CreationTime.Stamp
+	})
+	for idx, snapshot := range vss.Snapshots {
+		snapshot.Index = idx + 1
+	}
+	if len(vss.Snapshots) == 0 {
+		return ErrNoShadowCopies
+	}
+	return nil
+}
+
+// identifiers and machine names of the shadow copy
+func (snapshot *Snapshot) readStoreHeader(hD img.DiskReader, volumeOffsetB int64) {
+	data := hD.ReadFile(volumeOffsetB+int64(snapshot.StoreEntry.StoreHeaderOffset), BlockSize)
+	_, err := parseBlockHeader(data, "store header")
+	if err != nil {
+		logger.MFTExtractorlogger.Warning(fmt.Sprintf("VSS store header %s", err))
+		return
+	}
+	offset := BlockHeaderSize
+	utils.Unmarshal(data[offset:], &snapshot.StoreInfo)
+	offset += 64
+
+	snapshot.OperatingMachine, offset = readString(data, offset)
+	snapshot.ServiceMachine, _ = readString(data, offset)
+}
+
+// descriptors of the blocks copied to the store, read once before the snapshot is accessed
+func (snapshot *Snapshot) ReadBlockList(hD img.DiskReader, volumeOffsetB int64) {
+	if snapshot.Blocks != nil {
+		return
+	}
+	snapshot.Blocks = map[uint64]BlockDescriptor{}
+	snapshot.Overlays = map[uint64][]BlockDescriptor{}
+
+	visited := map[uint64]bool{}
+	for offset := snapshot.StoreEntry.BlockListOffset; offset != 0 && !visited[offset]; {
+		visited[offset] = true
+		data := hD.ReadFile(volumeOffsetB+int64(offset), BlockSize)
+		header, err := parseBlockHeader(data, "block list")
+		if err != nil {
+			logger.MFTExtractorlogger.Warning(fmt.Sprintf("VSS block list at %d %s", offset, err))
+			break
+		}
+		for entryOffset := BlockHeaderSize; entryOffset+BlockDescriptorSize <= len(data); entryOffset += BlockDescriptorSize {
+			var descriptor BlockDescriptor
+			utils.Unmarshal(data[entryOffset:entryOffset+BlockDescriptorSize], &descriptor)
+			if descriptor == (BlockDescriptor{}) { // unused remainder of the block
+				break
+			}
+			if descriptor.Flags&NotUsedFlag != 0 {
+				continue
+			}
+			if descriptor.Flags&OverlayFlag != 0 {
+				snapshot.Overlays[descriptor.OriginalOffset] = append(snapshot.Overlays[descriptor.OriginalOffset], descriptor)
+			} else {
+				snapshot.Blocks[descriptor.OriginalOffset] = descriptor
+			}
+		}
+		offset = header.NextOffset
+	}
+	msg := fmt.Sprintf("VSS snapshot %d %d blocks %d overlays", snapshot.Index, len(snapshot.Blocks), len(snapshot.Overlays))
+	logger.MFTExtractorlogger.Info(msg)
+}
+
+func (vss VSS) GetSnapshot(index int) (*Snapshot, error) {
+	for _, snapshot := range vss.Snapshots {
+		if snapshot.Index == index {
+			return snapshot, nil
+		}
+	}
+	return nil, fmt.Errorf("snapshot %d not found, volume has %d snapshots", index, len(vss.Snapshots))
+}
+
+func (vss VSS) ShowInfo() {
+	fmt.Printf("VSS version %d snapshots %d maximum size %d\n", vss.Header.Version, len(vss.Snapshots), vss.Header.MaximumSize)
+	for _, snapshot := range vss.Snapshots {
+		snapshot.ShowInfo()
+	}
+}
+
+func (snapshot Snapshot) ShowInfo() {
+	fmt.Printf("snapshot %d created %s shadow copy %s set %s volume size %d machine %s\n", snapshot.Index,
+		snapshot.SnapshotEntry.CreationTime.ConvertToIsoTime(), utils.StringifyGUID(snapshot.StoreInfo.ShadowCopyID[:]),
+		utils.StringifyGUID(snapshot.StoreInfo.ShadowCopySetID[:]), snapshot.SnapshotEntry.VolumeSize,
+		snapshot.OperatingMachine)
+}
+
+func (descriptor BlockDescriptor) IsForwarder() bool {
+	return descriptor.Flags&ForwarderFlag != 0
+}
+
+func parseBlockHeader(data []byte, recordType string) (BlockHeader, error) {
+	var header BlockHeader
+	if len(data) < BlockHeaderSize {
+		return header, errors.New("block could not be read")
+	}
+	utils.Unmarshal(data, &header)
+	if !bytes.Equal(header.Identifier[:], Identifier[:]) {
+		return header, errors.New("invalid VSS identifier")
+	}
+	if RecordTypes[header.RecordType] != recordType {
+		return header, fmt.Errorf("expected %s record found type %d", recordType, header.RecordType)
+	}
+	return header, nil
+}
+
+// UTF16 string prefixed by its size in bytes
+func readString(data []byte, offset int) (string, int) {
+	if offset+2 > len(data) {
+		return "", offset
+	}
+	size := int(binary.LittleEndian.Uint16(data[offset : offset+2]))
+	offset += 2
+	if offset+size > len(data) {
+		return "", offset
+	}
+	return utils.DecodeUTF16(data[offset : offset+size]), offset + size
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/aarsakian/FileSystemForensics/FS/NTFS/MFT"
@@ -12,6 +13,11 @@ import (
 	"github.com/aarsakian/FileSystemForensics/utils"
 )
 
+// EFS encrypted files are exported as raw ciphertext with their $EFS metadata alongside
+const EncryptedSuffix = ".encrypted"
+
+const EFSMetadataSuffix = ".efs.txt"
+
 type Exporter struct {
 	Location string
 	Hash     string
@@ -24,16 +30,30 @@ func (exp Exporter) ExportData(wg *sync.WaitGroup, results <-chan utils.AskedFil
 	for result := range results {
 		if exp.Strategy == "Id" {
 
-			exp.CreateFile(fmt.Sprintf("[%d]%s", result.Id, result.Fname), result.Content)
+			exp.createResultFile(fmt.Sprintf("[%d]%s", result.Id, result.Fname), result)
+
+		} else if exp.Strategy == "Path" { // directory structure of every hard link
+			for _, linkPath := range result.Paths {
+				exp.createResultFile(linkPath, result)
+			}
 
 		} else {
-			exp.CreateFile(result.Fname, result.Content)
+			exp.createResultFile(result.Fname, result)
 		}
 
 	}
 
 }
 
+func (exp Exporter) createResultFile(fname string, result utils.AskedFile) {
+	if result.EFSInfo == "" {
+		exp.CreateFile(fname, result.Content)
+		return
+	}
+	exp.CreateFile(fname+EncryptedSuffix, result.Content)
+	exp.CreateFile(fname+EFSMetadataSuffix, []byte(result.EFSInfo+"\n"))
+}
+
 func (exp Exporter) ExportUnallocated(physicalDisk disk.Disk) {
 
 	blocks := make(chan []byte) // write for consecutive blocks
@@ -44,23 +64,6 @@ func (exp Exporter) ExportUnallocated(physicalDisk disk.Disk) {
 	}
 }
 
-func (exp Exporter) SetFilesToLogicalSize(records []MFT.Record) {
-	var fname string
-	for _, record := range records {
-		if exp.Strategy == "Id" {
-			fname = fmt.Sprintf("[%d]%s", record.Entry, record.GetFname())
-		} else {
-			fname = record.GetFname()
-		}
-
-		e := os.Truncate(filepath.Join(exp.Location, fname), record.GetLogicalFileSize())
-		if e != nil {
-			fmt.Printf("Error truncating %s\n", e)
-		}
-
-	}
-}
-
 func (exp Exporter) ExportRecords(records []MFT.Record, physicalDisk disk.Disk, partitionNum int) {
 	if exp.Location == "" {
 		msg := fmt.Sprintf("No export location was set")
@@ -96,27 +99,62 @@ func (exp Exporter) HashFiles(records []MFT.Record) {
 	}
 	fmt.Printf("Hashing Stage\n")
 	for _, record := range records {
-		fname := record.GetFname()
-
-		data, e := os.ReadFile(filepath.Join(exp.Location, fname))
-		if e != nil {
-			fmt.Printf("ERROR %s", e)
-			continue
+		fnames := []string{record.GetFname()}
+		if exp.Strategy == "Path" { // every hard link was written
+			fnames = record.GetHardLinkPaths()
 		}
-		if exp.Hash == "MD5" {
-			fmt.Printf("File %s has %s %s \n", fname, exp.Hash, utils.GetMD5(data))
-		} else if exp.Hash == "SHA1" {
-			fmt.Printf("File %s has %s %s \n", fname, exp.Hash, utils.GetSHA1(data))
+		for _, fname := range fnames {
+			if record.IsEncrypted() && !record.HasResidentDataAttr() {
+				fname += EncryptedSuffix
+			}
+			exp.hashFile(fname)
 		}
+	}
+
+}
 
+func (exp Exporter) hashFile(fname string) {
+	fullpath, err := exp.getExportPath(fname)
+	if err != nil {
+		fmt.Printf("ERROR %s\n", err)
+		return
+	}
+	data, e := os.ReadFile(fullpath)
+	if e != nil {
+		fmt.Printf("ERROR %s", e)
+		return
 	}
+	if exp.Hash == "MD5" {
+		fmt.Printf("File %s has %s %s \n", fname, exp.Hash, utils.GetMD5(data))
+	} else if exp.Hash == "SHA1" {
+		fmt.Printf("File %s has %s %s \n", fname, exp.Hash, utils.GetSHA1(data))
+	}
+}
 
+// names come from the image, separators and dot components must not leave the export location
+func (exp Exporter) getExportPath(fname string) (string, error) {
+	components := strings.FieldsFunc(fname, func(r rune) bool { return r == '/' || r == '\\' })
+	for idx, component := range components {
+		if strings.Trim(component, ". ") == "" { // windows drops trailing dots and spaces
+			components[idx] = "_"
+		}
+	}
+	fullpath := filepath.Join(append([]string{exp.Location}, components...)...)
+	relpath, err := filepath.Rel(exp.Location, fullpath)
+	if err != nil || relpath == "." || relpath == ".." || strings.HasPrefix(relpath, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside of export location %s", fname, exp.Location)
+	}
+	return fullpath, nil
 }
 
 func (exp Exporter) CreateFile(fname string, data []byte) {
-	var err error
-	fullpath := filepath.Join(exp.Location, fname)
-	err = os.MkdirAll(exp.Location, 0750)
+	fullpath, err := exp.getExportPath(fname)
+	if err != nil {
+		logger.MFTExtractorlogger.Warning(err.Error())
+		fmt.Println(err)
+		return
+	}
+	err = os.MkdirAll(filepath.Dir(fullpath), 0750)
 	if err != nil && !os.IsExist(err) {
 		fmt.Println(err)
 	}
@@ -0,0 +1,33 @@
+package exporter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// names of hard links are taken from the image
+func TestCreateFileStaysInLocation(t *testing.T) {
+	location := filepath.Join(t.TempDir(), "export")
+	exp := Exporter{Location: location}
+
+	for _, fname := range []string{"../../evil", "dir/../../../evil", "..\\..\\evil", "/tmp/evil", "dir\\. .\\file", ".."} {
+		fullpath, err := exp.getExportPath(fname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(fullpath, location+string(filepath.Separator)) {
+			t.Errorf("%s exported to %s", fname, fullpath)
+		}
+
+		exp.CreateFile(fname, []byte("data"))
+		if _, err := os.Stat(fullpath); err != nil {
+			t.Errorf("%s not exported %s", fname, err)
+		}
+	}
+
+	if fullpath, _ := exp.getExportPath("dir\\file"); fullpath != filepath.Join(location, "dir", "file") {
+		t.Errorf("path separators of the image not kept %s", fullpath)
+	}
+}
@@ -1,33 +1,84 @@
 package filters
 
-import "github.com/aarsakian/FileSystemForensics/FS/NTFS/MFT"
+import (
+	"github.com/aarsakian/FileSystemForensics/FS/NTFS/MFT"
+	"github.com/aarsakian/FileSystemForensics/analysis"
+)
 
 type Filter interface {
 	Execute(records MFT.Records) MFT.Records
 }
 
+// names, extensions and paths are matched case insensitively unless Exact
 type NameFilter struct {
 	Filenames []string
+	Exact     bool
 }
 
 func (nameFilter NameFilter) Execute(records MFT.Records) MFT.Records {
-	return records.FilterByNames(nameFilter.Filenames)
+	return records.FilterByNames(nameFilter.Filenames, nameFilter.Exact)
 }
 
 type PathFilter struct {
-	NamePath string
+	NamePath    string
+	FollowLinks bool
+	Exact       bool
 }
 
 func (pathFilter PathFilter) Execute(records MFT.Records) MFT.Records {
-	return records.FilterByPath(pathFilter.NamePath)
+	return records.FilterByPath(pathFilter.NamePath, pathFilter.FollowLinks, pathFilter.Exact)
+}
+
+type OwnerFilter struct {
+	SID string
+}
+
+func (ownerFilter OwnerFilter) Execute(records MFT.Records) MFT.Records {
+	return records.FilterByOwnerSID(ownerFilter.SID)
+}
+
+// object id or birth object id e.g. the droid of a LNK file
+type ObjectIDFilter struct {
+	GUID string
+}
+
+func (objectIDFilter ObjectIDFilter) Execute(records MFT.Records) MFT.Records {
+	return records.FilterByObjectID(objectIDFilter.GUID)
+}
+
+// WSL owner and group from extended attributes, -1 matches any
+type POSIXOwnerFilter struct {
+	UID int
+	GID int
+}
+
+func (posixOwnerFilter POSIXOwnerFilter) Execute(records MFT.Records) MFT.Records {
+	return records.FilterByPOSIXOwner(posixOwnerFilter.UID, posixOwnerFilter.GID)
+}
+
+type TimestompFilter struct {
+	Timestomp *analysis.Timestomp
+}
+
+func (timestompFilter TimestompFilter) Execute(records MFT.Records) MFT.Records {
+	return timestompFilter.Timestomp.Filter(records)
+}
+
+type RecoverabilityFilter struct {
+	Statuses []string
+}
+
+func (recoverabilityFilter RecoverabilityFilter) Execute(records MFT.Records) MFT.Records {
+	return records.FilterByRecoverability(recoverabilityFilter.Statuses)
 }
 
 type ExtensionsFilter struct {
 	Extensions []string
+	Exact      bool
 }
 
 func (extensionsFilter ExtensionsFilter) Execute(records MFT.Records) MFT.Records {
-	return records.FilterByExtensions(extensionsFilter.Extensions)
+	return records.FilterByExtensions(extensionsFilter.Extensions, extensionsFilter.Exact)
 }
 
 type OrphansFilter struct {
@@ -66,11 +117,12 @@ func (foldersFilter FoldersFilter) Execute(records MFT.Records) MFT.Records {
 type PrefixesSuffixesFilter struct {
 	Prefixes []string
 	Suffixes []string
+	Exact    bool
 }
 
 func (prefSufFilter PrefixesSuffixesFilter) Execute(records MFT.Records) MFT.Records {
 	for idx, prefix := range prefSufFilter.Prefixes {
-		records = records.FilterByPrefixSuffix(prefix, prefSufFilter.Suffixes[idx])
+		records = records.FilterByPrefixSuffix(prefix, prefSufFilter.Suffixes[idx], prefSufFilter.Exact)
 	}
 
 	return records
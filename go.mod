@@ -6,6 +6,7 @@ require golang.org/x/sys v0.12.0
 
 require (
 	github.com/aarsakian/VMDK_Reader v0.0.0-20240910071554-9d72aac7f6b9
+	golang.org/x/crypto v0.13.0
 	golang.org/x/text v0.13.0
 )
 
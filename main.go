@@ -14,7 +14,9 @@ import (
 	EWFLogger "github.com/aarsakian/EWF_Reader/logger"
 
 	"github.com/aarsakian/FileSystemForensics/FS/NTFS/MFT"
+	LogFile "github.com/aarsakian/FileSystemForensics/FS/NTFS/logfile"
 	UsnJrnl "github.com/aarsakian/FileSystemForensics/FS/NTFS/usnjrnl"
+	"github.com/aarsakian/FileSystemForensics/analysis"
 	"github.com/aarsakian/FileSystemForensics/disk"
 	"github.com/aarsakian/FileSystemForensics/disk/volume"
 	"github.com/aarsakian/FileSystemForensics/exporter"
@@ -58,6 +60,20 @@ func main() {
 	showAttributes := flag.String("attributes", "", "show file system attributes (write any for all attributes)")
 	showTimestamps := flag.Bool("timestamps", false, "show all file system timestamps")
 	showIndex := flag.Bool("index", false, "show index structures")
+	showListing := flag.Bool("listdir", false, "show the ordered listing of directories by walking their index B+tree")
+	showIndexSlack := flag.Bool("indexslack", false, "show deleted entries carved from the slack of directory index buffers alongside the live entries")
+	showReparse := flag.Bool("reparse", false, "show reparse point information")
+	showSecurity := flag.Bool("security", false, "show security descriptors, owner, group and access control entries")
+	showWSL := flag.Bool("wsl", false, "show WSL POSIX owner, group, mode and device decoded from extended attributes")
+	posixUID := flag.Int("uid", -1, "select files owned by a WSL POSIX user id")
+	posixGID := flag.Int("gid", -1, "select files owned by a WSL POSIX group id")
+	showEFS := flag.Bool("efs", false, "show EFS encrypted files with the users and recovery agents able to decrypt them, exported files keep the raw ciphertext")
+	showObjectID := flag.Bool("objid", false, "show object ids and birth ids with their GUID v1 timestamps and MAC addresses")
+	showTxF := flag.Bool("txf", false, "show transactional NTFS files with their TxF ids, CLFS LSNs and transacted journal changes, and the $RmMetadata files ($Tops and the $TxfLog CLFS log are located, LSNs are not resolved against the log)")
+	objectID := flag.String("objectid", "", "select files by object id or birth object id e.g. the droid of a LNK file")
+	ownerSID := flag.String("owner", "", "select files owned by a SID e.g. S-1-5-21-1004336348-1177238915-682003330-1001")
+	followLinks := flag.Bool("followlinks", false, "follow symbolic links and junctions when resolving paths and showing the tree")
+	exactNames := flag.Bool("exactnames", false, "match filenames, extensions and paths exactly instead of case insensitively by the $UpCase table")
 
 	physicalDrive := flag.Int("physicaldrive", -1, "select disk drive number")
 	partitionNum := flag.Int("partition", -1, "select partition number")
@@ -73,28 +89,53 @@ func main() {
 	deleted := flag.Bool("deleted", false, "show deleted records")
 
 	listPartitions := flag.Bool("listpartitions", false, "list partitions")
+	listShadowCopies := flag.Bool("listvss", false, "list volume shadow copies of NTFS partitions")
+	recoveryPassword := flag.String("recoverypassword", "", "recovery password to unlock BitLocker volumes, 8 groups of 6 digits separated by -")
+	bekFile := flag.String("bekfile", "", "path to .BEK startup key file to unlock BitLocker volumes")
+	luksPassphrase := flag.String("lukspassphrase", "", "passphrase to unlock LUKS volumes")
+	luksKeyFile := flag.String("lukskeyfile", "", "path to key file to unlock LUKS volumes")
+	shadowCopy := flag.Int("vss", 0, "select volume shadow copy by index (oldest is 1) to process instead of the live volume")
 	fileExtensions := flag.String("extensions", "", "search file system records by extensions use comma as a seperator")
 	collectUnallocated := flag.Bool("unallocated", false, "collect unallocated area of a volume")
 	hashFiles := flag.String("hash", "", "hash exported files, enter md5 or sha1")
-	volinfo := flag.Bool("volinfo", false, "show volume information")
+	volinfo := flag.Bool("volinfo", false, "show volume information, boot sector fields compared with the backup, $Volume name, version, flags and $AttrDef, with logfile the $LogFile restart area")
+	health := flag.Bool("health", false, "show volume health report comparing $MFTMirr with $MFT and validating $MFT bitmap, sequence numbers and base references.")
 	logactive := flag.Bool("log", false, "enable logging")
 	showPath := flag.Bool("showpath", false, "show the full path of the selected files.")
-	strategy := flag.String("strategy", "overwrite", "what strategy will be used for files sharing the same name, default is ovewrite, or use Id")
+	strategy := flag.String("strategy", "overwrite", "what strategy will be used for files sharing the same name, default is ovewrite, or use Id, or Path to recreate the directories of every hard link")
 	usnjrnl := flag.Bool("usnjrnl", false, "show usnjrnl information about changes to files and folders.")
+	carveUsnjrnl := flag.Bool("carveusn", false, "carve usnjrnl records from unallocated clusters, use showusn to display them.")
+	showRecovery := flag.Bool("recoverability", false, "show whether data of deleted records is fully recoverable, partially overwritten or lost.")
+	recoverable := flag.String("recoverable", "", "select deleted records by recoverability e.g. full,partial or lost use comma as a seperator.")
+	timestomp := flag.Bool("timestomp", false, "show only records with timestamp anomalies (SI/FN mismatches, zeroed sub-seconds, volume lifetime, usnjrnl events) and the rules that fired.")
+	collected := flag.String("collected", "", "acquisition time for timestomp analysis in RFC3339 e.g. 2024-01-31T10:00:00Z, defaults to the newest usnjrnl event.")
+	carveMFT := flag.Bool("carvemft", false, "carve MFT records from unallocated clusters, selected records are shown and exported separately from the live ones.")
+	logfile := flag.Bool("logfile", false, "show $LogFile metadata operations (creates, renames, deletes, attribute updates) per file.")
 
 	flag.Parse() //ready to parse
 
 	var records MFT.Records
 	var usnjrnlRecords UsnJrnl.Records
+	var logfileRecords LogFile.Records
 	var fileNamesToExport []string
 
 	entries := utils.GetEntriesInt(*MFTSelectedEntries)
+	allEntries := len(entries) == 0 && *fromMFTEntry == -1 && *toMFTEntry == math.MaxUint32
+	assessRecoverability := *showRecovery || *recoverable != ""
 
 	if *usnjrnl {
 		fileNamesToExport = append(fileNamesToExport, "$UsnJrnl")
 	}
 
-	recordsTree := tree.Tree{}
+	recordsTree := tree.Tree{FollowLinks: *followLinks}
+
+	timestompAnalysis := &analysis.Timestomp{}
+	collectedTime := uint64(0)
+	if *collected != "" {
+		acquired, err := time.Parse(time.RFC3339, *collected)
+		checkErr(err, "collected time must be in RFC3339 format")
+		collectedTime = analysis.ToWindowsTime(acquired)
+	}
 
 	rp := reporter.Reporter{
 		ShowFileName:   *showFileName,
@@ -106,10 +147,23 @@ func main() {
 		ShowFileSize:   *showFileSize,
 		ShowVCNs:       *showVCNs,
 		ShowIndex:      *showIndex,
+		ShowIndexSlack: *showIndexSlack,
+		ShowListing:    *showListing,
+		ShowReparse:    *showReparse,
+		ShowSecurity:   *showSecurity,
+		ShowEFS:        *showEFS,
+		ShowWSL:        *showWSL,
+		ShowObjectID:   *showObjectID,
+		ShowTxF:        *showTxF,
 		ShowParent:     *showParent,
 		ShowPath:       *showPath,
 		ShowUSNJRNL:    *showUsnjrnl,
+		ShowLogFile:    *logfile,
+		ShowVolInfo:    *volinfo,
+		ShowTimestomp:  *timestomp,
+		ShowRecovery:   *showRecovery,
 		ShowTree:       *showtree,
+		Timestomp:      timestompAnalysis,
 	}
 
 	if *logactive {
@@ -121,6 +175,12 @@ func main() {
 
 	}
 
+	if assessRecoverability && !allEntries {
+		msg := "recoverability requires all $MFT entries to know the allocated clusters, do not select entries."
+		log.Println(msg)
+		FSLogger.MFTExtractorlogger.Warning(msg)
+	}
+
 	exp := exporter.Exporter{Location: location, Hash: *hashFiles, Strategy: *strategy}
 
 	flm := filtermanager.FilterManager{}
@@ -128,15 +188,27 @@ func main() {
 	if *exportFiles != "" {
 		fileNamesToExport = append(fileNamesToExport, utils.GetEntries(*exportFiles)...)
 		flm.Register(filters.FoldersFilter{Include: false})
-		flm.Register(filters.NameFilter{Filenames: fileNamesToExport})
+		flm.Register(filters.NameFilter{Filenames: fileNamesToExport, Exact: *exactNames})
 	}
 
 	if *fileExtensions != "" {
-		flm.Register(filters.ExtensionsFilter{Extensions: strings.Split(*fileExtensions, ",")})
+		flm.Register(filters.ExtensionsFilter{Extensions: strings.Split(*fileExtensions, ","), Exact: *exactNames})
 	}
 
 	if *exportFilesPath != "" {
-		flm.Register(filters.PathFilter{NamePath: *exportFilesPath})
+		flm.Register(filters.PathFilter{NamePath: *exportFilesPath, FollowLinks: *followLinks, Exact: *exactNames})
+	}
+
+	if *ownerSID != "" {
+		flm.Register(filters.OwnerFilter{SID: *ownerSID})
+	}
+
+	if *objectID != "" {
+		flm.Register(filters.ObjectIDFilter{GUID: *objectID})
+	}
+
+	if *posixUID != -1 || *posixGID != -1 {
+		flm.Register(filters.POSIXOwnerFilter{UID: *posixUID, GID: *posixGID})
 	}
 
 	if *orphans {
@@ -147,9 +219,20 @@ func main() {
 		flm.Register(filters.DeletedFilter{Include: *deleted})
 	}
 
+	if *recoverable != "" {
+		flm.Register(filters.RecoverabilityFilter{Statuses: strings.Split(*recoverable, ",")})
+	}
+
+	if *timestomp {
+		flm.Register(filters.TimestompFilter{Timestomp: timestompAnalysis})
+	}
+
 	if *evidencefile != "" || *physicalDrive != -1 || *vmdkfile != "" {
 		physicalDisk := new(disk.Disk)
 		physicalDisk.Initialize(*evidencefile, *physicalDrive, *vmdkfile)
+		physicalDisk.ShadowCopy = *shadowCopy
+		physicalDisk.BitLockerKey = disk.BitLockerKey{RecoveryPassword: *recoveryPassword, KeyFile: *bekFile}
+		physicalDisk.LUKSKey = disk.LUKSKey{Passphrase: *luksPassphrase, KeyFile: *luksKeyFile}
 
 		recordsPerPartition := physicalDisk.Process(*partitionNum, entries, *fromMFTEntry, *toMFTEntry)
 		defer physicalDisk.Close()
@@ -157,16 +240,54 @@ func main() {
 			physicalDisk.ListPartitions()
 		}
 
+		if *listShadowCopies {
+			physicalDisk.ListShadowCopies()
+		}
+
 		if *volinfo {
 			physicalDisk.ShowVolumeInfo()
 		}
 
+		if *health {
+			if len(entries) > 0 || *fromMFTEntry != -1 || *toMFTEntry != math.MaxUint32 {
+				msg := "volume health report requires all $MFT entries, do not select entries."
+				FSLogger.MFTExtractorlogger.Warning(msg)
+			} else {
+				physicalDisk.ShowVolumeHealth()
+			}
+		}
+
+		if assessRecoverability && allEntries {
+			physicalDisk.AssessRecoverability()
+		}
+
 		if *collectUnallocated {
 			exp.ExportUnallocated(*physicalDisk)
 		}
 
 		for partitionId, records := range recordsPerPartition {
+			if *logfile { // all records are needed to correlate operations
+				parsedLogFile := LogFile.Process(records, *physicalDisk, partitionId)
+				rp.ShowLogFileInfo(parsedLogFile)
+				logfileRecords = nil
+				if parsedLogFile != nil {
+					logfileRecords = parsedLogFile.Records
+				}
+			}
 
+			if *usnjrnl {
+				usnjrnlRecords = UsnJrnl.Process(records, *physicalDisk, partitionId)
+			}
+
+			if *carveUsnjrnl {
+				usnjrnlRecords = append(usnjrnlRecords, UsnJrnl.Carve(records, *physicalDisk, partitionId, usnjrnlRecords)...)
+			}
+
+			if *timestomp { // volume lifetime needs all records
+				timestompAnalysis.Prepare(records, usnjrnlRecords, collectedTime)
+			}
+
+			volumeRecords := records
 			records = flm.ApplyFilters(records)
 
 			if location != "" {
@@ -176,16 +297,24 @@ func main() {
 				}
 			}
 
-			if *usnjrnl {
-				usnjrnlRecords = UsnJrnl.Process(records, *physicalDisk, partitionId)
-			}
-
 			if *buildtree {
 				recordsTree.Build(records)
 
 			}
 
-			rp.Show(records, usnjrnlRecords, partitionId, recordsTree)
+			rp.Show(records, usnjrnlRecords, logfileRecords, partitionId, recordsTree)
+
+			if *showTxF { // resource manager files are usually filtered out
+				rp.ShowTxFSummary(volumeRecords)
+			}
+
+			if *carveMFT {
+				carvedRecords := flm.ApplyFilters(physicalDisk.CarveRecords(partitionId))
+				if location != "" {
+					exp.ExportRecords(carvedRecords, *physicalDisk, partitionId)
+				}
+				rp.ShowCarved(carvedRecords, partitionId)
+			}
 
 		}
 
@@ -200,6 +329,14 @@ func main() {
 		ntfs.MFT = &MFT.MFTTable{Size: fsize}
 		ntfs.ProcessMFT(data, entries, *fromMFTEntry, *toMFTEntry)
 
+		if *timestomp {
+			timestompAnalysis.Prepare(ntfs.MFT.Records, usnjrnlRecords, collectedTime)
+		}
+
+		if assessRecoverability && allEntries { // only allocated records claim clusters without the volume
+			ntfs.MFT.AssessRecoverability(nil)
+		}
+
 		records = flm.ApplyFilters(ntfs.MFT.Records)
 
 		if *buildtree {
@@ -207,7 +344,11 @@ func main() {
 
 		}
 
-		rp.Show(records, usnjrnlRecords, 0, recordsTree)
+		rp.Show(records, usnjrnlRecords, logfileRecords, 0, recordsTree)
+
+		if *showTxF {
+			rp.ShowTxFSummary(ntfs.MFT.Records)
+		}
 
 	}
 
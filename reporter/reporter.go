@@ -4,7 +4,9 @@ import (
 	"fmt"
 
 	"github.com/aarsakian/FileSystemForensics/FS/NTFS/MFT"
+	LogFile "github.com/aarsakian/FileSystemForensics/FS/NTFS/logfile"
 	UsnJrnl "github.com/aarsakian/FileSystemForensics/FS/NTFS/usnjrnl"
+	"github.com/aarsakian/FileSystemForensics/analysis"
 	"github.com/aarsakian/FileSystemForensics/tree"
 )
 
@@ -18,13 +20,29 @@ type Reporter struct {
 	ShowFileSize   bool
 	ShowVCNs       bool
 	ShowIndex      bool
+	ShowIndexSlack bool
+	ShowListing    bool
+	ShowReparse    bool
+	ShowSecurity   bool
+	ShowEFS        bool
+	ShowWSL        bool
+	ShowObjectID   bool
+	ShowTxF        bool
 	ShowParent     bool
 	ShowPath       bool
 	ShowUSNJRNL    bool
+	ShowLogFile    bool
+	ShowVolInfo    bool
+	ShowTimestomp  bool
+	ShowRecovery   bool
 	ShowTree       bool
+	Timestomp      *analysis.Timestomp
 }
 
-func (rp Reporter) Show(records []MFT.Record, usnjrnlRecords UsnJrnl.Records, partitionId int, tree tree.Tree) {
+func (rp Reporter) Show(records []MFT.Record, usnjrnlRecords UsnJrnl.Records, logfileRecords LogFile.Records,
+	partitionId int, tree tree.Tree) {
+	logfileRecordsPerEntry := logfileRecords.GroupByEntry()
+	transactedPerRef := usnjrnlRecords.GroupTransactedByReference()
 	for _, record := range records {
 		askedToShow := false
 
@@ -69,6 +87,46 @@ func (rp Reporter) Show(records []MFT.Record, usnjrnlRecords UsnJrnl.Records, pa
 			askedToShow = true
 		}
 
+		if rp.ShowListing {
+			record.ShowDirectoryListing()
+		}
+
+		if rp.ShowIndexSlack {
+			record.ShowIndexSlack()
+		}
+
+		if rp.ShowReparse || rp.ShowFull {
+			record.ShowReparse()
+		}
+
+		if rp.ShowSecurity || rp.ShowFull {
+			record.ShowSecurity()
+		}
+
+		if rp.ShowEFS || rp.ShowFull {
+			record.ShowEFS()
+		}
+
+		if rp.ShowWSL || rp.ShowFull {
+			record.ShowWSL()
+		}
+
+		if rp.ShowObjectID || rp.ShowFull {
+			record.ShowObjectID()
+		}
+
+		if rp.ShowTxF || rp.ShowFull {
+			record.ShowTxF()
+			for _, usnRecord := range transactedPerRef[UsnJrnl.FileReference(uint64(record.Entry), record.Seq)] {
+				usnRecord.ShowInfo()
+			}
+			if record.IsDeleted() && record.Seq > 0 { // sequence is incremented when the entry is freed
+				for _, usnRecord := range transactedPerRef[UsnJrnl.FileReference(uint64(record.Entry), record.Seq-1)] {
+					usnRecord.ShowInfo()
+				}
+			}
+		}
+
 		if rp.ShowParent || rp.ShowFull {
 			record.ShowParentRecordInfo()
 		}
@@ -77,6 +135,24 @@ func (rp Reporter) Show(records []MFT.Record, usnjrnlRecords UsnJrnl.Records, pa
 			record.ShowPath(partitionId)
 		}
 
+		if rp.ShowLogFile {
+			operations := logfileRecordsPerEntry[int(record.Entry)]
+			if len(operations) > 0 {
+				fmt.Printf("%d %s $LogFile operations %d\n", record.Entry, record.GetFname(), len(operations))
+			}
+			for _, operation := range operations {
+				operation.ShowInfo()
+			}
+		}
+
+		if rp.ShowRecovery {
+			record.ShowRecoverability()
+		}
+
+		if rp.ShowTimestomp {
+			rp.Timestomp.ShowInfo(record)
+		}
+
 		if askedToShow {
 			fmt.Printf("\n")
 		}
@@ -94,3 +170,30 @@ func (rp Reporter) Show(records []MFT.Record, usnjrnlRecords UsnJrnl.Records, pa
 	}
 
 }
+
+// resource manager of the volume and files by their TxF file id, expects the unfiltered records of the volume
+func (rp Reporter) ShowTxFSummary(records MFT.Records) {
+	fmt.Printf("Transactional NTFS resource manager and files\n")
+	rmMetadata := records.GetRmMetadata()
+	if rmMetadata != nil {
+		rmMetadata.ShowInfo()
+	}
+	records.ShowTxFFiles()
+	fmt.Printf("\n")
+}
+
+// restart area and clients of $LogFile are volume information
+func (rp Reporter) ShowLogFileInfo(logfile *LogFile.LogFile) {
+	if rp.ShowVolInfo && logfile != nil {
+		logfile.ShowInfo()
+	}
+}
+
+// carved records have no parents or journal entries to correlate
+func (rp Reporter) ShowCarved(records []MFT.Record, partitionId int) {
+	rp.ShowTree = false
+	for _, record := range records {
+		record.ShowCarvedInfo()
+		rp.Show([]MFT.Record{record}, nil, nil, partitionId, tree.Tree{})
+	}
+}
@@ -22,7 +22,9 @@ type Node struct {
 }
 
 type Tree struct {
-	root *Node
+	root        *Node
+	FollowLinks bool
+	nodes       map[uint32]*Node // entry to node, used to reach link targets
 }
 
 func (t *Tree) Build(records MFT.Records) {
@@ -38,6 +40,18 @@ func (t *Tree) Build(records MFT.Records) {
 		t.AddRecord(&records[idx])
 	}
 
+	t.nodes = map[uint32]*Node{}
+	if t.root != nil {
+		t.root.index(t.nodes)
+	}
+
+}
+
+func (node *Node) index(nodes map[uint32]*Node) {
+	nodes[node.record.Entry] = node
+	for _, childnode := range node.children {
+		childnode.index(nodes)
+	}
 }
 
 func (t *Tree) AddRecord(record *MFT.Record) {
@@ -119,11 +133,37 @@ func (node *Node) updateEntryRange(entry uint32) {
 }
 
 func (t Tree) Show() {
-
+	if t.FollowLinks {
+		t.root.descendFollowingLinks(t.nodes, map[uint32]bool{})
+		return
+	}
 	t.root.descend()
 
 }
 
+// link targets are descended once to avoid loops
+func (node Node) descendFollowingLinks(nodes map[uint32]*Node, visited map[uint32]bool) {
+	if visited[node.record.Entry] {
+		return
+	}
+	visited[node.record.Entry] = true
+
+	if node.children != nil {
+		node.showChildrenInfo()
+	}
+	for _, childnode := range node.children {
+		childnode.descendFollowingLinks(nodes, visited)
+	}
+
+	if node.record.LinkTarget == nil {
+		return
+	}
+	targetNode, ok := nodes[node.record.LinkTarget.Entry]
+	if ok {
+		targetNode.descendFollowingLinks(nodes, visited)
+	}
+}
+
 func (node Node) descend() {
 	if node.children == nil {
 		return
@@ -149,6 +189,9 @@ func (node Node) showChildrenInfo() {
 
 	for _, childnode := range node.children {
 		msg := fmt.Sprintf(" %s %d", childnode.record.GetFname(), childnode.record.Entry)
+		if childnode.record.LinkTarget != nil {
+			msg += fmt.Sprintf(" -> %s %d", childnode.record.LinkTarget.GetFname(), childnode.record.LinkTarget.Entry)
+		}
 
 		fmt.Print(msg)
 		msgB.WriteString(msg)
@@ -33,6 +33,8 @@ type AskedFile struct {
 	Fname   string
 	Id      int
 	Content []byte
+	Paths   []string //of every hard link
+	EFSInfo string   //users and recovery agents of EFS encrypted files, content is the raw ciphertext
 }
 
 type TimeSpec struct {
@@ -259,7 +261,7 @@ func Unmarshal(data []byte, v interface{}) (int, error) {
 		case reflect.Uint64:
 			var temp uint64
 
-			if name == "ParRef" {
+			if name == "ParRef" || name == "EntryRef" {
 				buf := make([]byte, 8)
 				copy(buf, data[idx:idx+6])
 				binary.Read(bytes.NewBuffer(buf), binary.LittleEndian, &temp)
@@ -332,6 +334,25 @@ func WriteFile(filename string, content []byte) {
 
 }
 
+// restores the last two bytes of each sector from the update sequence array
+func ApplyFixUps(data []byte, fixupOffset int, fixupCount int, sectorSize int) error {
+	if fixupCount == 0 || fixupOffset+2*fixupCount > len(data) {
+		return errors.New("fixup array exceeds available buffer")
+	}
+	signature := [2]byte{data[fixupOffset], data[fixupOffset+1]}
+	for idx := 1; idx < fixupCount; idx++ {
+		sectorEnd := idx * sectorSize
+		if sectorEnd > len(data) {
+			break
+		}
+		if data[sectorEnd-2] != signature[0] || data[sectorEnd-1] != signature[1] {
+			return fmt.Errorf("fixup signature mismatch at sector %d", idx-1)
+		}
+		copy(data[sectorEnd-2:sectorEnd], data[fixupOffset+2*idx:fixupOffset+2*idx+2])
+	}
+	return nil
+}
+
 func DecodeUTF16(b []byte) string {
 	utf := make([]uint16, (len(b)+(2-1))/2) //2 bytes for one char?
 	for i := 0; i+(2-1) < len(b); i += 2 {